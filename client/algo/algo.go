@@ -0,0 +1,607 @@
+// Package algo works large parent orders by slicing them into child orders:
+// TWAP over time, VWAP along a historical volume curve, and iceberg orders
+// that show a small slice and replenish it on fill.
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// ErrIncomplete is returned by Run when the schedule ended before the
+// parent order was filled
+var ErrIncomplete = errors.New("parent order incomplete")
+
+// OrderSender submits and cancels child orders. Child orders are submitted
+// under a tag so that a send whose outcome is unknown can be submitted again
+// without placing the order twice.
+// *trading.Client implements this interface.
+type OrderSender interface {
+	SubmitChildOrder(ctx context.Context, tag string, req http.NewOrderRequest) (trading.Submission, error)
+	ForgetSubmission(tag string)
+	CancelChildOrder(ctx context.Context, productCode, acceptanceID string) error
+}
+
+// Quote provides the best bid and ask.
+// *orderbook.Book implements this interface.
+type Quote interface {
+	Best() (bid, ask websocket.PriceLevel, ok bool)
+}
+
+// Order is a parent order to be worked
+type Order struct {
+	ProductCode string
+	Side        http.NewOrderRequestSide
+	Size        float64
+	// ChildOrderType is the type of the child orders, LIMIT by default
+	ChildOrderType http.NewOrderRequestChildOrderType
+	// LimitPrice is the worst price of any child order: buys never above it
+	// and sells never below it. Without a quote, LIMIT child orders are
+	// placed at this price. Zero disables the guard for MARKET child orders.
+	LimitPrice float64
+}
+
+// Progress reports how much of a parent order is done
+type Progress struct {
+	ProductCode  string
+	Side         http.NewOrderRequestSide
+	Size         float64
+	Filled       float64
+	Working      float64 // size of the open child orders
+	AveragePrice float64 // of the fills
+	ChildOrders  int     // child orders sent
+	Done         bool    // Run has returned
+}
+
+// Remaining returns the size not filled yet
+func (p Progress) Remaining() float64 {
+	return max(p.Size-p.Filled, 0)
+}
+
+// step raises the cumulative target to fraction of the parent size at the
+// offset from the start
+type step struct {
+	at       time.Duration
+	fraction float64
+}
+
+// child is an open child order
+type child struct {
+	tag       string
+	price     float64
+	size      float64
+	filled    float64
+	canceling bool
+}
+
+// pendingOrder is a child order submitted without a known outcome. It is
+// submitted again under the same tag until it is known whether it was
+// accepted.
+type pendingOrder struct {
+	tag        string
+	req        http.NewOrderRequest
+	price      float64
+	size       float64
+	unresolved bool // a submission failed ambiguously, so the tag is still tracked
+}
+
+// maxOrphans bounds the order events kept for acceptance IDs not known yet
+const maxOrphans = 256
+
+// Algo works a parent order. Fills and cancels are tracked from realtime
+// child order events, fed through HandleOrderEvent or Attach.
+type Algo struct {
+	sender          OrderSender
+	order           Order
+	steps           []step
+	end             time.Duration // zero to run until filled
+	display         float64       // cap on the open size, zero for none
+	quote           Quote
+	minSize         float64
+	repriceInterval time.Duration
+	maxFailures     int
+	retryInterval   time.Duration
+	wake            chan struct{}
+
+	mu              sync.Mutex
+	target          float64
+	children        map[string]*child
+	pending         *pendingOrder
+	orphans         []websocket.OrderEventMessage
+	filled          float64
+	notional        float64
+	sent            int
+	failed          int // child orders that failed after acceptance
+	done            bool
+	progressHandler func(Progress)
+}
+
+// Option configures an Algo
+type Option func(*Algo)
+
+// WithQuote prices LIMIT child orders at the best bid (buys) or best ask
+// (sells), capped by the limit price, and checks MARKET child orders
+// against the limit price
+func WithQuote(quote Quote) Option {
+	return func(a *Algo) {
+		a.quote = quote
+	}
+}
+
+// WithMinSize sets the minimum child order size, 0.001 by default. Smaller
+// slices are deferred to later ones.
+func WithMinSize(size float64) Option {
+	return func(a *Algo) {
+		a.minSize = size
+	}
+}
+
+// WithRepriceInterval checks the open LIMIT child orders against the quote
+// at the interval and replaces those that are no longer at the desired
+// price. By default they are checked only at each slice and order event.
+func WithRepriceInterval(d time.Duration) Option {
+	return func(a *Algo) {
+		a.repriceInterval = d
+	}
+}
+
+// WithMaxFailures stops Run after n child orders failed to send or failed
+// after acceptance, 3 by default. Orders refused by a closed gate of the
+// trading client, such as during an exchange pause, are not failures: Run
+// waits and sends them again.
+func WithMaxFailures(n int) Option {
+	return func(a *Algo) {
+		a.maxFailures = n
+	}
+}
+
+// WithRetryInterval sets how long Run waits before sending again after a
+// child order failed to send or was refused by a gate, one second by default
+func WithRetryInterval(d time.Duration) Option {
+	return func(a *Algo) {
+		a.retryInterval = d
+	}
+}
+
+// NewTWAP works the order in equal slices spread evenly over the duration
+func NewTWAP(sender OrderSender, order Order, duration time.Duration, slices int, opts ...Option) *Algo {
+	slices = max(slices, 1)
+	profile := make([]float64, slices)
+	for i := range profile {
+		profile[i] = 1
+	}
+	return NewVWAP(sender, order, profile, duration/time.Duration(slices), opts...)
+}
+
+// NewVWAP works the order along a volume profile: slice i is sent at
+// i*bucket and is proportional to profile[i]. See VolumeProfile.
+func NewVWAP(sender OrderSender, order Order, profile []float64, bucket time.Duration, opts ...Option) *Algo {
+	var total float64
+	for _, v := range profile {
+		total += max(v, 0)
+	}
+	steps := make([]step, 0, len(profile))
+	var cumulative float64
+	for i, v := range profile {
+		if total > 0 {
+			cumulative += max(v, 0) / total
+		} else {
+			cumulative = float64(i+1) / float64(len(profile))
+		}
+		steps = append(steps, step{at: bucket * time.Duration(i), fraction: cumulative})
+	}
+	if len(steps) > 0 {
+		steps[len(steps)-1].fraction = 1
+	}
+	return newAlgo(sender, order, steps, bucket*time.Duration(len(profile)), 0, opts)
+}
+
+// NewIceberg works the order with at most display open at a time, and
+// replenishes it as it fills until the parent order is filled
+func NewIceberg(sender OrderSender, order Order, display float64, opts ...Option) *Algo {
+	return newAlgo(sender, order, []step{{fraction: 1}}, 0, display, opts)
+}
+
+func newAlgo(sender OrderSender, order Order, steps []step, end time.Duration, display float64, opts []Option) *Algo {
+	if order.ChildOrderType == "" {
+		order.ChildOrderType = http.NewOrderRequestChildOrderTypeLIMIT
+	}
+	a := &Algo{
+		sender:        sender,
+		order:         order,
+		steps:         steps,
+		end:           end,
+		display:       display,
+		minSize:       0.001,
+		maxFailures:   3,
+		retryInterval: time.Second,
+		wake:          make(chan struct{}, 1),
+		children:      make(map[string]*child),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// OnProgress sets a callback to receive progress after every fill and when
+// Run returns
+func (a *Algo) OnProgress(handler func(Progress)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.progressHandler = handler
+}
+
+// Attach feeds the algo from the child order events of the client, which
+// must be subscribed to child_order_events. The returned function detaches
+// the algo.
+func (a *Algo) Attach(c *websocket.Client) (detach func()) {
+	return c.OnOrderEvents(a.HandleOrderEvent, websocket.ForProducts(a.order.ProductCode)).Remove
+}
+
+// Progress returns the current progress
+func (a *Algo) Progress() Progress {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.progressLocked()
+}
+
+// Run works the order until it is filled, the schedule ends or ctx is
+// done. Open child orders are canceled before it returns. It returns nil
+// once the parent order is filled and ErrIncomplete when the schedule
+// ended first. A child order whose outcome is still unknown cannot be
+// canceled: the error then also wraps trading.ErrAmbiguous and names its
+// tag, which the trading client keeps tracking.
+func (a *Algo) Run(ctx context.Context) (err error) {
+	if err := a.validate(); err != nil {
+		return err
+	}
+	defer a.finish(ctx)
+	defer func() {
+		if tag := a.unresolved(); tag != "" && err != nil {
+			err = fmt.Errorf("%w; child order %s: %w", err, tag, trading.ErrAmbiguous)
+		}
+	}()
+
+	var reprice <-chan time.Time
+	if a.repriceInterval > 0 {
+		ticker := time.NewTicker(a.repriceInterval)
+		defer ticker.Stop()
+		reprice = ticker.C
+	}
+
+	start := time.Now()
+	next := 0
+	sendFailures := 0
+	for {
+		elapsed := time.Since(start)
+		for next < len(a.steps) && elapsed >= a.steps[next].at {
+			a.mu.Lock()
+			a.target = a.order.Size * a.steps[next].fraction
+			a.mu.Unlock()
+			next++
+		}
+
+		var retry <-chan time.Time
+		if err := a.rebalance(ctx); err != nil {
+			if !errors.Is(err, trading.ErrGateClosed) {
+				sendFailures++
+			}
+			retry = time.After(a.retryInterval)
+		}
+		a.mu.Lock()
+		failures := sendFailures + a.failed
+		a.mu.Unlock()
+		if failures >= a.maxFailures {
+			return fmt.Errorf("parent order stopped after %d failed child orders", failures)
+		}
+		if a.Progress().Remaining() < a.minSize {
+			return nil
+		}
+
+		var timer <-chan time.Time
+		switch {
+		case next < len(a.steps):
+			timer = time.After(a.steps[next].at - elapsed)
+		case a.end > 0:
+			if elapsed >= a.end {
+				return fmt.Errorf("%w: %v of %v filled", ErrIncomplete, a.Progress().Filled, a.order.Size)
+			}
+			timer = time.After(a.end - elapsed)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer:
+		case <-retry:
+		case <-reprice:
+		case <-a.wake:
+		}
+	}
+}
+
+// unresolved returns the tag of the child order whose outcome is unknown,
+// empty for none
+func (a *Algo) unresolved() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending == nil || !a.pending.unresolved {
+		return ""
+	}
+	return a.pending.tag
+}
+
+// validate checks that child orders can be priced
+func (a *Algo) validate() error {
+	o := a.order
+	switch {
+	case o.ProductCode == "":
+		return fmt.Errorf("invalid parent order: product code is empty")
+	case o.Size <= 0:
+		return fmt.Errorf("invalid parent order: size must be positive")
+	case o.Side != http.NewOrderRequestSideBUY && o.Side != http.NewOrderRequestSideSELL:
+		return fmt.Errorf("invalid parent order: side must be BUY or SELL")
+	case o.ChildOrderType == http.NewOrderRequestChildOrderTypeLIMIT && a.quote == nil && o.LimitPrice <= 0:
+		return fmt.Errorf("invalid parent order: LIMIT child orders need a quote or a limit price")
+	case o.ChildOrderType == http.NewOrderRequestChildOrderTypeMARKET && o.LimitPrice > 0 && a.quote == nil:
+		return fmt.Errorf("invalid parent order: a limit price on MARKET child orders needs a quote")
+	}
+	return nil
+}
+
+// rebalance replaces child orders that are off price and sends a child
+// order for the part of the target that is neither filled nor open. A child
+// order whose outcome is unknown counts as open and is submitted again under
+// its tag before any other is sent.
+func (a *Algo) rebalance(ctx context.Context) error {
+	price, ok := a.price()
+	limit := a.order.ChildOrderType == http.NewOrderRequestChildOrderTypeLIMIT
+
+	a.mu.Lock()
+	var working float64
+	var replace []string
+	for id, c := range a.children {
+		// Canceling orders count as open until the cancel is confirmed, so
+		// that a fill in between cannot overshoot the target
+		working += c.size - c.filled
+		if limit && ok && !c.canceling && c.price != price {
+			c.canceling = true
+			replace = append(replace, id)
+		}
+	}
+	pending := a.pending
+	if pending != nil {
+		working += pending.size
+	}
+	size := a.target - a.filled - working
+	if a.display > 0 {
+		size = min(size, a.display-working)
+	}
+	size = roundSize(size)
+	a.mu.Unlock()
+
+	for _, id := range replace {
+		// The replacement is sent once the CANCEL event frees the size
+		if err := a.sender.CancelChildOrder(ctx, a.order.ProductCode, id); err != nil {
+			a.mu.Lock()
+			if c, ok := a.children[id]; ok {
+				c.canceling = false
+			}
+			a.mu.Unlock()
+		}
+	}
+
+	if pending == nil {
+		if !ok || size < a.minSize {
+			return nil
+		}
+		req := http.NewOrderRequest{
+			ProductCode:    a.order.ProductCode,
+			ChildOrderType: a.order.ChildOrderType,
+			Side:           a.order.Side,
+			Size:           float32(size),
+		}
+		if limit {
+			p := float32(price)
+			req.Price = &p
+		}
+		pending = &pendingOrder{tag: trading.NewOrderTag(), req: req, price: price, size: size}
+		a.mu.Lock()
+		a.pending = pending
+		a.mu.Unlock()
+	}
+
+	submission, err := a.sender.SubmitChildOrder(ctx, pending.tag, pending.req)
+	if err != nil {
+		a.mu.Lock()
+		switch {
+		case errors.Is(err, trading.ErrAmbiguous):
+			// The order may have been accepted; submitting the tag again
+			// finds it among the orders before sending
+			pending.unresolved = true
+		case errors.Is(err, trading.ErrGateClosed) && pending.unresolved:
+		default:
+			// Nothing was placed and the tag is not tracked anymore
+			a.pending = nil
+		}
+		a.mu.Unlock()
+		return err
+	}
+	id := submission.AcceptanceID
+
+	a.mu.Lock()
+	a.pending = nil
+	a.sent++
+	a.children[id] = &child{tag: pending.tag, price: pending.price, size: pending.size}
+	// Events may arrive before the acceptance ID is returned
+	var early []websocket.OrderEventMessage
+	kept := a.orphans[:0]
+	for _, m := range a.orphans {
+		if m.ChildOrderAcceptanceID == id {
+			early = append(early, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	a.orphans = kept
+	a.mu.Unlock()
+
+	for _, m := range early {
+		a.HandleOrderEvent(m)
+	}
+	return nil
+}
+
+// price returns the price of a new child order and whether one may be sent
+// now. MARKET child orders have no price.
+func (a *Algo) price() (float64, bool) {
+	limit := a.order.LimitPrice
+	buy := a.order.Side == http.NewOrderRequestSideBUY
+	var bid, ask websocket.PriceLevel
+	quoted := false
+	if a.quote != nil {
+		bid, ask, quoted = a.quote.Best()
+	}
+
+	if a.order.ChildOrderType == http.NewOrderRequestChildOrderTypeMARKET {
+		switch {
+		case limit <= 0:
+			return 0, true
+		case !quoted:
+			return 0, false
+		case buy:
+			return 0, ask.Price <= limit
+		default:
+			return 0, bid.Price >= limit
+		}
+	}
+
+	switch {
+	case !quoted:
+		return limit, limit > 0
+	case buy && limit > 0:
+		return min(bid.Price, limit), true
+	case buy:
+		return bid.Price, true
+	case limit > 0:
+		return max(ask.Price, limit), true
+	default:
+		return ask.Price, true
+	}
+}
+
+// HandleOrderEvent updates the child orders from a realtime order event.
+// Events of other orders are ignored.
+func (a *Algo) HandleOrderEvent(m websocket.OrderEventMessage) {
+	if m.ProductCode != a.order.ProductCode && m.ProductCode != "" {
+		return
+	}
+
+	a.mu.Lock()
+	c, ok := a.children[m.ChildOrderAcceptanceID]
+	if !ok {
+		if !a.done {
+			a.orphans = append(a.orphans, m)
+			if len(a.orphans) > maxOrphans {
+				a.orphans = a.orphans[1:]
+			}
+		}
+		a.mu.Unlock()
+		return
+	}
+
+	filled, closed := false, false
+	switch m.EventType {
+	case "EXECUTION":
+		c.filled += m.Size
+		a.filled += m.Size
+		a.notional += m.Price * m.Size
+		filled = true
+		closed = c.filled >= c.size-1e-9
+	case "CANCEL", "EXPIRE":
+		closed = true
+	case "ORDER_FAILED":
+		a.failed++
+		closed = true
+	}
+	if closed {
+		delete(a.children, m.ChildOrderAcceptanceID)
+	}
+	progress := a.progressLocked()
+	progressHandler := a.progressHandler
+	a.mu.Unlock()
+
+	if closed {
+		a.sender.ForgetSubmission(c.tag)
+		select {
+		case a.wake <- struct{}{}:
+		default:
+		}
+	}
+	if filled && progressHandler != nil {
+		progressHandler(progress)
+	}
+}
+
+// finish cancels the open child orders and reports the final progress
+func (a *Algo) finish(ctx context.Context) {
+	cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	children := make(map[string]string, len(a.children))
+	for id, c := range a.children {
+		children[id] = c.tag
+	}
+	a.mu.Unlock()
+	for id, tag := range children {
+		_ = a.sender.CancelChildOrder(cancelCtx, a.order.ProductCode, id)
+		a.sender.ForgetSubmission(tag)
+	}
+
+	a.mu.Lock()
+	a.done = true
+	a.orphans = nil
+	progress := a.progressLocked()
+	progressHandler := a.progressHandler
+	a.mu.Unlock()
+
+	if progressHandler != nil {
+		progressHandler(progress)
+	}
+}
+
+// progressLocked returns the progress. a.mu must be held.
+func (a *Algo) progressLocked() Progress {
+	p := Progress{
+		ProductCode: a.order.ProductCode,
+		Side:        a.order.Side,
+		Size:        a.order.Size,
+		Filled:      a.filled,
+		ChildOrders: a.sent,
+		Done:        a.done,
+	}
+	for _, c := range a.children {
+		p.Working += c.size - c.filled
+	}
+	if a.filled > 0 {
+		p.AveragePrice = a.notional / a.filled
+	}
+	return p
+}
+
+// roundSize rounds a size down to the satoshi
+func roundSize(size float64) float64 {
+	if size <= 0 {
+		return 0
+	}
+	return math.Floor(size*1e8+1e-6) / 1e8
+}
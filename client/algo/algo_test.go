@@ -0,0 +1,407 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+var _ OrderSender = (*trading.Client)(nil)
+
+type sentOrder struct {
+	id      string
+	size    float64
+	price   float64
+	working float64 // open size reported by the algo when the order was sent
+}
+
+// fakeSender records orders and lets the test react to them
+type fakeSender struct {
+	algo *Algo
+
+	mu        sync.Mutex
+	refuse    int // sends refused by a closed gate before the next ones go through
+	ambiguous int // sends accepted but reported as ambiguous, as on a timeout
+	orders    []sentOrder
+	tags      map[string]string // acceptance IDs by tag
+	cancels   []string
+	forgotten []string
+	onSend    func(o sentOrder)
+	onCancel  func(id string)
+}
+
+func (s *fakeSender) SubmitChildOrder(ctx context.Context, tag string, req http.NewOrderRequest) (trading.Submission, error) {
+	s.mu.Lock()
+	if s.refuse > 0 {
+		s.refuse--
+		s.mu.Unlock()
+		return trading.Submission{Tag: tag}, fmt.Errorf("%w: exchange is paused", trading.ErrGateClosed)
+	}
+	if id, ok := s.tags[tag]; ok {
+		// Reconciled: the order is found among the orders
+		s.mu.Unlock()
+		return trading.Submission{Tag: tag, AcceptanceID: id, Reconciled: true}, nil
+	}
+	s.mu.Unlock()
+
+	o := sentOrder{size: http.Decimal(&req.Size), working: s.algo.Progress().Working}
+	if req.Price != nil {
+		o.price = http.Decimal(req.Price)
+	}
+	s.mu.Lock()
+	o.id = fmt.Sprintf("JRF-%d", len(s.orders)+1)
+	s.orders = append(s.orders, o)
+	if s.tags == nil {
+		s.tags = make(map[string]string)
+	}
+	s.tags[tag] = o.id
+	lost := s.ambiguous > 0
+	if lost {
+		s.ambiguous--
+	}
+	onSend := s.onSend
+	s.mu.Unlock()
+
+	if onSend != nil {
+		onSend(o)
+	}
+	if lost {
+		return trading.Submission{Tag: tag, Attempts: 1}, fmt.Errorf("%w: timeout", trading.ErrAmbiguous)
+	}
+	return trading.Submission{Tag: tag, AcceptanceID: o.id, Attempts: 1}, nil
+}
+
+func (s *fakeSender) ForgetSubmission(tag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tags, tag)
+	s.forgotten = append(s.forgotten, tag)
+}
+
+func (s *fakeSender) CancelChildOrder(ctx context.Context, productCode, acceptanceID string) error {
+	s.mu.Lock()
+	s.cancels = append(s.cancels, acceptanceID)
+	onCancel := s.onCancel
+	s.mu.Unlock()
+
+	if onCancel != nil {
+		onCancel(acceptanceID)
+	}
+	return nil
+}
+
+func (s *fakeSender) sent() []sentOrder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentOrder(nil), s.orders...)
+}
+
+func (s *fakeSender) canceled() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.cancels...)
+}
+
+func event(id, eventType string, price, size float64) websocket.OrderEventMessage {
+	return websocket.OrderEventMessage{
+		ProductCode:            "BTC_JPY",
+		ChildOrderAcceptanceID: id,
+		EventType:              eventType,
+		Price:                  price,
+		Size:                   size,
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// fakeQuote is a quote the test can move
+type fakeQuote struct {
+	mu       sync.Mutex
+	bid, ask float64
+}
+
+func (q *fakeQuote) Best() (bid, ask websocket.PriceLevel, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return websocket.PriceLevel{Price: q.bid, Size: 1}, websocket.PriceLevel{Price: q.ask, Size: 1}, true
+}
+
+func (q *fakeQuote) set(bid, ask float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.bid, q.ask = bid, ask
+}
+
+func TestTWAP(t *testing.T) {
+	sender := &fakeSender{}
+	order := Order{
+		ProductCode:    "BTC_JPY",
+		Side:           http.NewOrderRequestSideBUY,
+		Size:           0.3,
+		ChildOrderType: http.NewOrderRequestChildOrderTypeMARKET,
+	}
+	algo := NewTWAP(sender, order, 90*time.Millisecond, 3)
+	sender.algo = algo
+	// The fill arrives before the acceptance ID is returned
+	price := 100.0
+	sender.onSend = func(o sentOrder) {
+		algo.HandleOrderEvent(event(o.id, "EXECUTION", price, o.size))
+		price++
+	}
+	var final Progress
+	algo.OnProgress(func(p Progress) { final = p })
+
+	start := time.Now()
+	if err := algo.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("Expected the slices to be spread over time, took %v", elapsed)
+	}
+
+	orders := sender.sent()
+	if len(orders) != 3 {
+		t.Fatalf("Expected 3 child orders, got %+v", orders)
+	}
+	for _, o := range orders {
+		if !almostEqual(o.size, 0.1) {
+			t.Errorf("Expected slices of 0.1, got %+v", o)
+		}
+	}
+	if !final.Done || !almostEqual(final.Filled, 0.3) || !almostEqual(final.AveragePrice, 101) || final.ChildOrders != 3 {
+		t.Errorf("Unexpected final progress %+v", final)
+	}
+}
+
+func TestTWAP_Incomplete(t *testing.T) {
+	sender := &fakeSender{}
+	order := Order{ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideSELL, Size: 0.2, LimitPrice: 100}
+	algo := NewTWAP(sender, order, 40*time.Millisecond, 2)
+	sender.algo = algo
+
+	err := algo.Run(context.Background())
+	if !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete, got %v", err)
+	}
+	if got := sender.canceled(); len(got) != 2 {
+		t.Errorf("Expected the open child orders to be canceled, got %v", got)
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	sender := &fakeSender{}
+	order := Order{
+		ProductCode:    "BTC_JPY",
+		Side:           http.NewOrderRequestSideSELL,
+		Size:           1,
+		ChildOrderType: http.NewOrderRequestChildOrderTypeMARKET,
+	}
+	algo := NewVWAP(sender, order, []float64{0.5, 0, 0.25, 0.25}, 10*time.Millisecond)
+	sender.algo = algo
+	sender.onSend = func(o sentOrder) {
+		algo.HandleOrderEvent(event(o.id, "EXECUTION", 100, o.size))
+	}
+
+	if err := algo.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var sizes []float64
+	for _, o := range sender.sent() {
+		sizes = append(sizes, o.size)
+	}
+	if len(sizes) != 3 || !almostEqual(sizes[0], 0.5) || !almostEqual(sizes[1], 0.25) || !almostEqual(sizes[2], 0.25) {
+		t.Errorf("Expected slices following the profile, got %v", sizes)
+	}
+}
+
+func TestIceberg(t *testing.T) {
+	sender := &fakeSender{}
+	order := Order{ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideBUY, Size: 2.5, LimitPrice: 100}
+	algo := NewIceberg(sender, order, 1)
+	sender.algo = algo
+	sender.onSend = func(o sentOrder) {
+		// Filled in two parts, after the order was registered
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			algo.HandleOrderEvent(event(o.id, "EXECUTION", o.price, o.size/2))
+			algo.HandleOrderEvent(event(o.id, "EXECUTION", o.price, o.size/2))
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := algo.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	orders := sender.sent()
+	want := []float64{1, 1, 0.5}
+	if len(orders) != len(want) {
+		t.Fatalf("Expected %d child orders, got %+v", len(want), orders)
+	}
+	for i, o := range orders {
+		if !almostEqual(o.size, want[i]) || o.price != 100 || o.working != 0 {
+			t.Errorf("Order %d = %+v, want size %v at 100 with nothing else open", i, o, want[i])
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	sender := &fakeSender{}
+	quote := &fakeQuote{bid: 100, ask: 102}
+	order := Order{ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideBUY, Size: 1, LimitPrice: 101.5}
+	algo := NewIceberg(sender, order, 1, WithQuote(quote), WithRepriceInterval(5*time.Millisecond))
+	sender.algo = algo
+	sender.onCancel = func(id string) {
+		go algo.HandleOrderEvent(event(id, "CANCEL", 0, 0))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- algo.Run(ctx) }()
+
+	waitOrders := func(n int) []sentOrder {
+		t.Helper()
+		for {
+			if orders := sender.sent(); len(orders) >= n {
+				return orders
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("Timed out waiting for %d child orders", n)
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	first := waitOrders(1)[0]
+	if first.price != 100 {
+		t.Fatalf("Expected the first order at the best bid, got %+v", first)
+	}
+	// Part of the order fills before the market moves away
+	algo.HandleOrderEvent(event(first.id, "EXECUTION", 100, 0.4))
+
+	// The bid moves above the limit price; the replacement is capped by it
+	quote.set(105, 106)
+	second := waitOrders(2)[1]
+	if second.price != 101.5 || !almostEqual(second.size, 0.6) {
+		t.Errorf("Expected the remaining 0.6 replaced at the limit 101.5, got %+v", second)
+	}
+	if got := sender.canceled(); len(got) == 0 || got[0] != first.id {
+		t.Errorf("Expected %s to be canceled first, got %v", first.id, got)
+	}
+
+	algo.HandleOrderEvent(event(second.id, "EXECUTION", 101.5, 0.6))
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	p := algo.Progress()
+	if !almostEqual(p.Filled, 1) || !almostEqual(p.AveragePrice, 0.4*100+0.6*101.5) || len(sender.sent()) != 2 {
+		t.Errorf("Unexpected progress %+v", p)
+	}
+}
+
+func TestRun_Validation(t *testing.T) {
+	tests := []struct {
+		name  string
+		order Order
+	}{
+		{"no size", Order{ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideBUY, LimitPrice: 100}},
+		{"no side", Order{ProductCode: "BTC_JPY", Size: 1, LimitPrice: 100}},
+		{"limit without price", Order{ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideBUY, Size: 1}},
+		{"market guard without quote", Order{
+			ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideBUY, Size: 1, LimitPrice: 100,
+			ChildOrderType: http.NewOrderRequestChildOrderTypeMARKET,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewIceberg(&fakeSender{}, tt.order, 1).Run(context.Background()); err == nil {
+				t.Error("Expected a validation error")
+			}
+		})
+	}
+}
+
+func TestOrderFailures(t *testing.T) {
+	sender := &fakeSender{}
+	order := Order{ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideBUY, Size: 1, LimitPrice: 100}
+	algo := NewIceberg(sender, order, 1, WithMaxFailures(2))
+	sender.algo = algo
+	sender.onSend = func(o sentOrder) {
+		algo.HandleOrderEvent(event(o.id, "ORDER_FAILED", 0, 0))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := algo.Run(ctx); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected Run to stop after failed child orders, got %v", err)
+	}
+	if got := len(sender.sent()); got != 2 {
+		t.Errorf("Expected 2 attempts, got %d", got)
+	}
+}
+
+func TestGateClosed(t *testing.T) {
+	// The gate stays closed for more sends than the failures allowed
+	sender := &fakeSender{refuse: 5}
+	order := Order{
+		ProductCode:    "BTC_JPY",
+		Side:           http.NewOrderRequestSideBUY,
+		Size:           0.3,
+		ChildOrderType: http.NewOrderRequestChildOrderTypeMARKET,
+	}
+	algo := NewTWAP(sender, order, 150*time.Millisecond, 3, WithRetryInterval(10*time.Millisecond))
+	sender.algo = algo
+	sender.onSend = func(o sentOrder) {
+		algo.HandleOrderEvent(event(o.id, "EXECUTION", 100, o.size))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := algo.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if p := algo.Progress(); !almostEqual(p.Filled, 0.3) {
+		t.Errorf("Expected the order to be filled once the gate opened, got %+v", p)
+	}
+}
+
+func TestAmbiguousSend(t *testing.T) {
+	// The first send times out although the order was accepted and filled
+	sender := &fakeSender{ambiguous: 1}
+	order := Order{ProductCode: "BTC_JPY", Side: http.NewOrderRequestSideBUY, Size: 1, LimitPrice: 100}
+	algo := NewIceberg(sender, order, 0.5, WithRetryInterval(10*time.Millisecond))
+	sender.algo = algo
+	sender.onSend = func(o sentOrder) {
+		algo.HandleOrderEvent(event(o.id, "EXECUTION", 100, o.size))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := algo.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var total float64
+	for _, o := range sender.sent() {
+		total += o.size
+	}
+	if got := len(sender.sent()); got != 2 || !almostEqual(total, 1) {
+		t.Errorf("Expected 2 child orders for 1, got %d for %v", got, total)
+	}
+	if p := algo.Progress(); !almostEqual(p.Filled, 1) || p.ChildOrders != 2 {
+		t.Errorf("Expected the fills of the reconciled order to count, got %+v", p)
+	}
+}
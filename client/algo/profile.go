@@ -0,0 +1,94 @@
+package algo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// executionsPageSize is the largest page of public executions
+const executionsPageSize = 500
+
+// VolumeProfile returns the share of volume traded in each of n buckets,
+// the first starting at the time of day of start, summed over every day of
+// the executions. The profile is uniform when no execution falls into the
+// buckets. Times of day are taken in the location of start.
+func VolumeProfile(executions []http.MarketExecution, start time.Time, bucket time.Duration, n int) []float64 {
+	profile := make([]float64, n)
+	if n <= 0 || bucket <= 0 {
+		return profile
+	}
+	origin := timeOfDay(start)
+	span := bucket * time.Duration(n)
+
+	var total float64
+	for _, e := range executions {
+		if e.ExecDate == nil || e.Size == nil {
+			continue
+		}
+		offset := timeOfDay(e.ExecDate.In(start.Location())) - origin
+		if offset < 0 {
+			offset += 24 * time.Hour
+		}
+		if offset >= span {
+			continue
+		}
+		size := float64(*e.Size)
+		profile[offset/bucket] += size
+		total += size
+	}
+
+	for i := range profile {
+		if total > 0 {
+			profile[i] /= total
+		} else {
+			profile[i] = 1 / float64(n)
+		}
+	}
+	return profile
+}
+
+// timeOfDay returns the time elapsed since midnight
+func timeOfDay(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+}
+
+// LoadExecutions pages back through the public executions of the product
+// until since, or until maxPages pages were read, newest first
+func LoadExecutions(ctx context.Context, ac *http.AuthenticatedClient, productCode string, since time.Time, maxPages int) ([]http.MarketExecution, error) {
+	var executions []http.MarketExecution
+	count := executionsPageSize
+	params := &http.GetV1GetexecutionsParams{ProductCode: productCode, Count: &count}
+
+	for page := 0; page < maxPages; page++ {
+		resp, err := ac.Client().GetV1GetexecutionsWithResponse(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get executions: %w", err)
+		}
+		if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+			return nil, fmt.Errorf("failed to get executions: %w", err)
+		}
+		if resp.JSON200 == nil || len(*resp.JSON200) == 0 {
+			break
+		}
+
+		batch := *resp.JSON200
+		for _, e := range batch {
+			if e.ExecDate != nil && e.ExecDate.Before(since) {
+				return executions, nil
+			}
+			executions = append(executions, e)
+		}
+		last := batch[len(batch)-1]
+		if last.Id == nil {
+			break
+		}
+		before := *last.Id
+		params.Before = &before
+	}
+	return executions, nil
+}
@@ -0,0 +1,77 @@
+package algo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+func execution(id int, t time.Time, size float32) bfhttp.MarketExecution {
+	return bfhttp.MarketExecution{Id: &id, ExecDate: &t, Size: &size}
+}
+
+func TestVolumeProfile(t *testing.T) {
+	start := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	day := start.AddDate(0, 0, -1)
+	executions := []bfhttp.MarketExecution{
+		execution(1, day.Add(5*time.Minute), 1),
+		execution(2, day.Add(20*time.Minute), 2),
+		execution(3, day.AddDate(0, 0, -1).Add(25*time.Minute), 1),
+		execution(4, day.Add(-time.Minute), 10), // before the window
+		execution(5, day.Add(time.Hour), 10),    // after the window
+		{Id: new(int), ExecDate: &day},          // no size
+	}
+
+	got := VolumeProfile(executions, start, 15*time.Minute, 2)
+	if len(got) != 2 || !almostEqual(got[0], 0.25) || !almostEqual(got[1], 0.75) {
+		t.Errorf("VolumeProfile() = %v, want [0.25 0.75]", got)
+	}
+
+	got = VolumeProfile(nil, start, 15*time.Minute, 4)
+	for _, share := range got {
+		if share != 0.25 {
+			t.Errorf("Expected a uniform profile without volume, got %v", got)
+			break
+		}
+	}
+}
+
+func TestLoadExecutions(t *testing.T) {
+	now := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	var befores []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before := r.URL.Query().Get("before")
+		befores = append(befores, before)
+		var page []bfhttp.MarketExecution
+		switch before {
+		case "":
+			page = []bfhttp.MarketExecution{execution(30, now, 1), execution(29, now.Add(-time.Minute), 1)}
+		case "29":
+			page = []bfhttp.MarketExecution{execution(28, now.Add(-2*time.Minute), 1), execution(27, now.Add(-time.Hour), 1)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	ac, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{}, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executions, err := LoadExecutions(context.Background(), ac, "BTC_JPY", now.Add(-10*time.Minute), 5)
+	if err != nil {
+		t.Fatalf("LoadExecutions() error = %v", err)
+	}
+	if len(executions) != 3 || *executions[2].Id != 28 {
+		t.Errorf("Expected executions 30 to 28, got %d", len(executions))
+	}
+	if len(befores) != 2 || befores[1] != "29" {
+		t.Errorf("Expected to page before the last ID, got %q", befores)
+	}
+}
@@ -0,0 +1,212 @@
+package analytics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/orderbook"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// Features is a snapshot of the microstructure features of a product
+type Features struct {
+	ProductCode    string
+	VWAP           float64
+	Volume         float64 // traded size within the window
+	TradeImbalance float64
+	BookImbalance  float64
+	Microprice     float64
+	Spread         SpreadSummary
+	Volatility     float64
+	Time           time.Time
+}
+
+// LargeTrade is fired for a trade much larger than the recent mean size
+type LargeTrade struct {
+	ProductCode string
+	Execution   websocket.Execution
+	MeanSize    float64
+}
+
+// Analyzer maintains the features of a product from its executions and
+// order book, and streams them to strategies
+type Analyzer struct {
+	productCode   string
+	window        time.Duration
+	depth         int
+	largeMultiple float64
+	largeMinSize  float64
+
+	mu                sync.Mutex
+	vwap              *RollingVWAP
+	tradeImbalance    *RollingTradeImbalance
+	spread            *RollingSpread
+	volatility        *RollingVolatility
+	largeTrades       *LargeTradeDetector
+	features          Features
+	updateHandler     func(Features)
+	largeTradeHandler func(LargeTrade)
+}
+
+// Option configures an Analyzer
+type Option func(*Analyzer)
+
+// WithWindow sets the time window of the rolling features, one minute by default
+func WithWindow(d time.Duration) Option {
+	return func(a *Analyzer) {
+		a.window = d
+	}
+}
+
+// WithDepth sets the number of levels per side used for the book
+// imbalance, 10 by default
+func WithDepth(n int) Option {
+	return func(a *Analyzer) {
+		a.depth = n
+	}
+}
+
+// WithLargeTrade flags trades of at least multiple times the mean size
+// within the window and at least minSize, 10 times and any size by default
+func WithLargeTrade(multiple, minSize float64) Option {
+	return func(a *Analyzer) {
+		a.largeMultiple = multiple
+		a.largeMinSize = minSize
+	}
+}
+
+// NewAnalyzer creates a new analyzer for the product
+func NewAnalyzer(productCode string, opts ...Option) *Analyzer {
+	a := &Analyzer{
+		productCode:   productCode,
+		window:        time.Minute,
+		depth:         10,
+		largeMultiple: 10,
+		features:      Features{ProductCode: productCode},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.vwap = NewRollingVWAP(a.window)
+	a.tradeImbalance = NewRollingTradeImbalance(a.window)
+	a.spread = NewRollingSpread(a.window)
+	a.volatility = NewRollingVolatility(a.window)
+	a.largeTrades = NewLargeTradeDetector(a.window, a.largeMultiple, a.largeMinSize)
+	return a
+}
+
+// OnUpdate sets a callback to receive the features after every execution
+// batch and book update
+func (a *Analyzer) OnUpdate(handler func(Features)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.updateHandler = handler
+}
+
+// OnLargeTrade sets a callback to receive large trades
+func (a *Analyzer) OnLargeTrade(handler func(LargeTrade)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.largeTradeHandler = handler
+}
+
+// Attach feeds the analyzer from the executions of the client and, if book
+// is not nil, from the book after each of its updates. Other callbacks of
+// the book are kept. The returned function detaches the analyzer.
+func (a *Analyzer) Attach(c *websocket.Client, book *orderbook.Book) (detach func()) {
+	listener := c.OnExecutions(a.HandleExecutions, websocket.ForProducts(a.productCode))
+	var bookListener *orderbook.Listener
+	if book != nil {
+		bookListener = book.OnUpdate(func() { a.HandleBook(book) })
+	}
+	return func() {
+		listener.Remove()
+		bookListener.Remove()
+	}
+}
+
+// HandleExecutions updates the trade features from realtime executions.
+// Executions for other products are ignored.
+func (a *Analyzer) HandleExecutions(m websocket.ExecutionsMessage) {
+	if m.ProductCode != a.productCode && m.ProductCode != "" {
+		return
+	}
+
+	a.mu.Lock()
+	var large []LargeTrade
+	for _, e := range m.Executions {
+		t := execTime(e)
+		a.vwap.Add(t, e.Price, e.Size)
+		a.tradeImbalance.Add(t, e.Side, e.Size)
+		a.volatility.Add(t, e.Price)
+		if ok, mean := a.largeTrades.Add(t, e.Size); ok {
+			large = append(large, LargeTrade{ProductCode: a.productCode, Execution: e, MeanSize: mean})
+		}
+		a.features.Time = t
+	}
+	a.features.VWAP = a.vwap.Value()
+	a.features.Volume = a.vwap.Volume()
+	a.features.TradeImbalance = a.tradeImbalance.Value()
+	a.features.Volatility = a.volatility.Value()
+	features := a.features
+	updateHandler := a.updateHandler
+	largeTradeHandler := a.largeTradeHandler
+	a.mu.Unlock()
+
+	if largeTradeHandler != nil {
+		for _, l := range large {
+			largeTradeHandler(l)
+		}
+	}
+	if updateHandler != nil {
+		updateHandler(features)
+	}
+}
+
+// HandleBook updates the book features from the levels of a book within the
+// depth. Unsynced books are ignored.
+func (a *Analyzer) HandleBook(book *orderbook.Book) {
+	if !book.Synced() {
+		return
+	}
+	a.HandleLevels(book.Bids(a.depth), book.Asks(a.depth), time.Now())
+}
+
+// HandleLevels updates the book features from levels ordered from the best
+// price
+func (a *Analyzer) HandleLevels(bids, asks []websocket.PriceLevel, t time.Time) {
+	if len(bids) == 0 || len(asks) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	a.spread.Add(t, bids[0].Price, asks[0].Price)
+	a.features.BookImbalance = BookImbalance(bids, asks, a.depth)
+	a.features.Microprice = Microprice(bids[0], asks[0])
+	a.features.Spread = a.spread.Summary()
+	a.features.Time = t
+	features := a.features
+	updateHandler := a.updateHandler
+	a.mu.Unlock()
+
+	if updateHandler != nil {
+		updateHandler(features)
+	}
+}
+
+// Features returns the latest features
+func (a *Analyzer) Features() Features {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.features
+}
+
+// execTime returns the execution time, or the current time if it cannot
+// be parsed
+func execTime(e websocket.Execution) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, e.ExecDate)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
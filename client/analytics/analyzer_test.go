@@ -0,0 +1,141 @@
+package analytics
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/orderbook"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analyzer := NewAnalyzer("BTC_JPY", WithWindow(time.Minute), WithDepth(1), WithLargeTrade(3, 0))
+	var updates []Features
+	analyzer.OnUpdate(func(f Features) { updates = append(updates, f) })
+	var large []LargeTrade
+	analyzer.OnLargeTrade(func(l LargeTrade) { large = append(large, l) })
+
+	analyzer.HandleExecutions(websocket.ExecutionsMessage{
+		ProductCode: "BTC_JPY",
+		Executions: []websocket.Execution{
+			{ID: 1, Side: "BUY", Price: 100, Size: 1, ExecDate: "2024-01-01T00:00:00.1234567Z"},
+			{ID: 2, Side: "SELL", Price: 100, Size: 1, ExecDate: "2024-01-01T00:00:01Z"},
+			{ID: 3, Side: "BUY", Price: 104, Size: 6, ExecDate: "2024-01-01T00:00:02Z"},
+		},
+	})
+	analyzer.HandleExecutions(websocket.ExecutionsMessage{
+		ProductCode: "ETH_JPY",
+		Executions:  []websocket.Execution{{ID: 4, Side: "SELL", Price: 1, Size: 100}},
+	})
+
+	book := orderbook.NewBook("BTC_JPY")
+	book.HandleBoardSnapshot(websocket.BoardSnapshotMessage{ProductCode: "BTC_JPY", Data: websocket.BoardData{
+		MidPrice: 100,
+		Bids:     []websocket.PriceLevel{{Price: 99, Size: 3}, {Price: 98, Size: 10}},
+		Asks:     []websocket.PriceLevel{{Price: 101, Size: 1}},
+	}})
+	analyzer.HandleBook(book)
+
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 updates, got %d", len(updates))
+	}
+	f := analyzer.Features()
+	if !almostEqual(f.VWAP, 103) || !almostEqual(f.Volume, 8) {
+		t.Errorf("Unexpected VWAP %v and volume %v", f.VWAP, f.Volume)
+	}
+	if !almostEqual(f.TradeImbalance, 0.75) {
+		t.Errorf("TradeImbalance = %v, want 0.75", f.TradeImbalance)
+	}
+	if !almostEqual(f.BookImbalance, 0.5) || !almostEqual(f.Microprice, 100.5) {
+		t.Errorf("Unexpected book features %+v", f)
+	}
+	if f.Spread.Last != 2 || f.Volatility <= 0 {
+		t.Errorf("Unexpected spread %+v and volatility %v", f.Spread, f.Volatility)
+	}
+	if len(large) != 1 || large[0].Execution.ID != 3 || !almostEqual(large[0].MeanSize, 1) {
+		t.Errorf("Unexpected large trades %+v", large)
+	}
+}
+
+func TestAnalyzer_Attach(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := websocket.NewClient(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	// The analyzer is attached before the book and still sees it updated,
+	// without replacing the callback of the application
+	book := orderbook.NewBook("BTC_JPY")
+	var appUpdates atomic.Int32
+	book.OnUpdate(func() { appUpdates.Add(1) })
+	analyzer := NewAnalyzer("BTC_JPY", WithDepth(1))
+	detach := analyzer.Attach(client, book)
+	defer book.Attach(client)()
+
+	updates := make(chan Features, 10)
+	analyzer.OnUpdate(func(f Features) { updates <- f })
+
+	for _, channel := range []string{websocket.BoardSnapshotChannel("BTC_JPY"), websocket.BoardChannel("BTC_JPY")} {
+		if err := client.Subscribe(ctx, channel); err != nil {
+			t.Fatalf("Subscribe() error = %v", err)
+		}
+		if err := srv.WaitSubscribed(ctx, channel); err != nil {
+			t.Fatalf("WaitSubscribed() error = %v", err)
+		}
+	}
+
+	expect := func(microprice float64) {
+		t.Helper()
+		select {
+		case f := <-updates:
+			if !almostEqual(f.Microprice, microprice) {
+				t.Errorf("Microprice = %v, want %v", f.Microprice, microprice)
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for an update")
+		}
+	}
+
+	if _, err := srv.Publish(websocket.BoardSnapshotChannel("BTC_JPY"), websocket.BoardData{
+		MidPrice: 100,
+		Bids:     []websocket.PriceLevel{{Price: 99, Size: 3}},
+		Asks:     []websocket.PriceLevel{{Price: 101, Size: 1}},
+	}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	expect(100.5)
+
+	if _, err := srv.Publish(websocket.BoardChannel("BTC_JPY"), websocket.BoardData{
+		MidPrice: 100,
+		Asks:     []websocket.PriceLevel{{Price: 101, Size: 3}},
+	}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	expect(100)
+
+	detach()
+	if _, err := srv.Publish(websocket.BoardChannel("BTC_JPY"), websocket.BoardData{
+		MidPrice: 100,
+		Bids:     []websocket.PriceLevel{{Price: 99, Size: 1}},
+	}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case f := <-updates:
+		t.Errorf("Unexpected update after detach %+v", f)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := appUpdates.Load(); got != 3 {
+		t.Errorf("Expected the callback of the application to see 3 updates, got %d", got)
+	}
+}
@@ -0,0 +1,284 @@
+// Package analytics computes market microstructure features from realtime
+// executions and order books: rolling VWAP, trade imbalance, order book
+// imbalance, microprice, spread statistics, realized volatility and large
+// trade detection.
+package analytics
+
+import (
+	"math"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// window holds samples in time order and evicts those older than the span.
+// Samples are expected in non-decreasing time; an older sample is kept
+// until a newer one pushes it out.
+type window[T any] struct {
+	span    time.Duration
+	samples []sample[T]
+	head    int
+}
+
+type sample[T any] struct {
+	t time.Time
+	v T
+}
+
+// add appends a sample and returns the samples evicted by it
+func (w *window[T]) add(t time.Time, v T) []sample[T] {
+	w.samples = append(w.samples, sample[T]{t: t, v: v})
+	start := w.head
+	cutoff := t.Add(-w.span)
+	for w.head < len(w.samples) && w.samples[w.head].t.Before(cutoff) {
+		w.head++
+	}
+	evicted := w.samples[start:w.head]
+	// Compact once the evicted prefix dominates, keeping adds amortized O(1)
+	if w.head > len(w.samples)/2 {
+		evicted = append([]sample[T](nil), evicted...)
+		w.samples = append(w.samples[:0], w.samples[w.head:]...)
+		w.head = 0
+	}
+	return evicted
+}
+
+// live returns the samples in the window
+func (w *window[T]) live() []sample[T] {
+	return w.samples[w.head:]
+}
+
+// RollingVWAP is the volume-weighted average price of the trades within a
+// time window
+type RollingVWAP struct {
+	w        window[[2]float64] // price, size
+	notional float64
+	volume   float64
+}
+
+// NewRollingVWAP creates a VWAP over the window
+func NewRollingVWAP(span time.Duration) *RollingVWAP {
+	return &RollingVWAP{w: window[[2]float64]{span: span}}
+}
+
+// Add records a trade
+func (r *RollingVWAP) Add(t time.Time, price, size float64) {
+	r.notional += price * size
+	r.volume += size
+	for _, s := range r.w.add(t, [2]float64{price, size}) {
+		r.notional -= s.v[0] * s.v[1]
+		r.volume -= s.v[1]
+	}
+}
+
+// Value returns the VWAP, zero without trades
+func (r *RollingVWAP) Value() float64 {
+	if r.volume <= 0 {
+		return 0
+	}
+	return r.notional / r.volume
+}
+
+// Volume returns the traded size within the window
+func (r *RollingVWAP) Volume() float64 {
+	return max(r.volume, 0)
+}
+
+// RollingTradeImbalance is (buy volume - sell volume) / total volume of the
+// trades within a time window, from -1 (all sells) to 1 (all buys). The side
+// is the taker side reported by the executions channel.
+type RollingTradeImbalance struct {
+	w    window[float64] // signed size
+	buy  float64
+	sell float64
+}
+
+// NewRollingTradeImbalance creates a trade imbalance over the window
+func NewRollingTradeImbalance(span time.Duration) *RollingTradeImbalance {
+	return &RollingTradeImbalance{w: window[float64]{span: span}}
+}
+
+// Add records a trade. Trades without a side, such as itayose executions,
+// are ignored.
+func (r *RollingTradeImbalance) Add(t time.Time, side string, size float64) {
+	var signed float64
+	switch side {
+	case "BUY":
+		signed = size
+		r.buy += size
+	case "SELL":
+		signed = -size
+		r.sell += size
+	default:
+		return
+	}
+	for _, s := range r.w.add(t, signed) {
+		if s.v > 0 {
+			r.buy -= s.v
+		} else {
+			r.sell += s.v
+		}
+	}
+}
+
+// Value returns the imbalance, zero without trades
+func (r *RollingTradeImbalance) Value() float64 {
+	total := r.buy + r.sell
+	if total <= 0 {
+		return 0
+	}
+	return (r.buy - r.sell) / total
+}
+
+// SpreadSummary describes the spreads observed within a time window
+type SpreadSummary struct {
+	Last   float64
+	Mean   float64
+	StdDev float64
+	Min    float64
+	Max    float64
+	Count  int
+}
+
+// RollingSpread collects bid/ask spreads within a time window
+type RollingSpread struct {
+	w     window[float64]
+	sum   float64
+	sumSq float64
+}
+
+// NewRollingSpread creates spread statistics over the window
+func NewRollingSpread(span time.Duration) *RollingSpread {
+	return &RollingSpread{w: window[float64]{span: span}}
+}
+
+// Add records the best bid and ask
+func (r *RollingSpread) Add(t time.Time, bid, ask float64) {
+	spread := ask - bid
+	r.sum += spread
+	r.sumSq += spread * spread
+	for _, s := range r.w.add(t, spread) {
+		r.sum -= s.v
+		r.sumSq -= s.v * s.v
+	}
+}
+
+// Summary returns the statistics of the spreads in the window
+func (r *RollingSpread) Summary() SpreadSummary {
+	live := r.w.live()
+	if len(live) == 0 {
+		return SpreadSummary{}
+	}
+	n := float64(len(live))
+	mean := r.sum / n
+	summary := SpreadSummary{
+		Last:   live[len(live)-1].v,
+		Mean:   mean,
+		StdDev: math.Sqrt(max(r.sumSq/n-mean*mean, 0)),
+		Min:    live[0].v,
+		Max:    live[0].v,
+		Count:  len(live),
+	}
+	for _, s := range live[1:] {
+		summary.Min = min(summary.Min, s.v)
+		summary.Max = max(summary.Max, s.v)
+	}
+	return summary
+}
+
+// RollingVolatility is the realized volatility of trade prices within a
+// time window: the square root of the sum of squared log returns between
+// consecutive trades. It is not annualized.
+type RollingVolatility struct {
+	w         window[float64] // squared log return
+	sumSq     float64
+	lastPrice float64
+}
+
+// NewRollingVolatility creates a realized volatility over the window
+func NewRollingVolatility(span time.Duration) *RollingVolatility {
+	return &RollingVolatility{w: window[float64]{span: span}}
+}
+
+// Add records a trade price
+func (r *RollingVolatility) Add(t time.Time, price float64) {
+	if price <= 0 {
+		return
+	}
+	last := r.lastPrice
+	r.lastPrice = price
+	if last == 0 {
+		return
+	}
+	ret := math.Log(price / last)
+	r.sumSq += ret * ret
+	for _, s := range r.w.add(t, ret*ret) {
+		r.sumSq -= s.v
+	}
+}
+
+// Value returns the realized volatility
+func (r *RollingVolatility) Value() float64 {
+	return math.Sqrt(max(r.sumSq, 0))
+}
+
+// LargeTradeDetector flags trades much larger than the mean trade size
+// within a time window
+type LargeTradeDetector struct {
+	w        window[float64]
+	multiple float64
+	minSize  float64
+	sum      float64
+}
+
+// NewLargeTradeDetector creates a detector that flags trades of at least
+// multiple times the mean size of the window and at least minSize
+func NewLargeTradeDetector(span time.Duration, multiple, minSize float64) *LargeTradeDetector {
+	return &LargeTradeDetector{w: window[float64]{span: span}, multiple: multiple, minSize: minSize}
+}
+
+// Add records a trade and reports whether it is large compared to the
+// trades before it, along with their mean size
+func (d *LargeTradeDetector) Add(t time.Time, size float64) (large bool, meanSize float64) {
+	if n := len(d.w.live()); n > 0 {
+		meanSize = d.sum / float64(n)
+	}
+	large = size >= d.minSize && meanSize > 0 && size >= meanSize*d.multiple
+
+	d.sum += size
+	for _, s := range d.w.add(t, size) {
+		d.sum -= s.v
+	}
+	return large, meanSize
+}
+
+// BookImbalance is (bid size - ask size) / total size over the best depth
+// levels of each side, from -1 to 1. Levels must be ordered from the best
+// price, as returned by orderbook.Book. A depth of zero uses every level.
+func BookImbalance(bids, asks []websocket.PriceLevel, depth int) float64 {
+	bid, ask := depthSize(bids, depth), depthSize(asks, depth)
+	if bid+ask <= 0 {
+		return 0
+	}
+	return (bid - ask) / (bid + ask)
+}
+
+func depthSize(levels []websocket.PriceLevel, depth int) float64 {
+	if depth > 0 && len(levels) > depth {
+		levels = levels[:depth]
+	}
+	var size float64
+	for _, l := range levels {
+		size += l.Size
+	}
+	return size
+}
+
+// Microprice is the mid price weighted by the opposite side's size, which
+// leans toward the side more likely to be taken next
+func Microprice(bid, ask websocket.PriceLevel) float64 {
+	if bid.Size+ask.Size <= 0 {
+		return (bid.Price + ask.Price) / 2
+	}
+	return (bid.Price*ask.Size + ask.Price*bid.Size) / (bid.Size + ask.Size)
+}
@@ -0,0 +1,114 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestRollingVWAP(t *testing.T) {
+	vwap := NewRollingVWAP(time.Minute)
+	if vwap.Value() != 0 {
+		t.Error("Expected zero VWAP without trades")
+	}
+	vwap.Add(t0, 100, 1)
+	vwap.Add(t0.Add(30*time.Second), 110, 3)
+	if got := vwap.Value(); !almostEqual(got, 107.5) {
+		t.Errorf("Value() = %v, want 107.5", got)
+	}
+
+	// The first trade leaves the window
+	vwap.Add(t0.Add(70*time.Second), 120, 1)
+	if got := vwap.Value(); !almostEqual(got, 112.5) {
+		t.Errorf("Value() = %v, want 112.5", got)
+	}
+	if got := vwap.Volume(); !almostEqual(got, 4) {
+		t.Errorf("Volume() = %v, want 4", got)
+	}
+}
+
+func TestRollingTradeImbalance(t *testing.T) {
+	imbalance := NewRollingTradeImbalance(time.Minute)
+	imbalance.Add(t0, "BUY", 3)
+	imbalance.Add(t0.Add(time.Second), "SELL", 1)
+	imbalance.Add(t0.Add(2*time.Second), "", 10)
+	if got := imbalance.Value(); !almostEqual(got, 0.5) {
+		t.Errorf("Value() = %v, want 0.5", got)
+	}
+
+	imbalance.Add(t0.Add(61*time.Second), "SELL", 1)
+	if got := imbalance.Value(); !almostEqual(got, -1) {
+		t.Errorf("Value() = %v, want -1", got)
+	}
+}
+
+func TestRollingSpread(t *testing.T) {
+	spread := NewRollingSpread(time.Minute)
+	for i, s := range []float64{10, 20, 30} {
+		spread.Add(t0.Add(time.Duration(i)*time.Second), 100, 100+s)
+	}
+	want := SpreadSummary{Last: 30, Mean: 20, StdDev: math.Sqrt(200.0 / 3), Min: 10, Max: 30, Count: 3}
+	got := spread.Summary()
+	if got.Last != want.Last || !almostEqual(got.Mean, want.Mean) || !almostEqual(got.StdDev, want.StdDev) ||
+		got.Min != want.Min || got.Max != want.Max || got.Count != want.Count {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+
+	spread.Add(t0.Add(time.Minute+500*time.Millisecond), 100, 140)
+	if got := spread.Summary(); got.Min != 20 || got.Max != 40 || got.Count != 3 {
+		t.Errorf("Expected the first spread to leave the window, got %+v", got)
+	}
+}
+
+func TestRollingVolatility(t *testing.T) {
+	vol := NewRollingVolatility(time.Minute)
+	vol.Add(t0, 100)
+	vol.Add(t0.Add(time.Second), 110)
+	vol.Add(t0.Add(2*time.Second), 99)
+
+	r1, r2 := math.Log(110.0/100), math.Log(99.0/110)
+	if got, want := vol.Value(), math.Sqrt(r1*r1+r2*r2); !almostEqual(got, want) {
+		t.Errorf("Value() = %v, want %v", got, want)
+	}
+}
+
+func TestLargeTradeDetector(t *testing.T) {
+	d := NewLargeTradeDetector(time.Minute, 5, 1)
+	for i := range 4 {
+		if large, _ := d.Add(t0.Add(time.Duration(i)*time.Second), 0.1); large {
+			t.Fatalf("Trade %d flagged as large", i)
+		}
+	}
+	// Five times the mean but below the minimum size
+	if large, _ := d.Add(t0.Add(5*time.Second), 0.6); large {
+		t.Error("Expected a trade below the minimum size to pass")
+	}
+	large, mean := d.Add(t0.Add(6*time.Second), 2)
+	if !large || !almostEqual(mean, 1.0/5) {
+		t.Errorf("Add() = %v, %v, want true, 0.2", large, mean)
+	}
+}
+
+func TestBookImbalanceAndMicroprice(t *testing.T) {
+	bids := []websocket.PriceLevel{{Price: 99, Size: 3}, {Price: 98, Size: 5}}
+	asks := []websocket.PriceLevel{{Price: 101, Size: 1}, {Price: 102, Size: 1}}
+
+	if got := BookImbalance(bids, asks, 1); !almostEqual(got, 0.5) {
+		t.Errorf("BookImbalance(depth 1) = %v, want 0.5", got)
+	}
+	if got := BookImbalance(bids, asks, 0); !almostEqual(got, 0.6) {
+		t.Errorf("BookImbalance(all) = %v, want 0.6", got)
+	}
+	// More size on the bid pushes the microprice toward the ask
+	if got := Microprice(bids[0], asks[0]); !almostEqual(got, 100.5) {
+		t.Errorf("Microprice() = %v, want 100.5", got)
+	}
+}
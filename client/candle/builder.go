@@ -0,0 +1,204 @@
+// Package candle builds OHLCV bars from realtime executions.
+package candle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// Candle is an OHLCV bar covering [Start, Start+Interval)
+type Candle struct {
+	ProductCode string
+	Start       time.Time
+	Interval    time.Duration
+	Open        float64
+	High        float64
+	Low         float64
+	Close       float64
+	Volume      float64
+	BuyVolume   float64 // taker buys
+	SellVolume  float64 // taker sells
+	Trades      int
+}
+
+// End returns the end of the bar, exclusive
+func (c Candle) End() time.Time {
+	return c.Start.Add(c.Interval)
+}
+
+// Builder aggregates the executions of a product into bars aligned to the
+// interval in UTC. A bar is closed when the first execution of a later
+// interval arrives, or by Flush.
+type Builder struct {
+	productCode string
+	interval    time.Duration
+	fillGaps    bool
+
+	mu            sync.Mutex
+	current       Candle
+	hasCurrent    bool
+	lastClose     float64
+	watermark     time.Time // executions before it belong to emitted bars
+	closeHandler  func(Candle)
+	updateHandler func(Candle)
+}
+
+// Option configures a Builder
+type Option func(*Builder)
+
+// WithGapFill emits a flat, zero-volume bar at the previous close for every
+// interval without executions, so that indicators see one bar per interval
+func WithGapFill() Option {
+	return func(b *Builder) {
+		b.fillGaps = true
+	}
+}
+
+// NewBuilder creates a new builder of bars of the interval for the product
+func NewBuilder(productCode string, interval time.Duration, opts ...Option) *Builder {
+	b := &Builder{
+		productCode: productCode,
+		interval:    interval,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// OnClose sets a callback to receive closed bars in time order
+func (b *Builder) OnClose(handler func(Candle)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closeHandler = handler
+}
+
+// OnUpdate sets a callback to receive the open bar after every execution
+// batch
+func (b *Builder) OnUpdate(handler func(Candle)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateHandler = handler
+}
+
+// HandleExecutions adds realtime executions to the bars. Executions for
+// other products, and executions older than the open bar, are ignored.
+func (b *Builder) HandleExecutions(m websocket.ExecutionsMessage) {
+	if m.ProductCode != b.productCode && m.ProductCode != "" {
+		return
+	}
+
+	b.mu.Lock()
+	var closed []Candle
+	updated := false
+	for _, e := range m.Executions {
+		t, err := time.Parse(time.RFC3339Nano, e.ExecDate)
+		if err != nil {
+			t = time.Now()
+		}
+		closed = append(closed, b.advanceLocked(t)...)
+		if t.Before(b.watermark) {
+			continue
+		}
+		b.addLocked(t, e)
+		updated = true
+	}
+	current := b.current
+	closeHandler := b.closeHandler
+	updateHandler := b.updateHandler
+	b.mu.Unlock()
+
+	if closeHandler != nil {
+		for _, c := range closed {
+			closeHandler(c)
+		}
+	}
+	if updated && updateHandler != nil {
+		updateHandler(current)
+	}
+}
+
+// Flush closes the open bar if its interval ended before now, for example
+// when no execution arrived for a while
+func (b *Builder) Flush(now time.Time) {
+	b.mu.Lock()
+	closed := b.advanceLocked(now)
+	closeHandler := b.closeHandler
+	b.mu.Unlock()
+
+	if closeHandler != nil {
+		for _, c := range closed {
+			closeHandler(c)
+		}
+	}
+}
+
+// Current returns the open bar. It reports false before the first execution.
+func (b *Builder) Current() (Candle, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current, b.hasCurrent
+}
+
+// advanceLocked closes the open bar when t is past its end and, if
+// enabled, emits flat bars for the intervals without executions before t.
+// b.mu must be held.
+func (b *Builder) advanceLocked(t time.Time) []Candle {
+	var closed []Candle
+	if b.hasCurrent {
+		if t.Before(b.current.End()) {
+			return nil
+		}
+		closed = append(closed, b.current)
+		b.lastClose = b.current.Close
+		b.hasCurrent = false
+		b.watermark = b.current.End()
+	}
+	if !b.fillGaps || b.watermark.IsZero() {
+		return closed
+	}
+	for end := b.watermark.Add(b.interval); !t.Before(end); end = end.Add(b.interval) {
+		closed = append(closed, Candle{
+			ProductCode: b.productCode,
+			Start:       b.watermark,
+			Interval:    b.interval,
+			Open:        b.lastClose,
+			High:        b.lastClose,
+			Low:         b.lastClose,
+			Close:       b.lastClose,
+		})
+		b.watermark = end
+	}
+	return closed
+}
+
+// addLocked adds an execution to the open bar, opening one if needed.
+// b.mu must be held.
+func (b *Builder) addLocked(t time.Time, e websocket.Execution) {
+	if !b.hasCurrent {
+		b.current = Candle{
+			ProductCode: b.productCode,
+			Start:       t.Truncate(b.interval),
+			Interval:    b.interval,
+			Open:        e.Price,
+			High:        e.Price,
+			Low:         e.Price,
+		}
+		b.hasCurrent = true
+		b.watermark = b.current.Start
+	}
+	c := &b.current
+	c.High = max(c.High, e.Price)
+	c.Low = min(c.Low, e.Price)
+	c.Close = e.Price
+	c.Volume += e.Size
+	c.Trades++
+	switch e.Side {
+	case "BUY":
+		c.BuyVolume += e.Size
+	case "SELL":
+		c.SellVolume += e.Size
+	}
+}
@@ -0,0 +1,92 @@
+package candle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+func executions(execs ...websocket.Execution) websocket.ExecutionsMessage {
+	return websocket.ExecutionsMessage{ProductCode: "BTC_JPY", Executions: execs}
+}
+
+func TestBuilder(t *testing.T) {
+	builder := NewBuilder("BTC_JPY", time.Minute)
+	var closed []Candle
+	builder.OnClose(func(c Candle) { closed = append(closed, c) })
+	var updates int
+	builder.OnUpdate(func(Candle) { updates++ })
+
+	builder.HandleExecutions(executions(
+		websocket.Execution{Side: "BUY", Price: 100, Size: 1, ExecDate: "2024-01-01T00:00:10.1234567Z"},
+		websocket.Execution{Side: "SELL", Price: 95, Size: 2, ExecDate: "2024-01-01T00:00:20Z"},
+		websocket.Execution{Side: "BUY", Price: 105, Size: 0.5, ExecDate: "2024-01-01T00:00:59Z"},
+	))
+	builder.HandleExecutions(websocket.ExecutionsMessage{ProductCode: "ETH_JPY", Executions: []websocket.Execution{
+		{Price: 1, Size: 1, ExecDate: "2024-01-01T00:05:00Z"},
+	}})
+	if len(closed) != 0 {
+		t.Fatalf("Expected no closed bar yet, got %+v", closed)
+	}
+	current, ok := builder.Current()
+	if !ok || current.Trades != 3 {
+		t.Fatalf("Current() = %+v, %v", current, ok)
+	}
+
+	builder.HandleExecutions(executions(
+		websocket.Execution{Side: "SELL", Price: 101, Size: 1, ExecDate: "2024-01-01T00:01:00Z"},
+		// Late executions of a closed bar are ignored
+		websocket.Execution{Side: "SELL", Price: 1, Size: 1, ExecDate: "2024-01-01T00:00:30Z"},
+	))
+	want := Candle{
+		ProductCode: "BTC_JPY",
+		Start:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Interval:    time.Minute,
+		Open:        100,
+		High:        105,
+		Low:         95,
+		Close:       105,
+		Volume:      3.5,
+		BuyVolume:   1.5,
+		SellVolume:  2,
+		Trades:      3,
+	}
+	if len(closed) != 1 || closed[0] != want {
+		t.Fatalf("Closed bars = %+v, want %+v", closed, want)
+	}
+	if current, _ := builder.Current(); current.Low != 101 || current.Trades != 1 {
+		t.Errorf("Expected the late execution to be ignored, got %+v", current)
+	}
+	if updates != 2 {
+		t.Errorf("Expected 2 updates, got %d", updates)
+	}
+}
+
+func TestBuilder_GapFill(t *testing.T) {
+	builder := NewBuilder("BTC_JPY", time.Minute, WithGapFill())
+	var closed []Candle
+	builder.OnClose(func(c Candle) { closed = append(closed, c) })
+
+	builder.HandleExecutions(executions(websocket.Execution{Price: 100, Size: 1, ExecDate: "2024-01-01T00:00:10Z"}))
+	builder.HandleExecutions(executions(websocket.Execution{Price: 110, Size: 1, ExecDate: "2024-01-01T00:03:10Z"}))
+	if len(closed) != 3 {
+		t.Fatalf("Expected the bar and two flat bars, got %+v", closed)
+	}
+	for i, c := range closed[1:] {
+		wantStart := time.Date(2024, 1, 1, 0, i+1, 0, 0, time.UTC)
+		if !c.Start.Equal(wantStart) || c.Open != 100 || c.Close != 100 || c.Volume != 0 {
+			t.Errorf("Unexpected flat bar %+v", c)
+		}
+	}
+
+	// Flush closes the open bar and keeps filling without executions
+	builder.Flush(time.Date(2024, 1, 1, 0, 5, 30, 0, time.UTC))
+	if len(closed) != 5 || closed[3].Close != 110 || closed[4].Close != 110 || closed[4].Volume != 0 {
+		t.Fatalf("Unexpected bars after Flush %+v", closed[3:])
+	}
+	builder.Flush(time.Date(2024, 1, 1, 0, 6, 0, 0, time.UTC))
+	if len(closed) != 6 || !closed[5].Start.Equal(time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected bars after the second Flush %+v", closed[5:])
+	}
+}
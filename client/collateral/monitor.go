@@ -0,0 +1,396 @@
+// Package collateral watches Lightning FX collateral and keep rate.
+package collateral
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// Level is the severity derived from the keep rate
+type Level int
+
+const (
+	LevelNormal Level = iota
+	LevelWarning
+	LevelDanger
+	LevelLiquidation
+)
+
+// String returns the name of the level
+func (l Level) String() string {
+	switch l {
+	case LevelNormal:
+		return "NORMAL"
+	case LevelWarning:
+		return "WARNING"
+	case LevelDanger:
+		return "DANGER"
+	case LevelLiquidation:
+		return "LIQUIDATION"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// Thresholds are the keep rates at or below which each level is entered.
+// bitFlyer issues a margin call below 80% and liquidates below 50%.
+type Thresholds struct {
+	Warning     float64
+	Danger      float64
+	Liquidation float64
+}
+
+// DefaultThresholds is used when no thresholds are configured
+var DefaultThresholds = Thresholds{
+	Warning:     1.0,
+	Danger:      0.8,
+	Liquidation: 0.6,
+}
+
+// level returns the level for the keep rate
+func (t Thresholds) level(keepRate float64) Level {
+	switch {
+	case keepRate <= t.Liquidation:
+		return LevelLiquidation
+	case keepRate <= t.Danger:
+		return LevelDanger
+	case keepRate <= t.Warning:
+		return LevelWarning
+	default:
+		return LevelNormal
+	}
+}
+
+// Snapshot is the collateral state at a point in time
+type Snapshot struct {
+	Collateral        float64
+	OpenPositionPnl   float64
+	RequireCollateral float64
+	KeepRate          float64
+	NetPosition       float64 // positive for long, negative for short
+	Estimated         bool    // true when derived from a realtime price between polls
+	Time              time.Time
+}
+
+// Event is fired when the level changes
+type Event struct {
+	Previous Level
+	Current  Level
+	Snapshot Snapshot
+}
+
+// position is the subset of a Position used for estimation
+type position struct {
+	signedSize float64
+	price      float64
+	pnl        float64
+}
+
+// Monitor polls collateral on a schedule and estimates the keep rate from
+// realtime prices between polls
+type Monitor struct {
+	api         *http.ClientWithResponses
+	productCode string
+	interval    time.Duration
+	thresholds  Thresholds
+
+	trader         *trading.Client
+	reduceAt       Level
+	reduceFraction float64
+	minOrderSize   float64
+
+	mu            sync.Mutex
+	polled        Snapshot
+	positions     []position
+	current       Snapshot
+	level         Level
+	hasPolled     bool
+	updateHandler func(Snapshot)
+	levelHandler  func(Event)
+	errorHandler  func(error)
+}
+
+// Option configures a Monitor
+type Option func(*Monitor)
+
+// WithInterval sets the polling interval
+func WithInterval(d time.Duration) Option {
+	return func(m *Monitor) {
+		m.interval = d
+	}
+}
+
+// WithThresholds sets the keep rate thresholds
+func WithThresholds(t Thresholds) Option {
+	return func(m *Monitor) {
+		m.thresholds = t
+	}
+}
+
+// WithProductCode sets the product whose positions are used for estimation
+func WithProductCode(productCode string) Option {
+	return func(m *Monitor) {
+		m.productCode = productCode
+	}
+}
+
+// WithAutoReduce closes fraction of the net position with a market order
+// through trader whenever the level escalates to at or above level. The
+// fraction must be above 0 and at most 1.
+func WithAutoReduce(trader *trading.Client, level Level, fraction float64) Option {
+	return func(m *Monitor) {
+		m.trader = trader
+		m.reduceAt = level
+		m.reduceFraction = fraction
+	}
+}
+
+// WithMinOrderSize sets the minimum order size of the product used by
+// auto-reduce, 0.01 by default as for FX_BTC_JPY. It must be positive.
+func WithMinOrderSize(size float64) Option {
+	return func(m *Monitor) {
+		m.minOrderSize = size
+	}
+}
+
+// NewMonitor creates a new collateral monitor
+func NewMonitor(ac *http.AuthenticatedClient, opts ...Option) (*Monitor, error) {
+	m := &Monitor{
+		api:          ac.Client(),
+		productCode:  "FX_BTC_JPY",
+		interval:     30 * time.Second,
+		thresholds:   DefaultThresholds,
+		minOrderSize: 0.01,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.trader != nil && (m.reduceFraction <= 0 || m.reduceFraction > 1) {
+		return nil, fmt.Errorf("invalid collateral monitor: auto-reduce fraction must be in (0, 1]")
+	}
+	if m.minOrderSize <= 0 {
+		return nil, fmt.Errorf("invalid collateral monitor: minimum order size must be positive")
+	}
+	return m, nil
+}
+
+// OnUpdate sets a callback to receive every polled or estimated snapshot
+func (m *Monitor) OnUpdate(handler func(Snapshot)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateHandler = handler
+}
+
+// OnLevelChange sets a callback to receive level transitions
+func (m *Monitor) OnLevelChange(handler func(Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.levelHandler = handler
+}
+
+// OnError sets a callback to receive polling and auto-reduce errors from Run
+func (m *Monitor) OnError(handler func(error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errorHandler = handler
+}
+
+// Current returns the latest snapshot and level
+func (m *Monitor) Current() (Snapshot, Level) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current, m.level
+}
+
+// Run polls until ctx is done
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Poll(ctx); err != nil {
+			m.mu.Lock()
+			errorHandler := m.errorHandler
+			m.mu.Unlock()
+			if errorHandler != nil {
+				errorHandler(err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches collateral and positions once
+func (m *Monitor) Poll(ctx context.Context) error {
+	collateralResp, err := m.api.GetV1MeGetcollateralWithResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get collateral: %w", err)
+	}
+	if err := http.CheckResponse(collateralResp.StatusCode(), collateralResp.Body); err != nil {
+		return fmt.Errorf("failed to get collateral: %w", err)
+	}
+	if collateralResp.JSON200 == nil {
+		return fmt.Errorf("failed to get collateral: empty response")
+	}
+
+	positionsResp, err := m.api.GetV1MeGetpositionsWithResponse(ctx, &http.GetV1MeGetpositionsParams{
+		ProductCode: m.productCode,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get positions: %w", err)
+	}
+	if err := http.CheckResponse(positionsResp.StatusCode(), positionsResp.Body); err != nil {
+		return fmt.Errorf("failed to get positions: %w", err)
+	}
+
+	var positions []position
+	if positionsResp.JSON200 != nil {
+		for _, p := range *positionsResp.JSON200 {
+			size := http.Decimal(p.Size)
+			if p.Side != nil && *p.Side == "SELL" {
+				size = -size
+			}
+			positions = append(positions, position{
+				signedSize: size,
+				price:      http.Decimal(p.Price),
+				pnl:        http.Decimal(p.Pnl),
+			})
+		}
+	}
+
+	c := collateralResp.JSON200
+	snapshot := Snapshot{
+		Collateral:        http.Decimal(c.Collateral),
+		OpenPositionPnl:   http.Decimal(c.OpenPositionPnl),
+		RequireCollateral: http.Decimal(c.RequireCollateral),
+		KeepRate:          http.Decimal(c.KeepRate),
+		NetPosition:       netPosition(positions),
+		Time:              time.Now(),
+	}
+
+	m.mu.Lock()
+	m.polled = snapshot
+	m.positions = positions
+	m.hasPolled = true
+	m.mu.Unlock()
+
+	return m.update(ctx, snapshot)
+}
+
+// HandleTicker re-estimates the keep rate from a realtime ticker.
+// Tickers for other products and tickers received before the first poll are ignored.
+func (m *Monitor) HandleTicker(ticker websocket.TickerMessage) {
+	if ticker.ProductCode != m.productCode || ticker.Ltp == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	if !m.hasPolled {
+		m.mu.Unlock()
+		return
+	}
+	snapshot := m.estimate(ticker.Ltp)
+	m.mu.Unlock()
+
+	// Auto-reduce errors from realtime updates are reported through OnError
+	if err := m.update(context.Background(), snapshot); err != nil {
+		m.mu.Lock()
+		errorHandler := m.errorHandler
+		m.mu.Unlock()
+		if errorHandler != nil {
+			errorHandler(err)
+		}
+	}
+}
+
+// estimate derives a snapshot for the given last traded price.
+// It replaces each position's polled pnl with the pnl at ltp.
+func (m *Monitor) estimate(ltp float64) Snapshot {
+	snapshot := m.polled
+	pnl := snapshot.OpenPositionPnl
+	for _, p := range m.positions {
+		pnl += p.signedSize*(ltp-p.price) - p.pnl
+	}
+	snapshot.OpenPositionPnl = pnl
+	if snapshot.RequireCollateral > 0 {
+		snapshot.KeepRate = (snapshot.Collateral + pnl) / snapshot.RequireCollateral
+	}
+	snapshot.Estimated = true
+	snapshot.Time = time.Now()
+	return snapshot
+}
+
+// update stores the snapshot, fires callbacks and triggers auto-reduce
+func (m *Monitor) update(ctx context.Context, snapshot Snapshot) error {
+	m.mu.Lock()
+	previous := m.level
+	// Without required collateral there is no open position to protect
+	current := LevelNormal
+	if snapshot.RequireCollateral > 0 {
+		current = m.thresholds.level(snapshot.KeepRate)
+	}
+	m.current = snapshot
+	m.level = current
+	updateHandler := m.updateHandler
+	levelHandler := m.levelHandler
+	m.mu.Unlock()
+
+	if updateHandler != nil {
+		updateHandler(snapshot)
+	}
+	if current == previous {
+		return nil
+	}
+	if levelHandler != nil {
+		levelHandler(Event{Previous: previous, Current: current, Snapshot: snapshot})
+	}
+	if current > previous && m.trader != nil && current >= m.reduceAt {
+		return m.reduce(ctx, snapshot.NetPosition)
+	}
+	return nil
+}
+
+// reduce sends a market order closing part of the net position. The size
+// is a multiple of the minimum order size, rounded up to the minimum unless
+// that would close the whole position.
+func (m *Monitor) reduce(ctx context.Context, net float64) error {
+	position := math.Abs(net)
+	steps := math.Floor(position*m.reduceFraction/m.minOrderSize + 1e-9)
+	size := math.Round(steps*m.minOrderSize*1e8) / 1e8
+	if size < m.minOrderSize {
+		if m.minOrderSize >= position {
+			return nil
+		}
+		size = m.minOrderSize
+	}
+
+	side := http.NewOrderRequestSideSELL
+	if net < 0 {
+		side = http.NewOrderRequestSideBUY
+	}
+	if _, err := m.trader.SendChildOrder(ctx, trading.MarketOrder(m.productCode, side, size)); err != nil {
+		return fmt.Errorf("failed to reduce position: %w", err)
+	}
+	return nil
+}
+
+// netPosition returns the sum of signed position sizes
+func netPosition(positions []position) float64 {
+	var net float64
+	for _, p := range positions {
+		net += p.signedSize
+	}
+	return net
+}
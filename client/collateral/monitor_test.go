@@ -0,0 +1,249 @@
+package collateral
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/http/resttest"
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// fakeServer serves collateral and positions and records sent orders
+type fakeServer struct {
+	mu         sync.Mutex
+	collateral string
+	positions  string
+	orders     []bfhttp.NewOrderRequest
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/me/getcollateral":
+		_, _ = w.Write([]byte(s.collateral))
+	case "/v1/me/getpositions":
+		_, _ = w.Write([]byte(s.positions))
+	case "/v1/me/sendchildorder":
+		var req bfhttp.NewOrderRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.orders = append(s.orders, req)
+		_, _ = w.Write([]byte(`{"child_order_acceptance_id":"JRF-TEST"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestMonitor(t *testing.T, srv *fakeServer, opts ...Option) *Monitor {
+	t.Helper()
+	m, err := NewMonitor(resttest.NewClient(t, srv), opts...)
+	if err != nil {
+		t.Fatalf("NewMonitor() error = %v", err)
+	}
+	return m
+}
+
+func TestThresholdsLevel(t *testing.T) {
+	tests := []struct {
+		keepRate float64
+		want     Level
+	}{
+		{2.0, LevelNormal},
+		{1.0, LevelWarning},
+		{0.9, LevelWarning},
+		{0.8, LevelDanger},
+		{0.6, LevelLiquidation},
+		{0.3, LevelLiquidation},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultThresholds.level(tt.keepRate); got != tt.want {
+			t.Errorf("level(%v) = %s, want %s", tt.keepRate, got, tt.want)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	srv := &fakeServer{
+		collateral: `{"collateral":100000,"open_position_pnl":-20000,"require_collateral":100000,"keep_rate":0.75}`,
+		positions:  `[{"product_code":"FX_BTC_JPY","side":"BUY","price":3000000,"size":0.5,"pnl":-20000}]`,
+	}
+	m := newTestMonitor(t, srv)
+
+	var events []Event
+	m.OnLevelChange(func(e Event) {
+		events = append(events, e)
+	})
+
+	if err := m.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+
+	snapshot, level := m.Current()
+	if level != LevelDanger {
+		t.Errorf("Expected level DANGER, got %s", level)
+	}
+	if snapshot.NetPosition != 0.5 {
+		t.Errorf("Expected net position 0.5, got %v", snapshot.NetPosition)
+	}
+	if snapshot.Estimated {
+		t.Error("Expected polled snapshot not to be estimated")
+	}
+	if len(events) != 1 || events[0].Previous != LevelNormal || events[0].Current != LevelDanger {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
+
+func TestHandleTicker_Estimate(t *testing.T) {
+	srv := &fakeServer{
+		collateral: `{"collateral":100000,"open_position_pnl":0,"require_collateral":50000,"keep_rate":2.0}`,
+		positions:  `[{"product_code":"FX_BTC_JPY","side":"BUY","price":3000000,"size":0.5,"pnl":0}]`,
+	}
+	m := newTestMonitor(t, srv)
+
+	// Tickers before the first poll are ignored
+	m.HandleTicker(websocket.TickerMessage{ProductCode: "FX_BTC_JPY", Ltp: 2000000})
+	if _, level := m.Current(); level != LevelNormal {
+		t.Fatalf("Expected NORMAL before first poll, got %s", level)
+	}
+
+	if err := m.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+
+	// Price drops by 100,000 JPY: pnl = 0.5 * -100000 = -50000, keep rate = 50000/50000 = 1.0
+	m.HandleTicker(websocket.TickerMessage{ProductCode: "FX_BTC_JPY", Ltp: 2900000})
+	snapshot, level := m.Current()
+	if !snapshot.Estimated {
+		t.Error("Expected estimated snapshot")
+	}
+	if math.Abs(snapshot.OpenPositionPnl+50000) > 1e-6 {
+		t.Errorf("Expected pnl -50000, got %v", snapshot.OpenPositionPnl)
+	}
+	if math.Abs(snapshot.KeepRate-1.0) > 1e-9 {
+		t.Errorf("Expected keep rate 1.0, got %v", snapshot.KeepRate)
+	}
+	if level != LevelWarning {
+		t.Errorf("Expected level WARNING, got %s", level)
+	}
+
+	// Tickers for other products are ignored
+	m.HandleTicker(websocket.TickerMessage{ProductCode: "BTC_JPY", Ltp: 1})
+	if _, level := m.Current(); level != LevelWarning {
+		t.Errorf("Expected level to stay WARNING, got %s", level)
+	}
+}
+
+func TestAutoReduce(t *testing.T) {
+	srv := &fakeServer{
+		collateral: `{"collateral":30000,"open_position_pnl":0,"require_collateral":50000,"keep_rate":0.6}`,
+		positions:  `[{"product_code":"FX_BTC_JPY","side":"SELL","price":3000000,"size":0.35,"pnl":0}]`,
+	}
+	ac := resttest.NewClient(t, srv)
+	m, err := NewMonitor(ac, WithAutoReduce(trading.NewClient(ac), LevelDanger, 0.5))
+	if err != nil {
+		t.Fatalf("NewMonitor() error = %v", err)
+	}
+
+	if err := m.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.orders) != 1 {
+		t.Fatalf("Expected 1 reduce order, got %d", len(srv.orders))
+	}
+	order := srv.orders[0]
+	if order.Side != bfhttp.NewOrderRequestSideBUY {
+		t.Errorf("Expected BUY to reduce a short position, got %s", order.Side)
+	}
+	if math.Abs(float64(order.Size)-0.17) > 1e-6 {
+		t.Errorf("Expected size 0.17, got %v", order.Size)
+	}
+	if order.ChildOrderType != bfhttp.NewOrderRequestChildOrderTypeMARKET {
+		t.Errorf("Expected MARKET order, got %s", order.ChildOrderType)
+	}
+}
+
+func TestAutoReduce_Size(t *testing.T) {
+	tests := []struct {
+		name     string
+		position float64
+		opts     []Option
+		want     float64 // 0 for no order
+	}{
+		{"multiple of the minimum", 0.12, nil, 0.06},
+		{"rounded down", 0.35, nil, 0.17},
+		{"rounded up to the minimum", 0.012, nil, 0.01},
+		{"minimum would close the position", 0.01, nil, 0},
+		{"other minimum", 0.005, []Option{WithMinOrderSize(0.001)}, 0.002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &fakeServer{
+				collateral: `{"collateral":30000,"open_position_pnl":0,"require_collateral":50000,"keep_rate":0.6}`,
+				positions:  fmt.Sprintf(`[{"product_code":"FX_BTC_JPY","side":"BUY","price":3000000,"size":%v,"pnl":0}]`, tt.position),
+			}
+			ac := resttest.NewClient(t, srv)
+			opts := append([]Option{WithAutoReduce(trading.NewClient(ac), LevelDanger, 0.5)}, tt.opts...)
+			m, err := NewMonitor(ac, opts...)
+			if err != nil {
+				t.Fatalf("NewMonitor() error = %v", err)
+			}
+			if err := m.Poll(context.Background()); err != nil {
+				t.Fatalf("Poll() error = %v", err)
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if tt.want == 0 {
+				if len(srv.orders) != 0 {
+					t.Errorf("Expected no order, got %+v", srv.orders)
+				}
+				return
+			}
+			if len(srv.orders) != 1 || srv.orders[0].Size != float32(tt.want) {
+				t.Errorf("Expected one order of %v, got %+v", tt.want, srv.orders)
+			}
+		})
+	}
+}
+
+func TestNewMonitor_Validation(t *testing.T) {
+	ac, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{}, "http://localhost")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	trader := trading.NewClient(ac)
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"no fraction", []Option{WithAutoReduce(trader, LevelDanger, 0)}},
+		{"fraction above one", []Option{WithAutoReduce(trader, LevelDanger, 1.5)}},
+		{"no minimum order size", []Option{WithMinOrderSize(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMonitor(ac, tt.opts...); err == nil {
+				t.Error("Expected a validation error")
+			}
+		})
+	}
+	if _, err := NewMonitor(ac, WithAutoReduce(trader, LevelDanger, 1)); err != nil {
+		t.Errorf("NewMonitor() error = %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+// Package deadman cancels resting orders when the application stops
+// heartbeating or loses its private realtime connection for too long.
+//
+// The switch runs in the process it guards, so it covers a stuck process
+// but not one that died. To cover crashes too, run it in a separate
+// process that receives the heartbeats.
+package deadman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+const (
+	defaultCancelTimeout = 10 * time.Second
+	// minCheckInterval bounds how often Run checks the deadlines
+	minCheckInterval = 10 * time.Millisecond
+)
+
+// Canceler cancels orders.
+// *trading.Client implements this interface.
+type Canceler interface {
+	CancelAllChildOrders(ctx context.Context, productCode string) error
+	CancelParentOrder(ctx context.Context, productCode, acceptanceID string) error
+}
+
+// Reason is why the switch tripped
+type Reason string
+
+const (
+	// MissedHeartbeat means Heartbeat was not called within the timeout
+	MissedHeartbeat Reason = "missed_heartbeat"
+	// ConnectionLost means the realtime connection was not restored within
+	// the grace period
+	ConnectionLost Reason = "connection_lost"
+)
+
+// Trip is fired once when the switch trips, after the first round of
+// cancels. Cancels that failed are retried on every check until they
+// succeed, and reported to OnError.
+type Trip struct {
+	Reason       Reason
+	Time         time.Time
+	ProductCodes []string // products whose child orders were canceled
+	ParentOrders []string // acceptance IDs of the parent orders canceled
+	Err          error    // cancels that failed in the first round, nil if none
+}
+
+// Switch is a deadman switch. Once it has tripped, it stays tripped until
+// Reset, so that the application decides when to trade again.
+type Switch struct {
+	canceler      Canceler
+	productCodes  []string
+	timeout       time.Duration
+	grace         time.Duration
+	cancelTimeout time.Duration
+
+	mu             sync.Mutex
+	lastBeat       time.Time
+	disconnectedAt time.Time         // zero while connected
+	parents        map[string]string // product code by parent acceptance ID
+	tripped        bool
+	pendingAll     map[string]bool   // products whose child orders are still to cancel
+	pendingParents map[string]string // parent orders still to cancel
+	tripHandler    func(Trip)
+	errorHandler   func(error)
+}
+
+// Option configures a Switch
+type Option func(*Switch)
+
+// WithReconnectGrace sets how long an attached realtime connection may stay
+// lost before the switch trips, the heartbeat timeout by default
+func WithReconnectGrace(d time.Duration) Option {
+	return func(s *Switch) {
+		s.grace = d
+	}
+}
+
+// WithCancelTimeout bounds every cancel request, 10 seconds by default
+func WithCancelTimeout(d time.Duration) Option {
+	return func(s *Switch) {
+		s.cancelTimeout = d
+	}
+}
+
+// NewSwitch creates a switch that cancels every child order of the products
+// and every tracked parent order when Heartbeat is not called within
+// timeout. The timeout and the grace period must be positive.
+func NewSwitch(canceler Canceler, productCodes []string, timeout time.Duration, opts ...Option) (*Switch, error) {
+	s := &Switch{
+		canceler:       canceler,
+		productCodes:   productCodes,
+		timeout:        timeout,
+		grace:          timeout,
+		cancelTimeout:  defaultCancelTimeout,
+		parents:        make(map[string]string),
+		pendingAll:     make(map[string]bool),
+		pendingParents: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.timeout <= 0 || s.grace <= 0 {
+		return nil, fmt.Errorf("invalid deadman switch: timeout and grace period must be positive")
+	}
+	return s, nil
+}
+
+// OnTrip sets a callback to receive trips
+func (s *Switch) OnTrip(handler func(Trip)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tripHandler = handler
+}
+
+// OnError sets a callback to receive cancels that failed
+func (s *Switch) OnError(handler func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorHandler = handler
+}
+
+// Heartbeat reports that the application is alive
+func (s *Switch) Heartbeat() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastBeat = time.Now()
+}
+
+// Track adds a parent order to cancel when the switch trips
+func (s *Switch) Track(productCode, parentAcceptanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parents[parentAcceptanceID] = productCode
+}
+
+// Untrack removes a parent order, for example once it is closed
+func (s *Switch) Untrack(parentAcceptanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.parents, parentAcceptanceID)
+}
+
+// Attach watches the connection of the private realtime client: the switch
+// trips when it is lost for longer than the grace period. The connection
+// counts as restored only once the client authenticated and subscribed
+// again, since private events are lost until then. The client should use
+// websocket.WithAutoReconnect. The returned function detaches the switch.
+func (s *Switch) Attach(c *websocket.Client) (detach func()) {
+	disconnect := c.OnDisconnect(func(error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.disconnectedAt.IsZero() {
+			s.disconnectedAt = time.Now()
+		}
+	})
+	reconnect := c.OnReconnect(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.disconnectedAt = time.Time{}
+	})
+	return func() {
+		disconnect.Remove()
+		reconnect.Remove()
+		s.mu.Lock()
+		s.disconnectedAt = time.Time{}
+		s.mu.Unlock()
+	}
+}
+
+// Tripped reports whether the switch has tripped
+func (s *Switch) Tripped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tripped
+}
+
+// Reset arms a tripped switch again, as if Heartbeat was called. Cancels
+// still failing are abandoned.
+func (s *Switch) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tripped = false
+	s.lastBeat = time.Now()
+	clear(s.pendingAll)
+	clear(s.pendingParents)
+}
+
+// Run checks the deadlines until ctx is done. The heartbeat timeout starts
+// when Run is called, unless Heartbeat was called before.
+func (s *Switch) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.lastBeat.IsZero() {
+		s.lastBeat = time.Now()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(max(min(s.timeout, s.grace)/4, minCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			s.Check(ctx, now)
+		}
+	}
+}
+
+// Check trips the switch if a deadline passed before now, and retries the
+// cancels that failed. Run calls it periodically.
+func (s *Switch) Check(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	if s.tripped {
+		retry := len(s.pendingAll) > 0 || len(s.pendingParents) > 0
+		s.mu.Unlock()
+		if retry {
+			s.cancelPending(ctx)
+		}
+		return
+	}
+
+	var reason Reason
+	switch {
+	case now.Sub(s.lastBeat) >= s.timeout:
+		reason = MissedHeartbeat
+	case !s.disconnectedAt.IsZero() && now.Sub(s.disconnectedAt) >= s.grace:
+		reason = ConnectionLost
+	default:
+		s.mu.Unlock()
+		return
+	}
+	s.tripped = true
+	for _, productCode := range s.productCodes {
+		s.pendingAll[productCode] = true
+	}
+	for id, productCode := range s.parents {
+		s.pendingParents[id] = productCode
+	}
+	s.mu.Unlock()
+
+	trip := Trip{Reason: reason, Time: now}
+	trip.ProductCodes, trip.ParentOrders, trip.Err = s.cancelPending(ctx)
+
+	s.mu.Lock()
+	tripHandler := s.tripHandler
+	s.mu.Unlock()
+	if tripHandler != nil {
+		tripHandler(trip)
+	}
+}
+
+// cancelPending sends the pending cancels, reports failures to OnError and
+// returns what was canceled
+func (s *Switch) cancelPending(ctx context.Context) (productCodes, parents []string, err error) {
+	s.mu.Lock()
+	pendingAll := make([]string, 0, len(s.pendingAll))
+	for productCode := range s.pendingAll {
+		pendingAll = append(pendingAll, productCode)
+	}
+	pendingParents := make(map[string]string, len(s.pendingParents))
+	for id, productCode := range s.pendingParents {
+		pendingParents[id] = productCode
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, productCode := range pendingAll {
+		if cerr := s.cancel(ctx, func(ctx context.Context) error {
+			return s.canceler.CancelAllChildOrders(ctx, productCode)
+		}); cerr != nil {
+			errs = append(errs, fmt.Errorf("failed to cancel child orders of %s: %w", productCode, cerr))
+			continue
+		}
+		productCodes = append(productCodes, productCode)
+		s.mu.Lock()
+		delete(s.pendingAll, productCode)
+		s.mu.Unlock()
+	}
+	for id, productCode := range pendingParents {
+		if cerr := s.cancel(ctx, func(ctx context.Context) error {
+			return s.canceler.CancelParentOrder(ctx, productCode, id)
+		}); cerr != nil {
+			errs = append(errs, fmt.Errorf("failed to cancel parent order %s: %w", id, cerr))
+			continue
+		}
+		parents = append(parents, id)
+		s.mu.Lock()
+		delete(s.pendingParents, id)
+		delete(s.parents, id)
+		s.mu.Unlock()
+	}
+
+	slices.Sort(productCodes)
+	slices.Sort(parents)
+	err = errors.Join(errs...)
+	if err != nil {
+		s.mu.Lock()
+		errorHandler := s.errorHandler
+		s.mu.Unlock()
+		if errorHandler != nil {
+			errorHandler(err)
+		}
+	}
+	return productCodes, parents, err
+}
+
+// cancel runs a cancel request with the cancel timeout
+func (s *Switch) cancel(ctx context.Context, do func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cancelTimeout)
+	defer cancel()
+	return do(ctx)
+}
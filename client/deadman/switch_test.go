@@ -0,0 +1,246 @@
+package deadman
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+var _ Canceler = (*trading.Client)(nil)
+
+// fakeCanceler records cancels and fails the first failures of them
+type fakeCanceler struct {
+	mu       sync.Mutex
+	failures int
+	calls    []string
+}
+
+func (c *fakeCanceler) record(call string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("network is unreachable")
+	}
+	return nil
+}
+
+func (c *fakeCanceler) CancelAllChildOrders(ctx context.Context, productCode string) error {
+	return c.record("all " + productCode)
+}
+
+func (c *fakeCanceler) CancelParentOrder(ctx context.Context, productCode, acceptanceID string) error {
+	return c.record("parent " + productCode + " " + acceptanceID)
+}
+
+func (c *fakeCanceler) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+func newSwitch(t *testing.T, canceler Canceler, productCodes []string, timeout time.Duration, opts ...Option) *Switch {
+	t.Helper()
+	s, err := NewSwitch(canceler, productCodes, timeout, opts...)
+	if err != nil {
+		t.Fatalf("NewSwitch() error = %v", err)
+	}
+	return s
+}
+
+func TestNewSwitch_Invalid(t *testing.T) {
+	if _, err := NewSwitch(&fakeCanceler{}, nil, 0); err == nil {
+		t.Error("Expected a zero timeout to be rejected")
+	}
+	if _, err := NewSwitch(&fakeCanceler{}, nil, time.Minute, WithReconnectGrace(-time.Second)); err == nil {
+		t.Error("Expected a negative grace period to be rejected")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	canceler := &fakeCanceler{}
+	s := newSwitch(t, canceler, []string{"BTC_JPY"}, time.Minute)
+	s.Track("FX_BTC_JPY", "JRF-PARENT-1")
+	s.Track("BTC_JPY", "JRF-PARENT-2")
+	s.Untrack("JRF-PARENT-2")
+	var trips []Trip
+	s.OnTrip(func(trip Trip) { trips = append(trips, trip) })
+
+	ctx := context.Background()
+	s.Heartbeat()
+	s.Check(ctx, time.Now().Add(30*time.Second))
+	if s.Tripped() || len(canceler.recorded()) != 0 {
+		t.Fatal("Expected the switch not to trip before the timeout")
+	}
+
+	now := time.Now().Add(2 * time.Minute)
+	s.Check(ctx, now)
+	s.Check(ctx, now.Add(time.Minute))
+	want := Trip{
+		Reason:       MissedHeartbeat,
+		Time:         now,
+		ProductCodes: []string{"BTC_JPY"},
+		ParentOrders: []string{"JRF-PARENT-1"},
+	}
+	if !s.Tripped() || len(trips) != 1 || !reflect.DeepEqual(trips[0], want) {
+		t.Errorf("Expected a single trip %+v, got %+v", want, trips)
+	}
+	wantCalls := []string{"all BTC_JPY", "parent FX_BTC_JPY JRF-PARENT-1"}
+	if got := canceler.recorded(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("Expected cancels %v, got %v", wantCalls, got)
+	}
+
+	// Canceled parent orders are not tracked anymore
+	s.Reset()
+	s.Check(ctx, time.Now().Add(2*time.Minute))
+	if got := canceler.recorded(); len(got) != 3 || got[2] != "all BTC_JPY" {
+		t.Errorf("Expected only the child orders to be canceled again, got %v", got)
+	}
+}
+
+func TestCheck_RetriesFailedCancels(t *testing.T) {
+	canceler := &fakeCanceler{failures: 1}
+	s := newSwitch(t, canceler, []string{"BTC_JPY", "FX_BTC_JPY"}, time.Minute)
+	var trip Trip
+	s.OnTrip(func(t Trip) { trip = t })
+	var errs []error
+	s.OnError(func(err error) { errs = append(errs, err) })
+
+	ctx := context.Background()
+	now := time.Now().Add(2 * time.Minute)
+	s.Check(ctx, now)
+	if trip.Err == nil || len(trip.ProductCodes) != 1 || len(errs) != 1 {
+		t.Fatalf("Expected one failed cancel, got trip %+v and errors %v", trip, errs)
+	}
+
+	s.Check(ctx, now)
+	s.Check(ctx, now)
+	calls := canceler.recorded()
+	if len(calls) != 3 || calls[2] != calls[0] {
+		t.Errorf("Expected the failed cancel to be retried once, got %v", calls)
+	}
+	if len(errs) != 1 {
+		t.Errorf("Expected the retry to succeed, got %v", errs)
+	}
+}
+
+func TestRun_Heartbeat(t *testing.T) {
+	canceler := &fakeCanceler{}
+	s := newSwitch(t, canceler, []string{"BTC_JPY"}, 100*time.Millisecond)
+	trips := make(chan Trip, 1)
+	s.OnTrip(func(trip Trip) { trips <- trip })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = s.Run(ctx) }()
+
+	for range 10 {
+		s.Heartbeat()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if s.Tripped() {
+		t.Fatal("Expected heartbeats to keep the switch armed")
+	}
+
+	select {
+	case trip := <-trips:
+		if trip.Reason != MissedHeartbeat {
+			t.Errorf("Expected MissedHeartbeat, got %s", trip.Reason)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the trip")
+	}
+}
+
+func TestAttach(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := websocket.NewClient(ctx, srv.URL, websocket.WithAutoReconnect())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+	reconnected := make(chan struct{}, 1)
+	client.OnReconnect(func() { reconnected <- struct{}{} })
+
+	canceler := &fakeCanceler{}
+	s := newSwitch(t, canceler, []string{"BTC_JPY"}, time.Hour, WithReconnectGrace(200*time.Millisecond))
+	defer s.Attach(client)()
+	trips := make(chan Trip, 1)
+	s.OnTrip(func(trip Trip) { trips <- trip })
+	go func() { _ = s.Run(ctx) }()
+
+	// A connection restored within the grace period does not trip
+	srv.DisconnectAll()
+	select {
+	case <-reconnected:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the reconnect")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if s.Tripped() {
+		t.Fatal("Expected a restored connection not to trip the switch")
+	}
+
+	// A connection that cannot be restored trips
+	srv.Close()
+	select {
+	case trip := <-trips:
+		if trip.Reason != ConnectionLost || len(trip.ProductCodes) != 1 {
+			t.Errorf("Unexpected trip %+v", trip)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the trip")
+	}
+}
+
+func TestAttach_ReauthRejected(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := websocket.NewClient(ctx, srv.URL, websocket.WithAutoReconnect())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Auth(ctx, "key", "secret"); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	if err := client.Subscribe(ctx, websocket.ChildOrderEventsChannel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, websocket.ChildOrderEventsChannel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	s := newSwitch(t, &fakeCanceler{}, []string{"BTC_JPY"}, time.Hour, WithReconnectGrace(200*time.Millisecond))
+	defer s.Attach(client)()
+	trips := make(chan Trip, 1)
+	s.OnTrip(func(trip Trip) { trips <- trip })
+	go func() { _ = s.Run(ctx) }()
+
+	// The socket comes back but private events do not
+	srv.RejectAuth("Invalid signature")
+	srv.DisconnectAll()
+	select {
+	case trip := <-trips:
+		if trip.Reason != ConnectionLost {
+			t.Errorf("Unexpected trip %+v", trip)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the trip")
+	}
+}
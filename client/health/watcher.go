@@ -0,0 +1,317 @@
+// Package health watches exchange health and board state per product.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// ErrTradingPaused is returned by Allow while a product's health or state blocks trading
+var ErrTradingPaused = errors.New("trading paused")
+
+// Status is the health and board state of a product
+type Status struct {
+	ProductCode string
+	Exchange    http.ExchangeHealthStatus // from /v1/gethealth
+	Health      http.BoardStateHealth     // from /v1/getboardstate
+	State       http.BoardStateState
+	Time        time.Time
+}
+
+// Transition is fired when the health or state of a product changes
+type Transition struct {
+	ProductCode string
+	Previous    Status // zero value on the first poll
+	Current     Status
+}
+
+// DefaultBlockedExchangeHealth is the exchange health that pauses trading by default
+var DefaultBlockedExchangeHealth = []http.ExchangeHealthStatus{
+	http.ExchangeHealthStatusSUPERBUSY,
+	http.ExchangeHealthStatusSTOP,
+}
+
+// DefaultBlockedHealth is the health that pauses trading by default
+var DefaultBlockedHealth = []http.BoardStateHealth{
+	http.BoardStateHealthSUPERBUSY,
+	http.BoardStateHealthSTOP,
+}
+
+// DefaultBlockedStates are the board states that pause trading by default
+var DefaultBlockedStates = []http.BoardStateState{
+	http.CLOSED,
+	http.STARTING,
+	http.CIRCUITBREAK,
+	http.MATURED,
+}
+
+// Watcher polls exchange health and board state per product and emits
+// transitions
+type Watcher struct {
+	api             *http.ClientWithResponses
+	productCodes    []string
+	interval        time.Duration
+	blockedExchange map[http.ExchangeHealthStatus]struct{}
+	blockedHealth   map[http.BoardStateHealth]struct{}
+	blockedStates   map[http.BoardStateState]struct{}
+	maxAge          time.Duration
+	failOpen        bool
+
+	mu                sync.Mutex
+	statuses          map[string]Status
+	transitionHandler func(Transition)
+	errorHandler      func(string, error)
+}
+
+// Option configures a Watcher
+type Option func(*Watcher)
+
+// WithInterval sets the polling interval
+func WithInterval(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.interval = d
+	}
+}
+
+// WithBlockedExchangeHealth sets the exchange health values that pause trading
+func WithBlockedExchangeHealth(health ...http.ExchangeHealthStatus) Option {
+	return func(w *Watcher) {
+		w.blockedExchange = make(map[http.ExchangeHealthStatus]struct{})
+		for _, h := range health {
+			w.blockedExchange[h] = struct{}{}
+		}
+	}
+}
+
+// WithBlockedHealth sets the health values that pause trading
+func WithBlockedHealth(health ...http.BoardStateHealth) Option {
+	return func(w *Watcher) {
+		w.blockedHealth = make(map[http.BoardStateHealth]struct{})
+		for _, h := range health {
+			w.blockedHealth[h] = struct{}{}
+		}
+	}
+}
+
+// WithBlockedStates sets the board states that pause trading
+func WithBlockedStates(states ...http.BoardStateState) Option {
+	return func(w *Watcher) {
+		w.blockedStates = make(map[http.BoardStateState]struct{})
+		for _, s := range states {
+			w.blockedStates[s] = struct{}{}
+		}
+	}
+}
+
+// WithMaxAge sets how old the last status of a product may be before Allow
+// refuses to trade it, three polling intervals by default
+func WithMaxAge(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.maxAge = d
+	}
+}
+
+// WithFailOpen makes Allow let products through whose status is unknown or
+// older than the maximum age. Only a known blocked status pauses trading.
+func WithFailOpen() Option {
+	return func(w *Watcher) {
+		w.failOpen = true
+	}
+}
+
+// NewWatcher creates a new watcher for the products
+func NewWatcher(ac *http.AuthenticatedClient, productCodes []string, opts ...Option) *Watcher {
+	w := &Watcher{
+		api:          ac.Client(),
+		productCodes: productCodes,
+		interval:     10 * time.Second,
+		statuses:     make(map[string]Status),
+	}
+	WithBlockedExchangeHealth(DefaultBlockedExchangeHealth...)(w)
+	WithBlockedHealth(DefaultBlockedHealth...)(w)
+	WithBlockedStates(DefaultBlockedStates...)(w)
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.maxAge <= 0 {
+		w.maxAge = 3 * w.interval
+	}
+	return w
+}
+
+// OnTransition sets a callback to receive health and state transitions
+func (w *Watcher) OnTransition(handler func(Transition)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.transitionHandler = handler
+}
+
+// OnError sets a callback to receive polling errors per product from Run
+func (w *Watcher) OnError(handler func(productCode string, err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.errorHandler = handler
+}
+
+// Run polls every product until ctx is done
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, productCode := range w.productCodes {
+			if err := w.PollProduct(ctx, productCode); err != nil {
+				w.mu.Lock()
+				errorHandler := w.errorHandler
+				w.mu.Unlock()
+				if errorHandler != nil {
+					errorHandler(productCode, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll polls every product once and returns the first error
+func (w *Watcher) Poll(ctx context.Context) error {
+	var firstErr error
+	for _, productCode := range w.productCodes {
+		if err := w.PollProduct(ctx, productCode); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// PollProduct polls the exchange health and the board state of a single product
+func (w *Watcher) PollProduct(ctx context.Context, productCode string) error {
+	exchange, err := w.exchangeHealth(ctx, productCode)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.api.GetV1GetboardstateWithResponse(ctx, &http.GetV1GetboardstateParams{
+		ProductCode: productCode,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get board state of %s: %w", productCode, err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get board state of %s: %w", productCode, err)
+	}
+	if resp.JSON200 == nil {
+		return fmt.Errorf("failed to get board state of %s: empty response", productCode)
+	}
+
+	current := Status{
+		ProductCode: productCode,
+		Exchange:    exchange,
+		Time:        time.Now(),
+	}
+	if resp.JSON200.Health != nil {
+		current.Health = *resp.JSON200.Health
+	}
+	if resp.JSON200.State != nil {
+		current.State = *resp.JSON200.State
+	}
+
+	w.Update(current)
+	return nil
+}
+
+// exchangeHealth returns the exchange health reported for a product
+func (w *Watcher) exchangeHealth(ctx context.Context, productCode string) (http.ExchangeHealthStatus, error) {
+	resp, err := w.api.GetV1GethealthWithResponse(ctx, &http.GetV1GethealthParams{
+		ProductCode: productCode,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get exchange health of %s: %w", productCode, err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return "", fmt.Errorf("failed to get exchange health of %s: %w", productCode, err)
+	}
+	if resp.JSON200 == nil || resp.JSON200.Status == nil {
+		return "", fmt.Errorf("failed to get exchange health of %s: empty response", productCode)
+	}
+	return *resp.JSON200.Status, nil
+}
+
+// Update records a status and fires a transition when it changed.
+// It can also be fed from other sources, such as the state of the REST
+// ticker (/v1/getticker); an empty exchange health keeps the last polled
+// one, and a zero time is the current time.
+func (w *Watcher) Update(current Status) {
+	if current.Time.IsZero() {
+		current.Time = time.Now()
+	}
+	w.mu.Lock()
+	previous, known := w.statuses[current.ProductCode]
+	if current.Exchange == "" {
+		current.Exchange = previous.Exchange
+	}
+	w.statuses[current.ProductCode] = current
+	transitionHandler := w.transitionHandler
+	w.mu.Unlock()
+
+	if known && previous.Exchange == current.Exchange && previous.Health == current.Health && previous.State == current.State {
+		return
+	}
+	if transitionHandler != nil {
+		transitionHandler(Transition{
+			ProductCode: current.ProductCode,
+			Previous:    previous,
+			Current:     current,
+		})
+	}
+}
+
+// Status returns the last known status of a product
+func (w *Watcher) Status(productCode string) (Status, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s, ok := w.statuses[productCode]
+	return s, ok
+}
+
+// Allow returns ErrTradingPaused when the product's last known exchange
+// health, board health or state is blocked. Trading is also paused for
+// products whose status is unknown, because they have not been polled yet
+// or are not watched, or older than the maximum age, because polling fails;
+// see WithMaxAge and WithFailOpen.
+// Allow implements trading.Gate.
+func (w *Watcher) Allow(productCode string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.statuses[productCode]
+	if !ok {
+		if w.failOpen {
+			return nil
+		}
+		return fmt.Errorf("%w: status of %s is unknown", ErrTradingPaused, productCode)
+	}
+	if age := time.Since(s.Time); age > w.maxAge && !w.failOpen {
+		return fmt.Errorf("%w: status of %s is %v old", ErrTradingPaused, productCode, age.Round(time.Second))
+	}
+	if _, blocked := w.blockedExchange[s.Exchange]; blocked {
+		return fmt.Errorf("%w: exchange health of %s is %s", ErrTradingPaused, productCode, s.Exchange)
+	}
+	if _, blocked := w.blockedHealth[s.Health]; blocked {
+		return fmt.Errorf("%w: %s health is %s", ErrTradingPaused, productCode, s.Health)
+	}
+	if _, blocked := w.blockedStates[s.State]; blocked {
+		return fmt.Errorf("%w: %s state is %s", ErrTradingPaused, productCode, s.State)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/http/resttest"
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+)
+
+// fakeBoardState serves a configurable exchange health and board state per product
+type fakeBoardState struct {
+	mu       sync.Mutex
+	states   map[string][2]string // product code -> {health, state}
+	exchange map[string]string    // product code -> exchange health, NORMAL if unset
+}
+
+func (f *fakeBoardState) set(productCode, health, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[productCode] = [2]string{health, state}
+}
+
+func (f *fakeBoardState) setExchange(productCode, health string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.exchange == nil {
+		f.exchange = make(map[string]string)
+	}
+	f.exchange[productCode] = health
+}
+
+func (f *fakeBoardState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/gethealth":
+		health, ok := f.exchange[r.URL.Query().Get("product_code")]
+		if !ok {
+			health = "NORMAL"
+		}
+		_, _ = fmt.Fprintf(w, `{"status":%q}`, health)
+	case "/v1/getboardstate":
+		s := f.states[r.URL.Query().Get("product_code")]
+		_, _ = fmt.Fprintf(w, `{"health":%q,"state":%q}`, s[0], s[1])
+	case "/v1/me/sendchildorder":
+		_, _ = w.Write([]byte(`{"child_order_acceptance_id":"JRF-TEST"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestWatcher(t *testing.T, fake *fakeBoardState, products []string, opts ...Option) (*Watcher, *bfhttp.AuthenticatedClient) {
+	t.Helper()
+	ac := resttest.NewClient(t, fake)
+	return NewWatcher(ac, products, opts...), ac
+}
+
+func TestWatcher_Transitions(t *testing.T) {
+	fake := &fakeBoardState{states: make(map[string][2]string)}
+	fake.set("BTC_JPY", "NORMAL", "RUNNING")
+	fake.set("FX_BTC_JPY", "NORMAL", "RUNNING")
+	w, _ := newTestWatcher(t, fake, []string{"BTC_JPY", "FX_BTC_JPY"})
+
+	var transitions []Transition
+	w.OnTransition(func(tr Transition) {
+		transitions = append(transitions, tr)
+	})
+
+	ctx := context.Background()
+	if err := w.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(transitions) != 2 {
+		t.Fatalf("Expected 2 initial transitions, got %d", len(transitions))
+	}
+
+	// No change, no transition
+	if err := w.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(transitions) != 2 {
+		t.Fatalf("Expected no new transitions, got %d", len(transitions))
+	}
+
+	fake.set("FX_BTC_JPY", "NORMAL", "CIRCUIT BREAK")
+	if err := w.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(transitions) != 3 {
+		t.Fatalf("Expected 3 transitions, got %d", len(transitions))
+	}
+	last := transitions[2]
+	if last.ProductCode != "FX_BTC_JPY" || last.Previous.State != bfhttp.RUNNING || last.Current.State != bfhttp.CIRCUITBREAK {
+		t.Errorf("Unexpected transition: %+v", last)
+	}
+}
+
+func TestWatcher_Allow(t *testing.T) {
+	fake := &fakeBoardState{states: make(map[string][2]string)}
+	fake.set("BTC_JPY", "SUPER BUSY", "RUNNING")
+	fake.set("FX_BTC_JPY", "NORMAL", "CIRCUIT BREAK")
+	fake.set("ETH_JPY", "BUSY", "RUNNING")
+	w, _ := newTestWatcher(t, fake, []string{"BTC_JPY", "FX_BTC_JPY", "ETH_JPY"})
+
+	if err := w.Allow("ETH_JPY"); !errors.Is(err, ErrTradingPaused) {
+		t.Errorf("Expected products not yet polled to be paused, got %v", err)
+	}
+	if err := w.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+
+	tests := []struct {
+		productCode string
+		wantErr     bool
+	}{
+		{"BTC_JPY", true},
+		{"FX_BTC_JPY", true},
+		{"ETH_JPY", false},
+		{"XRP_JPY", true}, // not watched
+	}
+	for _, tt := range tests {
+		err := w.Allow(tt.productCode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Allow(%s) error = %v, wantErr %v", tt.productCode, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrTradingPaused) {
+			t.Errorf("Expected ErrTradingPaused, got %v", err)
+		}
+	}
+}
+
+func TestWatcher_AllowStale(t *testing.T) {
+	fake := &fakeBoardState{states: make(map[string][2]string)}
+	w, _ := newTestWatcher(t, fake, []string{"BTC_JPY"}, WithMaxAge(time.Minute))
+	running := Status{ProductCode: "BTC_JPY", Health: bfhttp.BoardStateHealthNORMAL, State: bfhttp.RUNNING}
+
+	w.Update(running)
+	if err := w.Allow("BTC_JPY"); err != nil {
+		t.Errorf("Allow() error = %v", err)
+	}
+
+	// Polling failed since
+	running.Time = time.Now().Add(-2 * time.Minute)
+	w.Update(running)
+	if err := w.Allow("BTC_JPY"); !errors.Is(err, ErrTradingPaused) {
+		t.Errorf("Expected a stale status to pause trading, got %v", err)
+	}
+
+	open, _ := newTestWatcher(t, fake, []string{"BTC_JPY"}, WithMaxAge(time.Minute), WithFailOpen())
+	if err := open.Allow("BTC_JPY"); err != nil {
+		t.Errorf("Expected an unknown status to be allowed, got %v", err)
+	}
+	open.Update(running)
+	if err := open.Allow("BTC_JPY"); err != nil {
+		t.Errorf("Expected a stale status to be allowed, got %v", err)
+	}
+	running.State = bfhttp.CIRCUITBREAK
+	open.Update(running)
+	if err := open.Allow("BTC_JPY"); !errors.Is(err, ErrTradingPaused) {
+		t.Errorf("Expected a blocked status to pause trading, got %v", err)
+	}
+}
+
+func TestWatcher_GatesTrading(t *testing.T) {
+	fake := &fakeBoardState{states: make(map[string][2]string)}
+	fake.set("FX_BTC_JPY", "NORMAL", "CIRCUIT BREAK")
+	w, ac := newTestWatcher(t, fake, []string{"FX_BTC_JPY"}, WithBlockedHealth(), WithBlockedStates(bfhttp.CIRCUITBREAK))
+
+	if err := w.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+
+	trader := trading.NewClient(ac, trading.WithGate(w))
+	_, err := trader.SendChildOrder(context.Background(), trading.MarketOrder("FX_BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0.01))
+	if !errors.Is(err, ErrTradingPaused) {
+		t.Errorf("Expected ErrTradingPaused, got %v", err)
+	}
+
+	fake.set("FX_BTC_JPY", "NORMAL", "RUNNING")
+	if err := w.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if _, err := trader.SendChildOrder(context.Background(), trading.MarketOrder("FX_BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0.01)); err != nil {
+		t.Errorf("SendChildOrder() error = %v", err)
+	}
+}
+
+func TestWatcher_ExchangeHealth(t *testing.T) {
+	fake := &fakeBoardState{states: make(map[string][2]string)}
+	fake.set("BTC_JPY", "NORMAL", "RUNNING")
+	w, _ := newTestWatcher(t, fake, []string{"BTC_JPY"})
+
+	var transitions []Transition
+	w.OnTransition(func(tr Transition) {
+		transitions = append(transitions, tr)
+	})
+
+	ctx := context.Background()
+	if err := w.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if err := w.Allow("BTC_JPY"); err != nil {
+		t.Errorf("Allow() error = %v", err)
+	}
+
+	// The exchange stops while the board still reports NORMAL
+	fake.setExchange("BTC_JPY", "STOP")
+	if err := w.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if err := w.Allow("BTC_JPY"); !errors.Is(err, ErrTradingPaused) {
+		t.Errorf("Expected ErrTradingPaused, got %v", err)
+	}
+	if len(transitions) != 2 || transitions[1].Current.Exchange != bfhttp.ExchangeHealthStatusSTOP {
+		t.Fatalf("Expected a transition to STOP, got %+v", transitions)
+	}
+
+	// A status fed from another source keeps the polled exchange health
+	w.Update(Status{ProductCode: "BTC_JPY", Health: bfhttp.BoardStateHealthNORMAL, State: bfhttp.RUNNING})
+	if s, _ := w.Status("BTC_JPY"); s.Exchange != bfhttp.ExchangeHealthStatusSTOP {
+		t.Errorf("Expected the exchange health to be kept, got %q", s.Exchange)
+	}
+	if len(transitions) != 2 {
+		t.Errorf("Expected no new transition, got %+v", transitions[2:])
+	}
+}
@@ -96,8 +96,9 @@ const (
 
 // Defines values for MarketMarketType.
 const (
-	FX   MarketMarketType = "FX"
-	Spot MarketMarketType = "Spot"
+	FX      MarketMarketType = "FX"
+	Futures MarketMarketType = "Futures"
+	Spot    MarketMarketType = "Spot"
 )
 
 // Defines values for NewOrderRequestChildOrderType.
@@ -654,14 +655,17 @@ type FundingRate struct {
 
 // Market defines model for Market.
 type Market struct {
-	// MarketType "Spot" または "FX"
+	// Alias エイリアス (先物のみ)
+	Alias *string `json:"alias,omitempty"`
+
+	// MarketType "Spot"、"FX" または "Futures"
 	MarketType *MarketMarketType `json:"market_type,omitempty"`
 
 	// ProductCode プロダクトコード
 	ProductCode *string `json:"product_code,omitempty"`
 }
 
-// MarketMarketType "Spot" または "FX"
+// MarketMarketType "Spot"、"FX" または "Futures"
 type MarketMarketType string
 
 // MarketExecution defines model for MarketExecution.
@@ -2,16 +2,24 @@ package http
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	"github.com/bmf-san/go-bitflyer-api-client/client/tracing"
 )
 
 // AuthenticatedClient wraps the generated client with authentication
 type AuthenticatedClient struct {
-	client     *ClientWithResponses
-	signer     *auth.Signer
-	optionErr  error // Stores error from options
+	client    *ClientWithResponses
+	signer    *auth.Signer
+	transport *authenticatedTransport
+	baseURL   string
+	region    Region
+	optionErr error // Stores error from options
 }
 
 // AuthOption is a function that modifies the authenticated client
@@ -20,16 +28,15 @@ type AuthOption func(*AuthenticatedClient)
 // WithCustomHTTPClient sets a custom HTTP client
 func WithCustomHTTPClient(httpClient *http.Client) AuthOption {
 	return func(c *AuthenticatedClient) {
+		// Keep the shared transport so options applied in any order see it
+		c.transport.base = httpClient.Transport
 		customClient := &http.Client{
-			Transport: &authenticatedTransport{
-				base:   httpClient.Transport,
-				signer: c.signer,
-			},
-			Timeout: httpClient.Timeout,
+			Transport: c.transport,
+			Timeout:   httpClient.Timeout,
 		}
 
 		var err error
-		c.client, err = NewClientWithResponses("https://api.bitflyer.com", WithHTTPClient(customClient))
+		c.client, err = NewClientWithResponses(c.baseURL, WithHTTPClient(customClient))
 		if err != nil {
 			c.optionErr = fmt.Errorf("failed to create client with custom HTTP client: %w", err)
 		}
@@ -43,18 +50,20 @@ func NewAuthenticatedClient(credentials auth.APICredentials, baseURL string, opt
 	}
 
 	ac := &AuthenticatedClient{
-		signer: auth.NewSigner(credentials),
+		signer:  auth.NewSigner(credentials),
+		baseURL: baseURL,
+		region:  RegionJP,
 	}
 
 	// Create transport with authentication
-	transport := &authenticatedTransport{
+	ac.transport = &authenticatedTransport{
 		base:   http.DefaultTransport,
 		signer: ac.signer,
 	}
 
 	// Create client with auth transport
 	httpClient := &http.Client{
-		Transport: transport,
+		Transport: ac.transport,
 	}
 
 	client, err := NewClientWithResponses(baseURL, WithHTTPClient(httpClient))
@@ -84,8 +93,12 @@ func (c *AuthenticatedClient) Client() *ClientWithResponses {
 
 // authenticatedTransport is an http.RoundTripper that adds authentication
 type authenticatedTransport struct {
-	base   http.RoundTripper
-	signer *auth.Signer
+	base    http.RoundTripper
+	signer  *auth.Signer
+	metrics Metrics
+	logger  *slog.Logger
+	tracer  trace.Tracer
+	linker  *tracing.OrderLinker
 }
 
 // RoundTrip implements http.RoundTripper
@@ -96,8 +109,30 @@ func (t *authenticatedTransport) RoundTrip(req *http.Request) (*http.Response, e
 	}
 
 	// Use the base transport to perform the request
-	if t.base == nil {
-		t.base = http.DefaultTransport
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var span trace.Span
+	if t.tracer != nil {
+		req, span = t.startSpan(req)
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if span != nil {
+		t.endSpan(span, req, resp, err)
+	}
+	if t.logger != nil {
+		t.logRequest(req, resp, err, time.Since(start))
+	}
+	if t.metrics != nil {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		t.metrics.ObserveHTTPRequest(req.URL.Path, req.Method, statusCode, time.Since(start))
 	}
-	return t.base.RoundTrip(req)
+	return resp, err
 }
@@ -0,0 +1,17 @@
+package http
+
+import "strconv"
+
+// Decimal dereferences an optional float32 field of a generated type,
+// keeping its shortest decimal representation so that a size of 0.12 stays
+// 0.12 rather than 0.11999999731779099. It returns 0 for nil.
+//
+// float32 holds whole numbers exactly only up to 2^24, so prices above that
+// cannot be recovered; decode them from the response body instead.
+func Decimal(v *float32) float64 {
+	if v == nil {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(*v), 'g', -1, 32), 64)
+	return f
+}
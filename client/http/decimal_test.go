@@ -0,0 +1,21 @@
+package http
+
+import "testing"
+
+func TestDecimal(t *testing.T) {
+	f := func(v float32) *float32 { return &v }
+	tests := []struct {
+		in   *float32
+		want float64
+	}{
+		{nil, 0},
+		{f(0.12), 0.12},
+		{f(0.001), 0.001},
+		{f(3000000), 3000000},
+	}
+	for _, tt := range tests {
+		if got := Decimal(tt.in); got != tt.want {
+			t.Errorf("Decimal(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// APIError is returned when the API responds with a non-2xx status code
+type APIError struct {
+	StatusCode   int
+	Status       int    // bitFlyer error status (e.g. -208), zero if not present
+	ErrorMessage string // bitFlyer error_message, empty if not present
+	Body         []byte
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+	if e.ErrorMessage != "" {
+		return fmt.Sprintf("bitflyer api error: http %d: status %d: %s", e.StatusCode, e.Status, e.ErrorMessage)
+	}
+	return fmt.Sprintf("bitflyer api error: http %d: %s", e.StatusCode, string(e.Body))
+}
+
+// CheckResponse returns an *APIError when statusCode is not a 2xx code.
+// It is meant to be called with the StatusCode() and Body of a generated
+// *WithResponse result.
+func CheckResponse(statusCode int, body []byte) error {
+	if statusCode >= 200 && statusCode < 300 {
+		return nil
+	}
+
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Body:       body,
+	}
+
+	// bitFlyer error bodies look like {"status":-208,"error_message":"...","data":null}
+	var payload struct {
+		Status       int    `json:"status"`
+		ErrorMessage string `json:"error_message"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		apiErr.Status = payload.Status
+		apiErr.ErrorMessage = payload.ErrorMessage
+	}
+
+	return apiErr
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantErr     bool
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:       "ok",
+			statusCode: 200,
+			body:       `{}`,
+			wantErr:    false,
+		},
+		{
+			name:        "bitflyer error body",
+			statusCode:  400,
+			body:        `{"status":-208,"error_message":"Order is not accepted","data":null}`,
+			wantErr:     true,
+			wantStatus:  -208,
+			wantMessage: "Order is not accepted",
+		},
+		{
+			name:       "non json body",
+			statusCode: 502,
+			body:       `bad gateway`,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckResponse(tt.statusCode, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected *APIError, got %T", err)
+			}
+			if apiErr.StatusCode != tt.statusCode {
+				t.Errorf("Expected status code %d, got %d", tt.statusCode, apiErr.StatusCode)
+			}
+			if apiErr.Status != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, apiErr.Status)
+			}
+			if apiErr.ErrorMessage != tt.wantMessage {
+				t.Errorf("Expected message %q, got %q", tt.wantMessage, apiErr.ErrorMessage)
+			}
+			if !strings.Contains(err.Error(), "bitflyer api error") {
+				t.Errorf("Unexpected error string: %s", err.Error())
+			}
+		})
+	}
+}
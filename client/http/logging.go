@@ -0,0 +1,75 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// redacted replaces credentials in log output
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are the request headers that carry credentials
+var sensitiveHeaders = map[string]struct{}{
+	"Access-Key":    {},
+	"Access-Sign":   {},
+	"Authorization": {},
+}
+
+// WithLogger logs a summary of every request: failures and 4xx/5xx
+// responses at Warn, everything else at Debug. Request headers are only
+// logged at Debug, with the API key and signature redacted.
+func WithLogger(logger *slog.Logger) AuthOption {
+	return func(c *AuthenticatedClient) {
+		c.transport.logger = logger
+	}
+}
+
+// logRequest logs the outcome of a request
+func (t *authenticatedTransport) logRequest(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+	ctx := req.Context()
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path),
+		slog.String("query", req.URL.RawQuery),
+		slog.Duration("duration", duration),
+	}
+
+	if err != nil {
+		t.logger.LogAttrs(ctx, slog.LevelWarn, "bitflyer request failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		t.logger.LogAttrs(ctx, slog.LevelWarn, "bitflyer request returned an error status", attrs...)
+		return
+	}
+	if t.logger.Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, slog.Any("headers", redactedHeader(req.Header)))
+	}
+	t.logger.LogAttrs(ctx, slog.LevelDebug, "bitflyer request", attrs...)
+}
+
+// redactedHeader logs request headers without credentials
+type redactedHeader http.Header
+
+// LogValue implements slog.LogValuer
+func (h redactedHeader) LogValue() slog.Value {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]slog.Attr, 0, len(names))
+	for _, name := range names {
+		value := http.Header(h).Get(name)
+		if _, ok := sensitiveHeaders[http.CanonicalHeaderKey(name)]; ok {
+			value = redacted
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.GroupValue(attrs...)
+}
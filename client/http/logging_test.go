@@ -0,0 +1,79 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+)
+
+// syncBuffer is a log destination safe for concurrent writes
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestWithLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/me/getbalance" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status":-500,"error_message":"Key not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"product_code":"BTC_JPY"}`))
+	}))
+	defer srv.Close()
+
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	credentials := auth.APICredentials{APIKey: "test-key", APISecret: "test-secret"}
+	client, err := NewAuthenticatedClient(credentials, srv.URL, WithLogger(logger))
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := client.Client().GetV1GettickerWithResponse(ctx, &GetV1GettickerParams{ProductCode: "BTC_JPY"}); err != nil {
+		t.Fatalf("GetV1Getticker() error = %v", err)
+	}
+	if _, err := client.Client().GetV1MeGetbalanceWithResponse(ctx); err != nil {
+		t.Fatalf("GetV1MeGetbalance() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d:\n%s", len(lines), out.String())
+	}
+	for _, want := range []string{"level=DEBUG", "path=/v1/getticker", `query="product_code=BTC_JPY"`, "status=200", "headers.Access-Key=[REDACTED]", "headers.Access-Sign=[REDACTED]"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("Expected %q in %s", want, lines[0])
+		}
+	}
+	for _, want := range []string{"level=WARN", "path=/v1/me/getbalance", "status=401"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("Expected %q in %s", want, lines[1])
+		}
+	}
+	if strings.Contains(out.String(), "test-key") {
+		t.Errorf("Log leaks the API key:\n%s", out.String())
+	}
+}
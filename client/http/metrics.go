@@ -0,0 +1,18 @@
+package http
+
+import "time"
+
+// Metrics records REST request metrics.
+// *metrics.Registry implements this interface.
+type Metrics interface {
+	// ObserveHTTPRequest is called once per request. endpoint is the URL
+	// path and statusCode is zero when the request failed without a response.
+	ObserveHTTPRequest(endpoint, method string, statusCode int, duration time.Duration)
+}
+
+// WithMetrics records request count, latency and status codes per endpoint
+func WithMetrics(metrics Metrics) AuthOption {
+	return func(c *AuthenticatedClient) {
+		c.transport.metrics = metrics
+	}
+}
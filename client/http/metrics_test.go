@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+)
+
+type observation struct {
+	endpoint   string
+	method     string
+	statusCode int
+}
+
+type stubMetrics struct {
+	mu           sync.Mutex
+	observations []observation
+}
+
+func (m *stubMetrics) ObserveHTTPRequest(endpoint, method string, statusCode int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations = append(m.observations, observation{endpoint, method, statusCode})
+}
+
+func TestWithMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/me/getbalance" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status":-500,"error_message":"Key not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"product_code":"BTC_JPY"}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		opts func(m Metrics) []AuthOption
+	}{
+		{"default transport", func(m Metrics) []AuthOption {
+			return []AuthOption{WithMetrics(m)}
+		}},
+		{"metrics before custom client", func(m Metrics) []AuthOption {
+			return []AuthOption{WithMetrics(m), WithCustomHTTPClient(&http.Client{Timeout: time.Second})}
+		}},
+		{"metrics after custom client", func(m Metrics) []AuthOption {
+			return []AuthOption{WithCustomHTTPClient(&http.Client{Timeout: time.Second}), WithMetrics(m)}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &stubMetrics{}
+			client, err := NewAuthenticatedClient(auth.APICredentials{}, srv.URL, tt.opts(m)...)
+			if err != nil {
+				t.Fatalf("NewAuthenticatedClient() error = %v", err)
+			}
+
+			ctx := context.Background()
+			if _, err := client.Client().GetV1GettickerWithResponse(ctx, &GetV1GettickerParams{ProductCode: "BTC_JPY"}); err != nil {
+				t.Fatalf("GetV1Getticker() error = %v", err)
+			}
+			if _, err := client.Client().GetV1MeGetbalanceWithResponse(ctx); err != nil {
+				t.Fatalf("GetV1MeGetbalance() error = %v", err)
+			}
+
+			want := []observation{
+				{"/v1/getticker", http.MethodGet, http.StatusOK},
+				{"/v1/me/getbalance", http.MethodGet, http.StatusUnauthorized},
+			}
+			if len(m.observations) != len(want) {
+				t.Fatalf("Expected %d observations, got %+v", len(want), m.observations)
+			}
+			for i := range want {
+				if m.observations[i] != want[i] {
+					t.Errorf("Observation %d = %+v, want %+v", i, m.observations[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWithMetrics_TransportError(t *testing.T) {
+	m := &stubMetrics{}
+	client, err := NewAuthenticatedClient(auth.APICredentials{}, "http://127.0.0.1:1", WithMetrics(m))
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient() error = %v", err)
+	}
+	if _, err := client.Client().GetV1GethealthWithResponse(context.Background(), &GetV1GethealthParams{ProductCode: "BTC_JPY"}); err == nil {
+		t.Fatal("Expected a connection error")
+	}
+	if len(m.observations) != 1 || m.observations[0].statusCode != 0 {
+		t.Errorf("Expected one observation with status code 0, got %+v", m.observations)
+	}
+}
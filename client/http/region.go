@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Region is a bitFlyer Lightning region
+type Region string
+
+const (
+	RegionJP Region = "JP"
+	RegionUS Region = "US"
+	RegionEU Region = "EU"
+)
+
+// RegionInfo holds the conventions of a region
+type RegionInfo struct {
+	Region          Region
+	Currency        string   // Quote currency of the region
+	DefaultProducts []string // Product codes traded in the region
+}
+
+// regions holds the conventions of each known region
+var regions = map[Region]RegionInfo{
+	RegionJP: {
+		Region:          RegionJP,
+		Currency:        "JPY",
+		DefaultProducts: []string{"BTC_JPY", "XRP_JPY", "ETH_JPY", "XLM_JPY", "MONA_JPY", "ETH_BTC", "BCH_BTC", "FX_BTC_JPY"},
+	},
+	RegionUS: {
+		Region:          RegionUS,
+		Currency:        "USD",
+		DefaultProducts: []string{"BTC_USD"},
+	},
+	RegionEU: {
+		Region:          RegionEU,
+		Currency:        "EUR",
+		DefaultProducts: []string{"BTC_EUR"},
+	},
+}
+
+// Info returns the conventions of the region
+func (r Region) Info() (RegionInfo, error) {
+	info, ok := regions[r]
+	if !ok {
+		return RegionInfo{}, fmt.Errorf("unknown region: %s", r)
+	}
+	// Copy the slice so callers cannot modify the shared table
+	info.DefaultProducts = append([]string(nil), info.DefaultProducts...)
+	return info, nil
+}
+
+// WithRegion selects the region whose market and chat endpoints are used
+func WithRegion(region Region) AuthOption {
+	return func(c *AuthenticatedClient) {
+		if _, ok := regions[region]; !ok {
+			c.optionErr = fmt.Errorf("unknown region: %s", region)
+			return
+		}
+		c.region = region
+	}
+}
+
+// Region returns the region of the client
+func (c *AuthenticatedClient) Region() Region {
+	return c.region
+}
+
+// RegionInfo returns the conventions of the client's region
+func (c *AuthenticatedClient) RegionInfo() RegionInfo {
+	info, _ := c.region.Info()
+	return info
+}
+
+// GetMarkets returns the markets of the client's region
+func (c *AuthenticatedClient) GetMarkets(ctx context.Context) ([]Market, error) {
+	var (
+		statusCode int
+		body       []byte
+		markets    *[]Market
+	)
+
+	switch c.region {
+	case RegionUS:
+		resp, err := c.client.GetV1GetmarketsUsaWithResponse(ctx)
+		if err != nil {
+			return nil, err
+		}
+		statusCode, body, markets = resp.StatusCode(), resp.Body, resp.JSON200
+	case RegionEU:
+		resp, err := c.client.GetV1GetmarketsEuWithResponse(ctx)
+		if err != nil {
+			return nil, err
+		}
+		statusCode, body, markets = resp.StatusCode(), resp.Body, resp.JSON200
+	default:
+		resp, err := c.client.GetV1GetmarketsWithResponse(ctx)
+		if err != nil {
+			return nil, err
+		}
+		statusCode, body, markets = resp.StatusCode(), resp.Body, resp.JSON200
+	}
+
+	if err := CheckResponse(statusCode, body); err != nil {
+		return nil, err
+	}
+	if markets == nil {
+		return nil, nil
+	}
+	return *markets, nil
+}
+
+// GetChats returns the chat log of the client's region.
+// A zero fromDate returns the last five days.
+func (c *AuthenticatedClient) GetChats(ctx context.Context, fromDate time.Time) ([]ChatMessage, error) {
+	var from *FromDate
+	if !fromDate.IsZero() {
+		from = &fromDate
+	}
+
+	var (
+		statusCode int
+		body       []byte
+		chats      *[]ChatMessage
+	)
+
+	switch c.region {
+	case RegionUS:
+		resp, err := c.client.GetV1GetchatsUsaWithResponse(ctx, &GetV1GetchatsUsaParams{FromDate: from})
+		if err != nil {
+			return nil, err
+		}
+		statusCode, body, chats = resp.StatusCode(), resp.Body, resp.JSON200
+	case RegionEU:
+		resp, err := c.client.GetV1GetchatsEuWithResponse(ctx, &GetV1GetchatsEuParams{FromDate: from})
+		if err != nil {
+			return nil, err
+		}
+		statusCode, body, chats = resp.StatusCode(), resp.Body, resp.JSON200
+	default:
+		resp, err := c.client.GetV1GetchatsWithResponse(ctx, &GetV1GetchatsParams{FromDate: from})
+		if err != nil {
+			return nil, err
+		}
+		statusCode, body, chats = resp.StatusCode(), resp.Body, resp.JSON200
+	}
+
+	if err := CheckResponse(statusCode, body); err != nil {
+		return nil, err
+	}
+	if chats == nil {
+		return nil, nil
+	}
+	return *chats, nil
+}
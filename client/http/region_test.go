@@ -0,0 +1,131 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+)
+
+func TestRegionInfo(t *testing.T) {
+	tests := []struct {
+		region   Region
+		currency string
+		product  string
+		wantErr  bool
+	}{
+		{RegionJP, "JPY", "BTC_JPY", false},
+		{RegionUS, "USD", "BTC_USD", false},
+		{RegionEU, "EUR", "BTC_EUR", false},
+		{Region("XX"), "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.region), func(t *testing.T) {
+			info, err := tt.region.Info()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Info() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if info.Currency != tt.currency {
+				t.Errorf("Expected currency %s, got %s", tt.currency, info.Currency)
+			}
+			if len(info.DefaultProducts) == 0 || info.DefaultProducts[0] != tt.product {
+				t.Errorf("Expected default product %s, got %v", tt.product, info.DefaultProducts)
+			}
+		})
+	}
+}
+
+func TestWithRegion_Unknown(t *testing.T) {
+	_, err := NewAuthenticatedClient(auth.APICredentials{}, "", WithRegion(Region("XX")))
+	if err == nil {
+		t.Fatal("Expected error for unknown region, got nil")
+	}
+}
+
+func TestRegionEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/getmarkets", "/v1/getmarkets/usa", "/v1/getmarkets/eu":
+			_ = json.NewEncoder(w).Encode([]Market{{ProductCode: str(r.URL.Path)}})
+		case "/v1/getchats", "/v1/getchats/usa", "/v1/getchats/eu":
+			if r.URL.Query().Get("from_date") == "" {
+				t.Errorf("Expected from_date query parameter")
+			}
+			_ = json.NewEncoder(w).Encode([]ChatMessage{{Message: str(r.URL.Path)}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		region      Region
+		marketsPath string
+		chatsPath   string
+	}{
+		{RegionJP, "/v1/getmarkets", "/v1/getchats"},
+		{RegionUS, "/v1/getmarkets/usa", "/v1/getchats/usa"},
+		{RegionEU, "/v1/getmarkets/eu", "/v1/getchats/eu"},
+	}
+
+	// Clients for several regions can live side by side in one process
+	clients := make(map[Region]*AuthenticatedClient)
+	for _, tt := range tests {
+		client, err := NewAuthenticatedClient(auth.APICredentials{}, srv.URL, WithRegion(tt.region))
+		if err != nil {
+			t.Fatalf("NewAuthenticatedClient() error = %v", err)
+		}
+		clients[tt.region] = client
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(string(tt.region), func(t *testing.T) {
+			client := clients[tt.region]
+			if client.Region() != tt.region {
+				t.Errorf("Expected region %s, got %s", tt.region, client.Region())
+			}
+
+			markets, err := client.GetMarkets(ctx)
+			if err != nil {
+				t.Fatalf("GetMarkets() error = %v", err)
+			}
+			if len(markets) != 1 || *markets[0].ProductCode != tt.marketsPath {
+				t.Errorf("Expected markets from %s, got %+v", tt.marketsPath, markets)
+			}
+
+			chats, err := client.GetChats(ctx, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatalf("GetChats() error = %v", err)
+			}
+			if len(chats) != 1 || *chats[0].Message != tt.chatsPath {
+				t.Errorf("Expected chats from %s, got %+v", tt.chatsPath, chats)
+			}
+		})
+	}
+}
+
+func TestWithCustomHTTPClient_KeepsBaseURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAuthenticatedClient(auth.APICredentials{}, srv.URL, WithCustomHTTPClient(&http.Client{Timeout: time.Second}))
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient() error = %v", err)
+	}
+	if _, err := client.GetMarkets(context.Background()); err != nil {
+		t.Errorf("Expected request to reach the configured base URL, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+// Package resttest provides a fake bitFlyer HTTP API server for tests.
+//
+// Tests describe the API with an http.Handler and get an authenticated
+// client that sends its requests to it.
+package resttest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// Credentials are the API credentials of the clients returned by NewClient
+var Credentials = auth.APICredentials{APIKey: "key", APISecret: "secret"}
+
+// NewClient starts a server that serves every request with the handler and
+// returns an authenticated client of it. The server is closed when the test
+// ends.
+func NewClient(t testing.TB, handler http.Handler, opts ...bfhttp.AuthOption) *bfhttp.AuthenticatedClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	ac, err := bfhttp.NewAuthenticatedClient(Credentials, srv.URL, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return ac
+}
@@ -0,0 +1,28 @@
+package resttest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	client := NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/me/getbalance" {
+			t.Errorf("Expected path /v1/me/getbalance, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("ACCESS-KEY"); got != Credentials.APIKey {
+			t.Errorf("ACCESS-KEY = %q, want %q", got, Credentials.APIKey)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"currency_code":"JPY","amount":1000,"available":1000}]`))
+	}))
+
+	resp, err := client.Client().GetV1MeGetbalanceWithResponse(context.Background())
+	if err != nil {
+		t.Fatalf("GetV1MeGetbalance() error = %v", err)
+	}
+	if resp.JSON200 == nil || len(*resp.JSON200) != 1 {
+		t.Fatalf("Unexpected response %s", resp.Body)
+	}
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/tracing"
+)
+
+// orderEndpoint is the endpoint whose responses carry the acceptance ID
+// that links a submission to the realtime child_order_events
+const orderEndpoint = "/v1/me/sendchildorder"
+
+// WithTracing starts a client span around every request. Spans carry the
+// endpoint, method, product code and status code; headers, bodies and
+// signatures are never recorded. When linker is not nil, order submissions
+// are linked to their realtime events by acceptance ID.
+func WithTracing(provider trace.TracerProvider, linker *tracing.OrderLinker) AuthOption {
+	return func(c *AuthenticatedClient) {
+		c.transport.tracer = provider.Tracer(tracing.InstrumentationName)
+		c.transport.linker = linker
+	}
+}
+
+// startSpan starts the span of a request
+func (t *authenticatedTransport) startSpan(req *http.Request) (*http.Request, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.URL.Path),
+		attribute.String("server.address", req.URL.Host),
+	}
+	if productCode := requestProductCode(req); productCode != "" {
+		attrs = append(attrs, attribute.String("bitflyer.product_code", productCode))
+	}
+
+	ctx, span := t.tracer.Start(req.Context(), req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return req.WithContext(ctx), span
+}
+
+// endSpan records the outcome of a request and ends its span
+func (t *authenticatedTransport) endSpan(span trace.Span, req *http.Request, resp *http.Response, err error) {
+	defer span.End()
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		return
+	}
+
+	if t.linker != nil && req.URL.Path == orderEndpoint {
+		if acceptanceID := responseAcceptanceID(resp); acceptanceID != "" {
+			span.SetAttributes(attribute.String("bitflyer.child_order_acceptance_id", acceptanceID))
+			t.linker.Link(acceptanceID, span.SpanContext())
+		}
+	}
+}
+
+// requestProductCode returns the product code from the query or the JSON body
+func requestProductCode(req *http.Request) string {
+	if productCode := req.URL.Query().Get("product_code"); productCode != "" {
+		return productCode
+	}
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	var payload struct {
+		ProductCode string `json:"product_code"`
+	}
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		return ""
+	}
+	return payload.ProductCode
+}
+
+// responseAcceptanceID reads the acceptance ID of an order submission and
+// restores the body for the caller
+func responseAcceptanceID(resp *http.Response) string {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		ChildOrderAcceptanceID string `json:"child_order_acceptance_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return payload.ChildOrderAcceptanceID
+}
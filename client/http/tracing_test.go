@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	"github.com/bmf-san/go-bitflyer-api-client/client/tracing"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestWithTracing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/me/sendchildorder":
+			_, _ = w.Write([]byte(`{"child_order_acceptance_id":"JRF20150707-050237-639234"}`))
+		case "/v1/me/getbalance":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status":-500,"error_message":"Key not found"}`))
+		default:
+			_, _ = w.Write([]byte(`{"product_code":"BTC_JPY"}`))
+		}
+	}))
+	defer srv.Close()
+
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	linker := tracing.NewOrderLinker()
+
+	credentials := auth.APICredentials{APIKey: "test-key", APISecret: "test-secret"}
+	client, err := NewAuthenticatedClient(credentials, srv.URL, WithTracing(provider, linker))
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := client.Client().GetV1GettickerWithResponse(ctx, &GetV1GettickerParams{ProductCode: "FX_BTC_JPY"}); err != nil {
+		t.Fatalf("GetV1Getticker() error = %v", err)
+	}
+	price := float32(5000000)
+	resp, err := client.Client().PostV1MeSendchildorderWithResponse(ctx, PostV1MeSendchildorderJSONRequestBody{
+		ProductCode:    "BTC_JPY",
+		ChildOrderType: "LIMIT",
+		Side:           "BUY",
+		Price:          &price,
+		Size:           0.01,
+	})
+	if err != nil {
+		t.Fatalf("PostV1MeSendchildorder() error = %v", err)
+	}
+	if resp.JSON200 == nil || resp.JSON200.ChildOrderAcceptanceId == nil {
+		t.Fatalf("Expected the response body to be intact, got %s", resp.Body)
+	}
+	if _, err := client.Client().GetV1MeGetbalanceWithResponse(ctx); err != nil {
+		t.Fatalf("GetV1MeGetbalance() error = %v", err)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+
+	ticker := spanAttributes(spans[0])
+	if spans[0].Name() != "GET /v1/getticker" {
+		t.Errorf("Unexpected span name %q", spans[0].Name())
+	}
+	if got := ticker["bitflyer.product_code"].AsString(); got != "FX_BTC_JPY" {
+		t.Errorf("Expected product code FX_BTC_JPY from the query, got %q", got)
+	}
+	if got := ticker["http.response.status_code"].AsInt64(); got != 200 {
+		t.Errorf("Expected status code 200, got %d", got)
+	}
+
+	order := spanAttributes(spans[1])
+	if got := order["bitflyer.product_code"].AsString(); got != "BTC_JPY" {
+		t.Errorf("Expected product code BTC_JPY from the body, got %q", got)
+	}
+	if got := order["bitflyer.child_order_acceptance_id"].AsString(); got != "JRF20150707-050237-639234" {
+		t.Errorf("Unexpected acceptance ID %q", got)
+	}
+	sc, ok := linker.SpanContext("JRF20150707-050237-639234")
+	if !ok || sc.SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("Expected the submission span to be linked")
+	}
+
+	if spans[2].Status().Code != codes.Error {
+		t.Errorf("Expected error status for 401, got %v", spans[2].Status())
+	}
+
+	for _, span := range spans {
+		for _, kv := range span.Attributes() {
+			v := kv.Value.Emit()
+			if strings.Contains(v, "test-key") || strings.Contains(v, "test-secret") {
+				t.Errorf("Span %q leaks credentials in %s", span.Name(), kv.Key)
+			}
+			if strings.HasPrefix(strings.ToLower(string(kv.Key)), "http.request.header") {
+				t.Errorf("Span %q records header %s", span.Name(), kv.Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,432 @@
+// Package indicator provides streaming technical indicators over candles.
+// Every indicator updates in constant time per bar. Periods below 1 are
+// taken as 1.
+package indicator
+
+import (
+	"math"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/candle"
+)
+
+// Indicator is updated with every closed bar.
+// *SMA, *EMA, *RSI, *MACD, *Bollinger, *ATR and *Stochastic implement this
+// interface.
+type Indicator interface {
+	Update(c candle.Candle)
+	// Ready reports whether enough bars were seen for a value
+	Ready() bool
+}
+
+// Feed returns a bar handler that updates every indicator, to be passed to
+// candle.Builder.OnClose
+func Feed(indicators ...Indicator) func(candle.Candle) {
+	return func(c candle.Candle) {
+		for _, i := range indicators {
+			i.Update(c)
+		}
+	}
+}
+
+// ring is a fixed-size window of the latest values
+type ring struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newRing(n int) *ring {
+	return &ring{values: make([]float64, n)}
+}
+
+// push adds a value and returns the value it replaced, if the ring was full
+func (r *ring) push(v float64) (old float64, evicted bool) {
+	old, evicted = r.values[r.next], r.full
+	r.values[r.next] = v
+	r.next++
+	if r.next == len(r.values) {
+		r.next = 0
+		r.full = true
+	}
+	return old, evicted
+}
+
+// SMA is the simple moving average of the last n values
+type SMA struct {
+	window *ring
+	sum    float64
+}
+
+// NewSMA creates a simple moving average over n bars
+func NewSMA(n int) *SMA {
+	return &SMA{window: newRing(max(n, 1))}
+}
+
+// Update adds the close of a bar
+func (s *SMA) Update(c candle.Candle) {
+	s.Add(c.Close)
+}
+
+// Add adds a value
+func (s *SMA) Add(v float64) {
+	s.sum += v
+	if old, evicted := s.window.push(v); evicted {
+		s.sum -= old
+	}
+}
+
+// Ready reports whether n values were added
+func (s *SMA) Ready() bool {
+	return s.window.full
+}
+
+// Value returns the average, zero until ready
+func (s *SMA) Value() float64 {
+	if !s.Ready() {
+		return 0
+	}
+	return s.sum / float64(len(s.window.values))
+}
+
+// EMA is the exponential moving average with a smoothing factor of
+// 2/(n+1), seeded with the simple average of the first n values
+type EMA struct {
+	n     int
+	alpha float64
+	count int
+	sum   float64
+	value float64
+}
+
+// NewEMA creates an exponential moving average over n bars
+func NewEMA(n int) *EMA {
+	n = max(n, 1)
+	return &EMA{n: n, alpha: 2 / float64(n+1)}
+}
+
+// Update adds the close of a bar
+func (e *EMA) Update(c candle.Candle) {
+	e.Add(c.Close)
+}
+
+// Add adds a value
+func (e *EMA) Add(v float64) {
+	e.count++
+	switch {
+	case e.count < e.n:
+		e.sum += v
+	case e.count == e.n:
+		e.value = (e.sum + v) / float64(e.n)
+	default:
+		e.value += e.alpha * (v - e.value)
+	}
+}
+
+// Ready reports whether n values were added
+func (e *EMA) Ready() bool {
+	return e.count >= e.n
+}
+
+// Value returns the average, zero until ready
+func (e *EMA) Value() float64 {
+	return e.value
+}
+
+// RSI is Wilder's relative strength index, from 0 to 100
+type RSI struct {
+	n         int
+	started   bool
+	count     int // number of changes
+	lastClose float64
+	avgGain   float64
+	avgLoss   float64
+}
+
+// NewRSI creates a relative strength index over n bars, commonly 14
+func NewRSI(n int) *RSI {
+	return &RSI{n: max(n, 1)}
+}
+
+// Update adds the close of a bar
+func (r *RSI) Update(c candle.Candle) {
+	r.Add(c.Close)
+}
+
+// Add adds a value
+func (r *RSI) Add(v float64) {
+	if !r.started {
+		r.started = true
+		r.lastClose = v
+		return
+	}
+	change := v - r.lastClose
+	r.lastClose = v
+	gain, loss := max(change, 0), max(-change, 0)
+
+	r.count++
+	if r.count <= r.n {
+		// The first averages are simple averages of n changes
+		r.avgGain += gain / float64(r.n)
+		r.avgLoss += loss / float64(r.n)
+		return
+	}
+	r.avgGain = (r.avgGain*float64(r.n-1) + gain) / float64(r.n)
+	r.avgLoss = (r.avgLoss*float64(r.n-1) + loss) / float64(r.n)
+}
+
+// Ready reports whether n changes were seen
+func (r *RSI) Ready() bool {
+	return r.count >= r.n
+}
+
+// Value returns the index, zero until ready
+func (r *RSI) Value() float64 {
+	if !r.Ready() {
+		return 0
+	}
+	if r.avgLoss == 0 {
+		return 100
+	}
+	return 100 - 100/(1+r.avgGain/r.avgLoss)
+}
+
+// MACDValue is the output of MACD
+type MACDValue struct {
+	MACD      float64 // fast EMA - slow EMA
+	Signal    float64 // EMA of MACD
+	Histogram float64 // MACD - Signal
+}
+
+// MACD is the moving average convergence divergence
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+	value  MACDValue
+}
+
+// NewMACD creates a MACD, commonly with periods 12, 26 and 9
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+// Update adds the close of a bar
+func (m *MACD) Update(c candle.Candle) {
+	m.Add(c.Close)
+}
+
+// Add adds a value
+func (m *MACD) Add(v float64) {
+	m.fast.Add(v)
+	m.slow.Add(v)
+	if !m.fast.Ready() || !m.slow.Ready() {
+		return
+	}
+	m.value.MACD = m.fast.Value() - m.slow.Value()
+	m.signal.Add(m.value.MACD)
+	if m.signal.Ready() {
+		m.value.Signal = m.signal.Value()
+		m.value.Histogram = m.value.MACD - m.value.Signal
+	}
+}
+
+// Ready reports whether the signal line has a value
+func (m *MACD) Ready() bool {
+	return m.signal.Ready()
+}
+
+// Value returns the MACD, zero until ready
+func (m *MACD) Value() MACDValue {
+	if !m.Ready() {
+		return MACDValue{}
+	}
+	return m.value
+}
+
+// Bands is the output of Bollinger
+type Bands struct {
+	Upper  float64
+	Middle float64
+	Lower  float64
+}
+
+// Bollinger are the Bollinger Bands: the simple moving average plus and
+// minus k population standard deviations
+type Bollinger struct {
+	k       float64
+	window  *ring
+	started bool
+	shift   float64 // first value; sums are of deviations from it for precision
+	sum     float64
+	sumSq   float64
+}
+
+// NewBollinger creates Bollinger Bands over n bars, commonly 20 and 2
+func NewBollinger(n int, k float64) *Bollinger {
+	return &Bollinger{k: k, window: newRing(max(n, 1))}
+}
+
+// Update adds the close of a bar
+func (b *Bollinger) Update(c candle.Candle) {
+	b.Add(c.Close)
+}
+
+// Add adds a value
+func (b *Bollinger) Add(v float64) {
+	if !b.started {
+		b.started = true
+		b.shift = v
+	}
+	v -= b.shift
+	b.sum += v
+	b.sumSq += v * v
+	if old, evicted := b.window.push(v); evicted {
+		b.sum -= old
+		b.sumSq -= old * old
+	}
+}
+
+// Ready reports whether n values were added
+func (b *Bollinger) Ready() bool {
+	return b.window.full
+}
+
+// Value returns the bands, zero until ready
+func (b *Bollinger) Value() Bands {
+	if !b.Ready() {
+		return Bands{}
+	}
+	n := float64(len(b.window.values))
+	mean := b.sum / n
+	dev := b.k * math.Sqrt(max(b.sumSq/n-mean*mean, 0))
+	mean += b.shift
+	return Bands{Upper: mean + dev, Middle: mean, Lower: mean - dev}
+}
+
+// ATR is Wilder's average true range
+type ATR struct {
+	n         int
+	count     int
+	lastClose float64
+	value     float64
+}
+
+// NewATR creates an average true range over n bars, commonly 14
+func NewATR(n int) *ATR {
+	return &ATR{n: max(n, 1)}
+}
+
+// Update adds a bar
+func (a *ATR) Update(c candle.Candle) {
+	tr := c.High - c.Low
+	if a.count > 0 {
+		tr = max(tr, math.Abs(c.High-a.lastClose), math.Abs(c.Low-a.lastClose))
+	}
+	a.lastClose = c.Close
+
+	a.count++
+	if a.count <= a.n {
+		// The first average is the simple average of n true ranges
+		a.value += tr / float64(a.n)
+		return
+	}
+	a.value = (a.value*float64(a.n-1) + tr) / float64(a.n)
+}
+
+// Ready reports whether n bars were seen
+func (a *ATR) Ready() bool {
+	return a.count >= a.n
+}
+
+// Value returns the average true range, zero until ready
+func (a *ATR) Value() float64 {
+	if !a.Ready() {
+		return 0
+	}
+	return a.value
+}
+
+// StochasticValue is the output of Stochastic
+type StochasticValue struct {
+	K float64 // %K
+	D float64 // %D, the simple moving average of %K
+}
+
+// Stochastic is the stochastic oscillator, from 0 to 100. %K is 50 when
+// the high and low of the window are equal.
+type Stochastic struct {
+	n     int
+	count int
+	highs monotonic
+	lows  monotonic
+	d     *SMA
+	k     float64
+}
+
+// NewStochastic creates a stochastic oscillator with %K over n bars and %D
+// over d values of %K, commonly 14 and 3
+func NewStochastic(n, d int) *Stochastic {
+	return &Stochastic{
+		n:     max(n, 1),
+		highs: monotonic{better: func(a, b float64) bool { return a >= b }},
+		lows:  monotonic{better: func(a, b float64) bool { return a <= b }},
+		d:     NewSMA(d),
+	}
+}
+
+// Update adds a bar
+func (s *Stochastic) Update(c candle.Candle) {
+	s.highs.push(s.count, c.High, s.n)
+	s.lows.push(s.count, c.Low, s.n)
+	s.count++
+	if s.count < s.n {
+		return
+	}
+
+	high, low := s.highs.best(), s.lows.best()
+	s.k = 50
+	if high > low {
+		s.k = (c.Close - low) / (high - low) * 100
+	}
+	s.d.Add(s.k)
+}
+
+// Ready reports whether %D has a value
+func (s *Stochastic) Ready() bool {
+	return s.d.Ready()
+}
+
+// Value returns %K and %D, zero until ready
+func (s *Stochastic) Value() StochasticValue {
+	if !s.Ready() {
+		return StochasticValue{}
+	}
+	return StochasticValue{K: s.k, D: s.d.Value()}
+}
+
+// monotonic is a deque of candidates for the best value of a sliding
+// window, giving the best in amortized constant time
+type monotonic struct {
+	better func(a, b float64) bool
+	index  []int
+	values []float64
+}
+
+// push adds the value at index i to a window of size n
+func (m *monotonic) push(i int, v float64, n int) {
+	for len(m.values) > 0 && m.better(v, m.values[len(m.values)-1]) {
+		m.index = m.index[:len(m.index)-1]
+		m.values = m.values[:len(m.values)-1]
+	}
+	m.index = append(m.index, i)
+	m.values = append(m.values, v)
+	for m.index[0] <= i-n {
+		m.index = m.index[1:]
+		m.values = m.values[1:]
+	}
+}
+
+// best returns the best value in the window
+func (m *monotonic) best() float64 {
+	return m.values[0]
+}
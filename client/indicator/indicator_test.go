@@ -0,0 +1,218 @@
+package indicator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/candle"
+)
+
+func almostEqual(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+// Closes of the 14-day RSI example published by StockCharts
+var rsiCloses = []float64{
+	44.3389, 44.0902, 44.1497, 43.6124, 44.3278, 44.8264, 45.0955, 45.4245, 45.8433, 46.0826,
+	45.8931, 46.0328, 45.6140, 46.2820, 46.2820, 46.0028, 46.0328, 46.4116, 46.2222, 45.6439,
+	46.2122, 46.2521, 45.7137, 46.4515, 45.7835, 45.3548, 44.0288, 44.1783, 44.2181, 44.5672,
+	43.4205, 42.6628, 43.1314,
+}
+
+// RSI from the 15th close onward, rounded to two decimals
+var rsiWant = []float64{
+	70.53, 66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38,
+	54.71, 50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77,
+}
+
+func TestRSI(t *testing.T) {
+	rsi := NewRSI(14)
+	for i, c := range rsiCloses {
+		rsi.Update(candle.Candle{Close: c})
+		if i < 14 {
+			if rsi.Ready() {
+				t.Fatalf("Expected RSI not ready after %d closes", i+1)
+			}
+			continue
+		}
+		if got, want := rsi.Value(), rsiWant[i-14]; !almostEqual(got, want, 0.01) {
+			t.Errorf("RSI after close %d = %.4f, want %.2f", i+1, got, want)
+		}
+	}
+}
+
+func TestSMAAndEMA(t *testing.T) {
+	sma, ema := NewSMA(3), NewEMA(3)
+	feed := Feed(sma, ema)
+	for _, c := range []float64{1, 2, 3, 4, 5} {
+		feed(candle.Candle{Close: c})
+	}
+	if !sma.Ready() || sma.Value() != 4 {
+		t.Errorf("SMA = %v, want 4", sma.Value())
+	}
+	// Seeded with the average of 1, 2, 3, then (4-2)/2 and (5-3)/2 added
+	if !ema.Ready() || !almostEqual(ema.Value(), 4, 1e-12) {
+		t.Errorf("EMA = %v, want 4", ema.Value())
+	}
+
+	sma = NewSMA(3)
+	sma.Add(1)
+	if sma.Ready() || sma.Value() != 0 {
+		t.Error("Expected SMA not ready")
+	}
+}
+
+func TestNonPositivePeriod(t *testing.T) {
+	// Taken as one bar: the value is the last close
+	for _, n := range []int{0, -1} {
+		sma, ema, bollinger := NewSMA(n), NewEMA(n), NewBollinger(n, 2)
+		feed := Feed(sma, ema, bollinger, NewRSI(n), NewATR(n), NewStochastic(n, n))
+		for _, c := range []float64{1, 2, 3} {
+			feed(candle.Candle{Open: c, High: c, Low: c, Close: c})
+		}
+		if !sma.Ready() || sma.Value() != 3 {
+			t.Errorf("SMA(%d) = %v, want 3", n, sma.Value())
+		}
+		if !ema.Ready() || ema.Value() != 3 {
+			t.Errorf("EMA(%d) = %v, want 3", n, ema.Value())
+		}
+		if b := bollinger.Value(); !bollinger.Ready() || b != (Bands{Upper: 3, Middle: 3, Lower: 3}) {
+			t.Errorf("Bollinger(%d) = %+v, want 3", n, b)
+		}
+	}
+}
+
+func TestMACD(t *testing.T) {
+	macd := NewMACD(2, 3, 2)
+	closes := []float64{10, 11, 12, 11, 13}
+	for _, c := range closes[:3] {
+		macd.Add(c)
+	}
+	if macd.Ready() {
+		t.Fatal("Expected MACD not ready before the signal line")
+	}
+	for _, c := range closes[3:] {
+		macd.Add(c)
+	}
+
+	// Fast EMA(2): 10.5, 11.5, 11.1667, 12.3889
+	// Slow EMA(3): 11, 11, 12
+	// MACD: 0.5, 0.1667, 0.3889; signal EMA(2): 0.3333, 0.3704
+	want := MACDValue{MACD: 0.388889, Signal: 0.370370, Histogram: 0.018519}
+	got := macd.Value()
+	if !almostEqual(got.MACD, want.MACD, 1e-6) || !almostEqual(got.Signal, want.Signal, 1e-6) ||
+		!almostEqual(got.Histogram, want.Histogram, 1e-6) {
+		t.Errorf("MACD = %+v, want %+v", got, want)
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	bands := NewBollinger(4, 2)
+	for _, c := range []float64{1, 2, 4, 4, 6, 8} {
+		bands.Add(c)
+	}
+	// Window 4, 4, 6, 8: mean 5.5, population deviation sqrt(2.75)
+	dev := 2 * math.Sqrt(2.75)
+	got := bands.Value()
+	if !almostEqual(got.Middle, 5.5, 1e-12) || !almostEqual(got.Upper, 5.5+dev, 1e-12) ||
+		!almostEqual(got.Lower, 5.5-dev, 1e-12) {
+		t.Errorf("Bands = %+v", got)
+	}
+
+	// Large prices keep their precision
+	bands = NewBollinger(2, 1)
+	for _, c := range []float64{10000001, 10000003, 10000005} {
+		bands.Add(c)
+	}
+	if got := bands.Value(); got.Middle != 10000004 || !almostEqual(got.Upper, 10000005, 1e-6) {
+		t.Errorf("Bands = %+v", got)
+	}
+
+	// A first value of zero is a value like any other
+	bands = NewBollinger(2, 1)
+	for _, c := range []float64{0, 4} {
+		bands.Add(c)
+	}
+	if got, want := bands.Value(), (Bands{Upper: 4, Middle: 2, Lower: 0}); got != want {
+		t.Errorf("Bands = %+v, want %+v", got, want)
+	}
+}
+
+func TestATR(t *testing.T) {
+	atr := NewATR(2)
+	bars := []candle.Candle{
+		{High: 10, Low: 8, Close: 9},   // TR 2
+		{High: 12, Low: 10, Close: 11}, // TR max(2, 3, 1) = 3
+		{High: 11, Low: 5, Close: 6},   // TR max(6, 0, 6) = 6
+	}
+	for _, b := range bars[:2] {
+		atr.Update(b)
+	}
+	if !atr.Ready() || atr.Value() != 2.5 {
+		t.Errorf("ATR = %v, want 2.5", atr.Value())
+	}
+	atr.Update(bars[2])
+	if got := atr.Value(); got != 4.25 {
+		t.Errorf("ATR = %v, want 4.25", got)
+	}
+}
+
+func TestStochastic(t *testing.T) {
+	stoch := NewStochastic(3, 2)
+	bars := []candle.Candle{
+		{High: 10, Low: 5, Close: 8},
+		{High: 12, Low: 6, Close: 11},
+		{High: 11, Low: 7, Close: 9},  // window high 12, low 5: %K 4/7
+		{High: 9, Low: 8, Close: 8.5}, // window high 12, low 6: %K 2.5/6
+		{High: 9, Low: 9, Close: 9},   // window high 11, low 7: %K 2/4
+	}
+	for i, b := range bars {
+		stoch.Update(b)
+		if i < 3 && stoch.Ready() {
+			t.Fatalf("Expected Stochastic not ready after %d bars", i+1)
+		}
+	}
+	want := StochasticValue{K: 50, D: (2.5/6*100 + 50) / 2}
+	if got := stoch.Value(); !almostEqual(got.K, want.K, 1e-9) || !almostEqual(got.D, want.D, 1e-9) {
+		t.Errorf("Stochastic = %+v, want %+v", got, want)
+	}
+
+	flat := NewStochastic(2, 1)
+	flat.Update(candle.Candle{High: 1, Low: 1, Close: 1})
+	flat.Update(candle.Candle{High: 1, Low: 1, Close: 1})
+	if got := flat.Value(); got.K != 50 {
+		t.Errorf("Expected %%K of 50 for a flat window, got %+v", got)
+	}
+}
+
+// naiveStochasticK recomputes %K from scratch over the last n bars
+func naiveStochasticK(bars []candle.Candle, n int) float64 {
+	window := bars[len(bars)-n:]
+	high, low := window[0].High, window[0].Low
+	for _, b := range window[1:] {
+		high, low = max(high, b.High), min(low, b.Low)
+	}
+	if high == low {
+		return 50
+	}
+	return (bars[len(bars)-1].Close - low) / (high - low) * 100
+}
+
+func TestStochastic_MatchesNaive(t *testing.T) {
+	stoch := NewStochastic(5, 1)
+	var bars []candle.Candle
+	price := 100.0
+	for i := range 200 {
+		// A deterministic zigzag with varying ranges
+		price += float64((i*7)%11) - 5
+		bar := candle.Candle{High: price + float64(i%4), Low: price - float64(i%3), Close: price}
+		bars = append(bars, bar)
+		stoch.Update(bar)
+		if len(bars) < 5 {
+			continue
+		}
+		if got, want := stoch.Value().K, naiveStochasticK(bars, 5); !almostEqual(got, want, 1e-9) {
+			t.Fatalf("Bar %d: %%K = %v, want %v", i, got, want)
+		}
+	}
+}
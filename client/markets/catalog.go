@@ -0,0 +1,238 @@
+// Package markets caches the product-code catalogue returned by the markets API.
+package markets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// ErrUnknownProduct is returned when a product code or alias is not in the catalogue
+var ErrUnknownProduct = errors.New("unknown product code")
+
+// Market is a single entry of the catalogue
+type Market struct {
+	ProductCode string
+	Alias       string // e.g. BTCJPY_MAT3M, empty for spot and FX
+	Type        http.MarketMarketType
+}
+
+// IsSpot reports whether the market is a spot market
+func (m Market) IsSpot() bool {
+	return m.Type == http.Spot
+}
+
+// IsFX reports whether the market is a Lightning FX market
+func (m Market) IsFX() bool {
+	return m.Type == http.FX
+}
+
+// IsFutures reports whether the market is a Lightning Futures market
+func (m Market) IsFutures() bool {
+	return m.Type == http.Futures
+}
+
+// Source fetches a markets list
+type Source func(ctx context.Context, ac *http.AuthenticatedClient) ([]http.Market, error)
+
+// SourceRegion fetches the markets endpoint of the client's region
+func SourceRegion(ctx context.Context, ac *http.AuthenticatedClient) ([]http.Market, error) {
+	return ac.GetMarkets(ctx)
+}
+
+// SourceJP fetches /v1/getmarkets
+func SourceJP(ctx context.Context, ac *http.AuthenticatedClient) ([]http.Market, error) {
+	resp, err := ac.Client().GetV1GetmarketsWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	return deref(resp.JSON200), nil
+}
+
+// SourceUSA fetches /v1/getmarkets/usa
+func SourceUSA(ctx context.Context, ac *http.AuthenticatedClient) ([]http.Market, error) {
+	resp, err := ac.Client().GetV1GetmarketsUsaWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	return deref(resp.JSON200), nil
+}
+
+// SourceEU fetches /v1/getmarkets/eu
+func SourceEU(ctx context.Context, ac *http.AuthenticatedClient) ([]http.Market, error) {
+	resp, err := ac.Client().GetV1GetmarketsEuWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, err
+	}
+	return deref(resp.JSON200), nil
+}
+
+// Catalog loads and refreshes the markets list and resolves aliases
+type Catalog struct {
+	ac              *http.AuthenticatedClient
+	sources         []Source
+	refreshInterval time.Duration
+
+	mu        sync.RWMutex
+	byCode    map[string]Market
+	byAlias   map[string]Market
+	updatedAt time.Time
+}
+
+// Option configures a Catalog
+type Option func(*Catalog)
+
+// WithSources sets the markets endpoints the catalogue is built from.
+// Defaults to SourceRegion.
+func WithSources(sources ...Source) Option {
+	return func(c *Catalog) {
+		c.sources = sources
+	}
+}
+
+// WithRefreshInterval sets how often Run reloads the markets list.
+// Futures product codes roll over, so the list should be refreshed periodically.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(c *Catalog) {
+		c.refreshInterval = d
+	}
+}
+
+// NewCatalog creates a new empty catalogue. Call Refresh or Run to load it.
+func NewCatalog(ac *http.AuthenticatedClient, opts ...Option) *Catalog {
+	c := &Catalog{
+		ac:              ac,
+		sources:         []Source{SourceRegion},
+		refreshInterval: time.Hour,
+		byCode:          make(map[string]Market),
+		byAlias:         make(map[string]Market),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Refresh reloads the markets list from every source.
+// The catalogue is replaced only when all sources succeed.
+func (c *Catalog) Refresh(ctx context.Context) error {
+	byCode := make(map[string]Market)
+	byAlias := make(map[string]Market)
+
+	for _, source := range c.sources {
+		list, err := source(ctx, c.ac)
+		if err != nil {
+			return fmt.Errorf("failed to load markets: %w", err)
+		}
+		for _, m := range list {
+			if m.ProductCode == nil {
+				continue
+			}
+			market := Market{ProductCode: *m.ProductCode}
+			if m.Alias != nil {
+				market.Alias = *m.Alias
+			}
+			if m.MarketType != nil {
+				market.Type = *m.MarketType
+			}
+			byCode[market.ProductCode] = market
+			if market.Alias != "" {
+				byAlias[market.Alias] = market
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byCode = byCode
+	c.byAlias = byAlias
+	c.updatedAt = time.Now()
+	return nil
+}
+
+// Run refreshes the catalogue until ctx is done. The first refresh happens immediately.
+func (c *Catalog) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		// A failed refresh keeps the previous catalogue; the next tick retries
+		_ = c.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// UpdatedAt returns the time of the last successful refresh
+func (c *Catalog) UpdatedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.updatedAt
+}
+
+// Lookup returns the market for a product code or alias
+func (c *Catalog) Lookup(codeOrAlias string) (Market, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if m, ok := c.byCode[codeOrAlias]; ok {
+		return m, true
+	}
+	m, ok := c.byAlias[codeOrAlias]
+	return m, ok
+}
+
+// Resolve returns the product code for a product code or alias
+func (c *Catalog) Resolve(codeOrAlias string) (string, error) {
+	m, ok := c.Lookup(codeOrAlias)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownProduct, codeOrAlias)
+	}
+	return m.ProductCode, nil
+}
+
+// Validate returns ErrUnknownProduct when the product code or alias is not in the catalogue
+func (c *Catalog) Validate(codeOrAlias string) error {
+	_, err := c.Resolve(codeOrAlias)
+	return err
+}
+
+// Markets returns all markets sorted by product code
+func (c *Catalog) Markets() []Market {
+	c.mu.RLock()
+	list := make([]Market, 0, len(c.byCode))
+	for _, m := range c.byCode {
+		list = append(list, m)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ProductCode < list[j].ProductCode
+	})
+	return list
+}
+
+// deref returns the list or nil
+func deref(list *[]http.Market) []http.Market {
+	if list == nil {
+		return nil
+	}
+	return *list
+}
@@ -0,0 +1,140 @@
+package markets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/http/resttest"
+)
+
+func newTestCatalog(t *testing.T, handler http.HandlerFunc, opts ...Option) *Catalog {
+	t.Helper()
+	return NewCatalog(resttest.NewClient(t, handler), opts...)
+}
+
+func TestCatalog_Refresh(t *testing.T) {
+	c := newTestCatalog(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/getmarkets" {
+			t.Errorf("Expected path /v1/getmarkets, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"product_code":"BTC_JPY","market_type":"Spot"},
+			{"product_code":"FX_BTC_JPY","market_type":"FX"},
+			{"product_code":"BTCJPY28MAR2025","alias":"BTCJPY_MAT3M","market_type":"Futures"}
+		]`))
+	})
+
+	if !c.UpdatedAt().IsZero() {
+		t.Error("Expected zero UpdatedAt before refresh")
+	}
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	m, ok := c.Lookup("BTCJPY_MAT3M")
+	if !ok {
+		t.Fatal("Expected alias to be found")
+	}
+	if m.ProductCode != "BTCJPY28MAR2025" || !m.IsFutures() {
+		t.Errorf("Unexpected market: %+v", m)
+	}
+
+	code, err := c.Resolve("BTCJPY_MAT3M")
+	if err != nil || code != "BTCJPY28MAR2025" {
+		t.Errorf("Resolve() = %s, %v", code, err)
+	}
+
+	if m, _ := c.Lookup("FX_BTC_JPY"); !m.IsFX() {
+		t.Errorf("Expected FX market, got %+v", m)
+	}
+	if m, _ := c.Lookup("BTC_JPY"); !m.IsSpot() {
+		t.Errorf("Expected Spot market, got %+v", m)
+	}
+
+	if err := c.Validate("ETH_BTC"); !errors.Is(err, ErrUnknownProduct) {
+		t.Errorf("Expected ErrUnknownProduct, got %v", err)
+	}
+
+	list := c.Markets()
+	if len(list) != 3 || list[0].ProductCode != "BTCJPY28MAR2025" {
+		t.Errorf("Unexpected markets: %+v", list)
+	}
+}
+
+func TestCatalog_Sources(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	c := newTestCatalog(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/getmarkets/usa":
+			_, _ = w.Write([]byte(`[{"product_code":"BTC_USD","market_type":"Spot"}]`))
+		case "/v1/getmarkets/eu":
+			_, _ = w.Write([]byte(`[{"product_code":"BTC_EUR","market_type":"Spot"}]`))
+		default:
+			_, _ = w.Write([]byte(`[{"product_code":"BTC_JPY","market_type":"Spot"}]`))
+		}
+	}, WithSources(SourceJP, SourceUSA, SourceEU))
+
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	for _, code := range []string{"BTC_JPY", "BTC_USD", "BTC_EUR"} {
+		if err := c.Validate(code); err != nil {
+			t.Errorf("Validate(%s) error = %v", code, err)
+		}
+	}
+	if len(paths) != 3 {
+		t.Errorf("Expected 3 requests, got %v", paths)
+	}
+}
+
+func TestCatalog_RefreshErrorKeepsPrevious(t *testing.T) {
+	fail := false
+	c := newTestCatalog(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"product_code":"BTC_JPY","market_type":"Spot"}]`))
+	})
+
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	fail = true
+	if err := c.Refresh(context.Background()); err == nil {
+		t.Fatal("Expected error from failing refresh")
+	}
+	if err := c.Validate("BTC_JPY"); err != nil {
+		t.Errorf("Expected previous catalogue to be kept, got %v", err)
+	}
+}
+
+func TestCatalog_SourceRegion(t *testing.T) {
+	ac := resttest.NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/getmarkets/eu" {
+			t.Errorf("Expected path /v1/getmarkets/eu, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"product_code":"BTC_EUR","market_type":"Spot"}]`))
+	}), bfhttp.WithRegion(bfhttp.RegionEU))
+	c := NewCatalog(ac)
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if err := c.Validate("BTC_EUR"); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
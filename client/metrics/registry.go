@@ -0,0 +1,258 @@
+// Package metrics collects REST and realtime client metrics in memory and
+// exposes them in the Prometheus text exposition format.
+//
+// A Registry implements both http.Metrics and websocket.Metrics, so one
+// registry can be passed to http.WithMetrics and websocket.WithMetrics and
+// served on /metrics. Other backends can implement those interfaces directly.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the latency histogram buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative latency histogram
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	for i, upper := range buckets {
+		if v <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// httpKey identifies a request counter
+type httpKey struct {
+	endpoint string
+	method   string
+	code     string
+}
+
+// Registry collects metrics in memory
+type Registry struct {
+	namespace string
+	buckets   []float64
+
+	mu                sync.Mutex
+	httpRequests      map[httpKey]uint64
+	httpDuration      map[string]*histogram
+	wsMessages        map[string]uint64
+	wsDecodeErrors    map[string]uint64
+	wsReconnects      uint64
+	wsHandlerDuration map[string]*histogram
+	wsQueueDepth      int
+}
+
+// Option configures a Registry
+type Option func(*Registry)
+
+// WithNamespace sets the metric name prefix, "bitflyer" by default
+func WithNamespace(namespace string) Option {
+	return func(r *Registry) {
+		r.namespace = namespace
+	}
+}
+
+// WithBuckets sets the latency histogram buckets in seconds, in ascending order
+func WithBuckets(buckets []float64) Option {
+	return func(r *Registry) {
+		r.buckets = buckets
+	}
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry(opts ...Option) *Registry {
+	r := &Registry{
+		namespace:         "bitflyer",
+		buckets:           DefaultBuckets,
+		httpRequests:      make(map[httpKey]uint64),
+		httpDuration:      make(map[string]*histogram),
+		wsMessages:        make(map[string]uint64),
+		wsDecodeErrors:    make(map[string]uint64),
+		wsHandlerDuration: make(map[string]*histogram),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ObserveHTTPRequest implements http.Metrics. Requests that failed without
+// a response are counted with the code "error".
+func (r *Registry) ObserveHTTPRequest(endpoint, method string, statusCode int, duration time.Duration) {
+	code := "error"
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.httpRequests[httpKey{endpoint: endpoint, method: method, code: code}]++
+	r.histogram(r.httpDuration, endpoint).observe(r.buckets, duration.Seconds())
+}
+
+// ObserveMessage implements websocket.Metrics
+func (r *Registry) ObserveMessage(channel string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.wsMessages[channel]++
+}
+
+// ObserveDecodeError implements websocket.Metrics
+func (r *Registry) ObserveDecodeError(channel string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.wsDecodeErrors[channel]++
+}
+
+// ObserveReconnect implements websocket.Metrics
+func (r *Registry) ObserveReconnect() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.wsReconnects++
+}
+
+// ObserveHandler implements websocket.Metrics
+func (r *Registry) ObserveHandler(channel string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.histogram(r.wsHandlerDuration, channel).observe(r.buckets, duration.Seconds())
+}
+
+// SetQueueDepth implements websocket.Metrics
+func (r *Registry) SetQueueDepth(depth int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.wsQueueDepth = depth
+}
+
+// histogram returns the histogram for the key, creating it if needed.
+// r.mu must be held.
+func (r *Registry) histogram(m map[string]*histogram, key string) *histogram {
+	h, ok := m[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		m[key] = h
+	}
+	return h
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WritePrometheus(w)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+
+	name := r.name("http_requests_total")
+	writeHeader(&b, name, "counter", "REST requests by endpoint, method and status code.")
+	keys := make([]httpKey, 0, len(r.httpRequests))
+	for k := range r.httpRequests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s{endpoint=%s,method=%s,code=%s} %d\n",
+			name, quote(k.endpoint), quote(k.method), quote(k.code), r.httpRequests[k])
+	}
+
+	r.writeHistograms(&b, r.name("http_request_duration_seconds"), "REST request latency by endpoint.", "endpoint", r.httpDuration)
+	writeCounters(&b, r.name("ws_messages_total"), "Realtime messages received by channel.", "channel", r.wsMessages)
+	writeCounters(&b, r.name("ws_decode_errors_total"), "Realtime frames or messages that could not be decoded.", "channel", r.wsDecodeErrors)
+
+	name = r.name("ws_reconnects_total")
+	writeHeader(&b, name, "counter", "Realtime reconnections.")
+	fmt.Fprintf(&b, "%s %d\n", name, r.wsReconnects)
+
+	r.writeHistograms(&b, r.name("ws_handler_duration_seconds"), "Realtime handler latency by channel.", "channel", r.wsHandlerDuration)
+
+	name = r.name("ws_queue_depth")
+	writeHeader(&b, name, "gauge", "Realtime messages received but not handled yet.")
+	fmt.Fprintf(&b, "%s %d\n", name, r.wsQueueDepth)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHistograms writes a histogram family. r.mu must be held.
+func (r *Registry) writeHistograms(b *strings.Builder, name, help, label string, m map[string]*histogram) {
+	writeHeader(b, name, "histogram", help)
+	for _, key := range sortedKeys(m) {
+		h := m[key]
+		var cumulative uint64
+		for i, upper := range r.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(b, "%s_bucket{%s=%s,le=%s} %d\n",
+				name, label, quote(key), quote(strconv.FormatFloat(upper, 'g', -1, 64)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s=%s,le=\"+Inf\"} %d\n", name, label, quote(key), h.count)
+		fmt.Fprintf(b, "%s_sum{%s=%s} %s\n", name, label, quote(key), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "%s_count{%s=%s} %d\n", name, label, quote(key), h.count)
+	}
+}
+
+// name returns the metric name with the namespace prefix
+func (r *Registry) name(name string) string {
+	if r.namespace == "" {
+		return name
+	}
+	return r.namespace + "_" + name
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeCounters(b *strings.Builder, name, help, label string, m map[string]uint64) {
+	writeHeader(b, name, "counter", help)
+	for _, key := range sortedKeys(m) {
+		fmt.Fprintf(b, "%s{%s=%s} %d\n", name, label, quote(key), m[key])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelEscaper escapes label values as required by the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// The registry must satisfy both client interfaces
+var (
+	_ bfhttp.Metrics    = (*Registry)(nil)
+	_ websocket.Metrics = (*Registry)(nil)
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry(WithBuckets([]float64{0.1, 1}))
+
+	r.ObserveHTTPRequest("/v1/getticker", "GET", 200, 50*time.Millisecond)
+	r.ObserveHTTPRequest("/v1/getticker", "GET", 200, 500*time.Millisecond)
+	r.ObserveHTTPRequest("/v1/getticker", "GET", 0, 2*time.Second)
+	r.ObserveMessage("lightning_ticker_BTC_JPY")
+	r.ObserveMessage("lightning_ticker_BTC_JPY")
+	r.ObserveDecodeError(`bad"channel`)
+	r.ObserveReconnect()
+	r.ObserveHandler("lightning_ticker_BTC_JPY", 10*time.Millisecond)
+	r.SetQueueDepth(3)
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE bitflyer_http_requests_total counter\n",
+		`bitflyer_http_requests_total{endpoint="/v1/getticker",method="GET",code="200"} 2` + "\n",
+		`bitflyer_http_requests_total{endpoint="/v1/getticker",method="GET",code="error"} 1` + "\n",
+		"# TYPE bitflyer_http_request_duration_seconds histogram\n",
+		`bitflyer_http_request_duration_seconds_bucket{endpoint="/v1/getticker",le="0.1"} 1` + "\n",
+		`bitflyer_http_request_duration_seconds_bucket{endpoint="/v1/getticker",le="1"} 2` + "\n",
+		`bitflyer_http_request_duration_seconds_bucket{endpoint="/v1/getticker",le="+Inf"} 3` + "\n",
+		`bitflyer_http_request_duration_seconds_sum{endpoint="/v1/getticker"} 2.55` + "\n",
+		`bitflyer_http_request_duration_seconds_count{endpoint="/v1/getticker"} 3` + "\n",
+		`bitflyer_ws_messages_total{channel="lightning_ticker_BTC_JPY"} 2` + "\n",
+		`bitflyer_ws_decode_errors_total{channel="bad\"channel"} 1` + "\n",
+		"bitflyer_ws_reconnects_total 1\n",
+		`bitflyer_ws_handler_duration_seconds_count{channel="lightning_ticker_BTC_JPY"} 1` + "\n",
+		"# TYPE bitflyer_ws_queue_depth gauge\n",
+		"bitflyer_ws_queue_depth 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestWithNamespace(t *testing.T) {
+	r := NewRegistry(WithNamespace("trader"))
+	r.ObserveReconnect()
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	if !strings.Contains(b.String(), "trader_ws_reconnects_total 1\n") {
+		t.Errorf("Expected namespaced metric:\n%s", b.String())
+	}
+}
+
+func TestRegistry_WithAuthenticatedClient(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"NORMAL"}`))
+	}))
+	defer api.Close()
+
+	r := NewRegistry()
+	client, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{}, api.URL, bfhttp.WithMetrics(r))
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient() error = %v", err)
+	}
+	if _, err := client.Client().GetV1GethealthWithResponse(context.Background(), &bfhttp.GetV1GethealthParams{ProductCode: "BTC_JPY"}); err != nil {
+		t.Fatalf("GetV1Gethealth() error = %v", err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	want := `bitflyer_http_requests_total{endpoint="/v1/gethealth",method="GET",code="200"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("Expected %q in scrape:\n%s", want, body)
+	}
+}
@@ -0,0 +1,581 @@
+// Package orderbook maintains a realtime order book from board snapshots
+// and diffs, checks it for integrity and resynchronizes it when diffs were
+// lost.
+package orderbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// ViolationKind identifies a failed integrity check
+type ViolationKind string
+
+const (
+	// Crossed means the best bid is at or above the best ask
+	Crossed ViolationKind = "crossed"
+	// MidPriceMismatch means the mid price of a diff does not match the book
+	MidPriceMismatch ViolationKind = "mid_price_mismatch"
+	// NegativeSize means a price level has a negative size
+	NegativeSize ViolationKind = "negative_size"
+	// MessagesLost means diffs were lost, for example across a reconnect
+	MessagesLost ViolationKind = "messages_lost"
+)
+
+// Violation is fired when the book fails an integrity check. The book is
+// unsynced until it is seeded again, so strategies should pause.
+type Violation struct {
+	ProductCode string
+	Kind        ViolationKind
+	BestBid     float64
+	BestAsk     float64
+	MidPrice    float64 // mid price reported by the message
+	Price       float64 // offending level for NegativeSize
+	Size        float64
+	Time        time.Time
+}
+
+// Source is where a resync seeded the book from
+type Source string
+
+const (
+	FromSnapshot Source = "snapshot"
+	FromREST     Source = "rest"
+)
+
+// Resync is fired when an unsynced book has been seeded again
+type Resync struct {
+	ProductCode string
+	Source      Source
+	Time        time.Time
+}
+
+// Book is the order book of a single product. Diffs are applied only while
+// the book is synced; after a violation they are dropped until the next
+// board snapshot or REST board seeds the book again. While a REST board is
+// being fetched, diffs are buffered and applied once it arrives.
+type Book struct {
+	productCode   string
+	api           *http.ClientWithResponses
+	midTolerance  float64
+	resyncTimeout time.Duration
+	resyncMu      sync.Mutex // serializes REST resyncs
+
+	mu               sync.Mutex
+	bids             map[float64]float64 // price -> size
+	asks             map[float64]float64
+	midPrice         float64
+	synced           bool
+	generation       int // incremented on every seed
+	resyncing        bool
+	buffering        bool
+	pending          []websocket.BoardData // diffs received during a REST resync
+	violationHandler func(Violation)
+	resyncHandler    func(Resync)
+	updateListeners  []*updateListener
+}
+
+// updateListener is a handler registered with OnUpdate
+type updateListener struct {
+	handler func()
+}
+
+// Listener is a handler registered with OnUpdate
+type Listener struct {
+	once   sync.Once
+	remove func()
+}
+
+// Remove unregisters the handler. An update already being notified may
+// still reach it. Remove is safe to call more than once.
+func (l *Listener) Remove() {
+	if l == nil {
+		return
+	}
+	l.once.Do(l.remove)
+}
+
+// Option configures a Book
+type Option func(*Book)
+
+// WithRESTResync enables Resync and re-seeds the book from the REST board
+// as soon as a violation is detected, instead of waiting for the next board
+// snapshot
+func WithRESTResync(ac *http.AuthenticatedClient) Option {
+	return func(b *Book) {
+		b.api = ac.Client()
+	}
+}
+
+// WithMidPriceTolerance sets the relative difference allowed between the mid
+// price of a diff and the mid price of the book, 0.0005 by default
+func WithMidPriceTolerance(ratio float64) Option {
+	return func(b *Book) {
+		b.midTolerance = ratio
+	}
+}
+
+// WithResyncTimeout sets the timeout of a REST resync, 10 seconds by default
+func WithResyncTimeout(d time.Duration) Option {
+	return func(b *Book) {
+		b.resyncTimeout = d
+	}
+}
+
+// NewBook creates an empty, unsynced book for the product
+func NewBook(productCode string, opts ...Option) *Book {
+	b := &Book{
+		productCode:   productCode,
+		midTolerance:  0.0005,
+		resyncTimeout: 10 * time.Second,
+		bids:          make(map[float64]float64),
+		asks:          make(map[float64]float64),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// OnViolation sets a callback to receive integrity violations
+func (b *Book) OnViolation(handler func(Violation)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.violationHandler = handler
+}
+
+// OnResync sets a callback to receive seeds of an unsynced book, including
+// the first one
+func (b *Book) OnResync(handler func(Resync)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resyncHandler = handler
+}
+
+// OnUpdate registers a callback called after every seed or diff that leaves
+// the book synced, once the book reflects it. Callbacks are called in the
+// order they were registered, until removed through the returned Listener.
+func (b *Book) OnUpdate(handler func()) *Listener {
+	l := &updateListener{handler: handler}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateListeners = append(b.updateListeners, l)
+
+	return &Listener{remove: func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// Copied so that a notification in progress keeps its own slice
+		b.updateListeners = slices.DeleteFunc(slices.Clone(b.updateListeners), func(x *updateListener) bool {
+			return x == l
+		})
+	}}
+}
+
+// notifyUpdate calls the update callbacks taken with b.mu held
+func notifyUpdate(listeners []*updateListener) {
+	for _, l := range listeners {
+		l.handler()
+	}
+}
+
+// Attach feeds the book from the board channels of the client and
+// invalidates it when the client reconnects. The returned function
+// detaches the book.
+func (b *Book) Attach(c *websocket.Client) (detach func()) {
+	listeners := []*websocket.Listener{
+		c.OnBoardSnapshot(b.HandleBoardSnapshot, websocket.ForProducts(b.productCode)),
+		c.OnBoard(b.HandleBoard, websocket.ForProducts(b.productCode)),
+		c.OnReconnect(b.Invalidate),
+	}
+	return func() {
+		for _, l := range listeners {
+			l.Remove()
+		}
+	}
+}
+
+// HandleBoardSnapshot seeds the book from a realtime board snapshot.
+// Snapshots for other products are ignored.
+func (b *Book) HandleBoardSnapshot(m websocket.BoardSnapshotMessage) {
+	if m.ProductCode != b.productCode {
+		return
+	}
+	b.seed(m.Data, FromSnapshot)
+}
+
+// HandleBoard applies a realtime board diff. A zero size removes the level.
+// Diffs received during a REST resync are buffered until it completes.
+// Diffs for other products, and other diffs while the book is unsynced, are
+// ignored.
+func (b *Book) HandleBoard(m websocket.BoardMessage) {
+	if m.ProductCode != b.productCode {
+		return
+	}
+
+	b.mu.Lock()
+	if b.buffering {
+		b.pending = append(b.pending, m.Data)
+		b.mu.Unlock()
+		return
+	}
+	if !b.synced {
+		b.mu.Unlock()
+		return
+	}
+	violation, failed := b.updateLocked(m.Data)
+	updateListeners := b.updateListeners
+	b.mu.Unlock()
+
+	if failed {
+		b.report(violation)
+		return
+	}
+	notifyUpdate(updateListeners)
+}
+
+// Invalidate marks the book unsynced because diffs may have been lost, for
+// example after a reconnect
+func (b *Book) Invalidate() {
+	b.mu.Lock()
+	if !b.synced {
+		b.mu.Unlock()
+		return
+	}
+	b.synced = false
+	bid, ask := b.bestLocked()
+	b.mu.Unlock()
+
+	b.report(Violation{
+		ProductCode: b.productCode,
+		Kind:        MessagesLost,
+		BestBid:     bid.Price,
+		BestAsk:     ask.Price,
+		Time:        time.Now(),
+	})
+}
+
+// Resync seeds the book from the REST board. Diffs received meanwhile are
+// buffered and applied on top of it, so calling Resync right after
+// subscribing gives a usable book within one round trip instead of waiting
+// for the first board snapshot.
+func (b *Book) Resync(ctx context.Context) error {
+	if b.api == nil {
+		return fmt.Errorf("REST resync is not configured")
+	}
+	b.resyncMu.Lock()
+	defer b.resyncMu.Unlock()
+
+	b.mu.Lock()
+	generation := b.generation
+	b.buffering = true
+	b.pending = nil
+	b.mu.Unlock()
+
+	data, err := b.fetch(ctx)
+	b.finishResync(generation, data)
+	return err
+}
+
+// fetch gets the REST board
+func (b *Book) fetch(ctx context.Context) (*websocket.BoardData, error) {
+	resp, err := b.api.GetV1GetboardWithResponse(ctx, &http.GetV1GetboardParams{
+		ProductCode: b.productCode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board of %s: %w", b.productCode, err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to get board of %s: %w", b.productCode, err)
+	}
+	// Decode the body again: the generated float32 fields cannot hold
+	// prices above 2^24 exactly, and the levels must match the realtime ones
+	var data websocket.BoardData
+	if err := json.Unmarshal(resp.Body, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode board of %s: %w", b.productCode, err)
+	}
+	return &data, nil
+}
+
+// finishResync seeds the book from the REST board, if any, and applies the
+// buffered diffs. The REST board is discarded if a snapshot seeded the book
+// since generation; the diffs buffered after that snapshot still apply.
+func (b *Book) finishResync(generation int, data *websocket.BoardData) {
+	b.mu.Lock()
+	wasSynced := b.synced
+	pending := b.pending
+	b.buffering = false
+	b.pending = nil
+
+	var violation Violation
+	var failed, seeded bool
+	if data != nil && b.generation == generation {
+		violation, failed = b.seedLocked(*data)
+		seeded = true
+	}
+	for _, diff := range pending {
+		if failed || !b.synced {
+			break
+		}
+		violation, failed = b.updateLocked(diff)
+	}
+	resynced := seeded && !wasSynced && b.synced
+	updated := (seeded || len(pending) > 0) && b.synced
+	resyncHandler := b.resyncHandler
+	updateListeners := b.updateListeners
+	b.mu.Unlock()
+
+	if failed {
+		// Failing right after a REST board waits for the next snapshot, so a
+		// bad REST board cannot loop
+		b.notify(violation)
+		return
+	}
+	if resynced && resyncHandler != nil {
+		resyncHandler(Resync{ProductCode: b.productCode, Source: FromREST, Time: time.Now()})
+	}
+	if updated {
+		notifyUpdate(updateListeners)
+	}
+}
+
+// Synced reports whether the book passed its integrity checks since it was
+// last seeded
+func (b *Book) Synced() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.synced
+}
+
+// Best returns the best bid and ask. It reports false while the book is
+// unsynced or either side is empty.
+func (b *Book) Best() (bid, ask websocket.PriceLevel, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bid, ask = b.bestLocked()
+	return bid, ask, b.synced && bid.Size > 0 && ask.Size > 0
+}
+
+// MidPrice returns the mid price of the last seed or diff
+func (b *Book) MidPrice() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.midPrice
+}
+
+// Bids returns up to depth bids from the best, or every bid if depth is zero
+func (b *Book) Bids(depth int) []websocket.PriceLevel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedLevels(b.bids, false, depth)
+}
+
+// Asks returns up to depth asks from the best, or every ask if depth is zero
+func (b *Book) Asks(depth int) []websocket.PriceLevel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedLevels(b.asks, true, depth)
+}
+
+// seed replaces the book with a snapshot. Diffs buffered before the
+// snapshot are older than it and dropped.
+func (b *Book) seed(data websocket.BoardData, source Source) {
+	b.mu.Lock()
+	wasSynced := b.synced
+	b.pending = nil
+	violation, failed := b.seedLocked(data)
+	resyncHandler := b.resyncHandler
+	updateListeners := b.updateListeners
+	b.mu.Unlock()
+
+	if failed {
+		// Only a diff starts a REST resync, so a bad snapshot cannot loop
+		b.notify(violation)
+		return
+	}
+	if !wasSynced && resyncHandler != nil {
+		resyncHandler(Resync{ProductCode: b.productCode, Source: source, Time: time.Now()})
+	}
+	notifyUpdate(updateListeners)
+}
+
+// seedLocked replaces the book and marks it synced if it passes the
+// checks. b.mu must be held.
+func (b *Book) seedLocked(data websocket.BoardData) (Violation, bool) {
+	b.bids = make(map[float64]float64, len(data.Bids))
+	b.asks = make(map[float64]float64, len(data.Asks))
+	b.midPrice = data.MidPrice
+	b.generation++
+	b.synced = true
+	// The mid price of a seed is checked too; it describes the whole book
+	return b.updateLocked(data)
+}
+
+// updateLocked applies the levels, checks the book and marks it unsynced on
+// a violation. b.mu must be held.
+func (b *Book) updateLocked(data websocket.BoardData) (Violation, bool) {
+	violation, failed := b.applyLocked(data)
+	if !failed {
+		violation, failed = b.checkLocked(data.MidPrice)
+	}
+	if failed {
+		b.synced = false
+	}
+	return violation, failed
+}
+
+// report notifies the violation and starts a REST resync if configured
+func (b *Book) report(violation Violation) {
+	b.notify(violation)
+	if b.api == nil {
+		return
+	}
+
+	b.mu.Lock()
+	if b.resyncing {
+		b.mu.Unlock()
+		return
+	}
+	b.resyncing = true
+	b.mu.Unlock()
+
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			b.resyncing = false
+			b.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), b.resyncTimeout)
+		defer cancel()
+		// On failure the book waits for the next board snapshot
+		_ = b.Resync(ctx)
+	}()
+}
+
+// notify passes the violation to the handler
+func (b *Book) notify(violation Violation) {
+	b.mu.Lock()
+	violationHandler := b.violationHandler
+	b.mu.Unlock()
+
+	if violationHandler != nil {
+		violationHandler(violation)
+	}
+}
+
+// applyLocked merges the levels into the book. It stops at the first
+// negative size and reports it. b.mu must be held.
+func (b *Book) applyLocked(data websocket.BoardData) (Violation, bool) {
+	if data.MidPrice > 0 {
+		b.midPrice = data.MidPrice
+	}
+	for _, side := range []struct {
+		book   map[float64]float64
+		levels []websocket.PriceLevel
+	}{{b.bids, data.Bids}, {b.asks, data.Asks}} {
+		for _, l := range side.levels {
+			switch {
+			case l.Size < 0:
+				bid, ask := b.bestLocked()
+				return Violation{
+					ProductCode: b.productCode,
+					Kind:        NegativeSize,
+					BestBid:     bid.Price,
+					BestAsk:     ask.Price,
+					MidPrice:    data.MidPrice,
+					Price:       l.Price,
+					Size:        l.Size,
+					Time:        time.Now(),
+				}, true
+			case l.Size == 0:
+				delete(side.book, l.Price)
+			default:
+				side.book[l.Price] = l.Size
+			}
+		}
+	}
+	return Violation{}, false
+}
+
+// checkLocked checks that the book is not crossed and that its mid price
+// matches the reported one. A zero midPrice skips the mid price check.
+// b.mu must be held.
+func (b *Book) checkLocked(midPrice float64) (Violation, bool) {
+	bid, ask := b.bestLocked()
+	if bid.Size == 0 || ask.Size == 0 {
+		return Violation{}, false
+	}
+	violation := Violation{
+		ProductCode: b.productCode,
+		BestBid:     bid.Price,
+		BestAsk:     ask.Price,
+		MidPrice:    midPrice,
+		Time:        time.Now(),
+	}
+	if bid.Price >= ask.Price {
+		violation.Kind = Crossed
+		return violation, true
+	}
+	if midPrice > 0 && math.Abs((bid.Price+ask.Price)/2-midPrice) > midPrice*b.midTolerance {
+		violation.Kind = MidPriceMismatch
+		return violation, true
+	}
+	return Violation{}, false
+}
+
+// bestLocked returns the best bid and ask, zero when a side is empty.
+// b.mu must be held.
+func (b *Book) bestLocked() (bid, ask websocket.PriceLevel) {
+	for price, size := range b.bids {
+		if bid.Size == 0 || price > bid.Price {
+			bid = websocket.PriceLevel{Price: price, Size: size}
+		}
+	}
+	for price, size := range b.asks {
+		if ask.Size == 0 || price < ask.Price {
+			ask = websocket.PriceLevel{Price: price, Size: size}
+		}
+	}
+	return bid, ask
+}
+
+// sortedLevels returns the levels of a side from the best price. With a
+// depth, only the best levels are kept while scanning, so that reading the
+// top of a deep book does not sort all of it.
+func sortedLevels(side map[float64]float64, ascending bool, depth int) []websocket.PriceLevel {
+	better := func(a, b float64) bool {
+		if ascending {
+			return a < b
+		}
+		return a > b
+	}
+	if depth <= 0 || depth >= len(side) {
+		levels := make([]websocket.PriceLevel, 0, len(side))
+		for price, size := range side {
+			levels = append(levels, websocket.PriceLevel{Price: price, Size: size})
+		}
+		sort.Slice(levels, func(i, j int) bool { return better(levels[i].Price, levels[j].Price) })
+		return levels
+	}
+
+	levels := make([]websocket.PriceLevel, 0, depth+1)
+	for price, size := range side {
+		if len(levels) == depth && !better(price, levels[depth-1].Price) {
+			continue
+		}
+		i := sort.Search(len(levels), func(i int) bool { return better(price, levels[i].Price) })
+		levels = slices.Insert(levels, i, websocket.PriceLevel{Price: price, Size: size})
+		if len(levels) > depth {
+			levels = levels[:depth]
+		}
+	}
+	return levels
+}
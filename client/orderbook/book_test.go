@@ -0,0 +1,414 @@
+package orderbook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func snapshot(mid float64, bids, asks []websocket.PriceLevel) websocket.BoardSnapshotMessage {
+	return websocket.BoardSnapshotMessage{
+		ProductCode: "BTC_JPY",
+		Data:        websocket.BoardData{MidPrice: mid, Bids: bids, Asks: asks},
+	}
+}
+
+func diff(mid float64, bids, asks []websocket.PriceLevel) websocket.BoardMessage {
+	return websocket.BoardMessage{
+		ProductCode: "BTC_JPY",
+		Data:        websocket.BoardData{MidPrice: mid, Bids: bids, Asks: asks},
+	}
+}
+
+func seededBook(t *testing.T, opts ...Option) *Book {
+	t.Helper()
+	book := NewBook("BTC_JPY", opts...)
+	book.HandleBoardSnapshot(snapshot(100,
+		[]websocket.PriceLevel{{Price: 99, Size: 1}, {Price: 98, Size: 2}},
+		[]websocket.PriceLevel{{Price: 101, Size: 1}, {Price: 102, Size: 3}},
+	))
+	if !book.Synced() {
+		t.Fatal("Expected the snapshot to sync the book")
+	}
+	return book
+}
+
+func TestHandleBoard(t *testing.T) {
+	book := seededBook(t)
+
+	book.HandleBoard(diff(100.5, []websocket.PriceLevel{{Price: 99, Size: 0}, {Price: 100, Size: 0.5}},
+		[]websocket.PriceLevel{{Price: 101, Size: 2}}))
+	book.HandleBoard(websocket.BoardMessage{ProductCode: "ETH_JPY", Data: websocket.BoardData{
+		Bids: []websocket.PriceLevel{{Price: 500, Size: 1}},
+	}})
+
+	if !book.Synced() {
+		t.Fatal("Expected the book to stay synced")
+	}
+	wantBids := []websocket.PriceLevel{{Price: 100, Size: 0.5}, {Price: 98, Size: 2}}
+	if got := book.Bids(0); !reflect.DeepEqual(got, wantBids) {
+		t.Errorf("Bids() = %v, want %v", got, wantBids)
+	}
+	wantAsks := []websocket.PriceLevel{{Price: 101, Size: 2}}
+	if got := book.Asks(1); !reflect.DeepEqual(got, wantAsks) {
+		t.Errorf("Asks(1) = %v, want %v", got, wantAsks)
+	}
+	if bid, ask, ok := book.Best(); !ok || bid.Price != 100 || ask.Price != 101 {
+		t.Errorf("Best() = %v, %v, %v", bid, ask, ok)
+	}
+	if got := book.MidPrice(); got != 100.5 {
+		t.Errorf("MidPrice() = %v, want 100.5", got)
+	}
+}
+
+func TestDepth(t *testing.T) {
+	bids := make([]websocket.PriceLevel, 0, 50)
+	asks := make([]websocket.PriceLevel, 0, 50)
+	for i := range 50 {
+		// Out of order, as in a diff
+		offset := float64((i * 7) % 50)
+		bids = append(bids, websocket.PriceLevel{Price: 99 - offset, Size: 1 + offset})
+		asks = append(asks, websocket.PriceLevel{Price: 101 + offset, Size: 1 + offset})
+	}
+	book := NewBook("BTC_JPY")
+	book.HandleBoardSnapshot(snapshot(100, bids, asks))
+
+	allBids, allAsks := book.Bids(0), book.Asks(0)
+	for _, depth := range []int{1, 3, 10, 49, 50, 60} {
+		want := min(depth, 50)
+		if got := book.Bids(depth); !reflect.DeepEqual(got, allBids[:want]) {
+			t.Errorf("Bids(%d) = %v, want %v", depth, got, allBids[:want])
+		}
+		if got := book.Asks(depth); !reflect.DeepEqual(got, allAsks[:want]) {
+			t.Errorf("Asks(%d) = %v, want %v", depth, got, allAsks[:want])
+		}
+	}
+	if allBids[0].Price != 99 || allAsks[0].Price != 101 {
+		t.Errorf("Expected the best levels first, got %v and %v", allBids[0], allAsks[0])
+	}
+}
+
+func TestOnUpdate(t *testing.T) {
+	book := seededBook(t)
+
+	var first, second int
+	l := book.OnUpdate(func() { first++ })
+	book.OnUpdate(func() { second++ })
+
+	book.HandleBoard(diff(100, []websocket.PriceLevel{{Price: 99, Size: 2}}, nil))
+	l.Remove()
+	l.Remove()
+	book.HandleBoard(diff(100, []websocket.PriceLevel{{Price: 99, Size: 3}}, nil))
+
+	if first != 1 || second != 2 {
+		t.Errorf("Expected 1 and 2 updates, got %d and %d", first, second)
+	}
+}
+
+func TestViolations(t *testing.T) {
+	tests := []struct {
+		name string
+		diff websocket.BoardMessage
+		want ViolationKind
+	}{
+		{"crossed", diff(0, []websocket.PriceLevel{{Price: 101, Size: 1}}, nil), Crossed},
+		{"mid price", diff(120, []websocket.PriceLevel{{Price: 99, Size: 5}}, nil), MidPriceMismatch},
+		{"negative size", diff(100, nil, []websocket.PriceLevel{{Price: 101, Size: -1}}), NegativeSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := seededBook(t)
+			var violations []Violation
+			book.OnViolation(func(v Violation) { violations = append(violations, v) })
+			var resyncs []Resync
+			book.OnResync(func(r Resync) { resyncs = append(resyncs, r) })
+
+			book.HandleBoard(tt.diff)
+			if len(violations) != 1 || violations[0].Kind != tt.want {
+				t.Fatalf("Expected one %s violation, got %+v", tt.want, violations)
+			}
+			if book.Synced() {
+				t.Fatal("Expected the book to be unsynced")
+			}
+			if _, _, ok := book.Best(); ok {
+				t.Error("Expected Best to fail while unsynced")
+			}
+
+			// Diffs are dropped until the next snapshot
+			book.HandleBoard(diff(0, []websocket.PriceLevel{{Price: 50, Size: 1}}, nil))
+			if len(violations) != 1 || book.Synced() {
+				t.Error("Expected diffs to be dropped while unsynced")
+			}
+
+			book.HandleBoardSnapshot(snapshot(100,
+				[]websocket.PriceLevel{{Price: 99, Size: 1}},
+				[]websocket.PriceLevel{{Price: 101, Size: 1}},
+			))
+			if !book.Synced() {
+				t.Fatal("Expected the snapshot to resync the book")
+			}
+			if len(resyncs) != 1 || resyncs[0].Source != FromSnapshot {
+				t.Errorf("Unexpected resyncs %+v", resyncs)
+			}
+			if got := book.Bids(0); len(got) != 1 || got[0].Price != 99 {
+				t.Errorf("Expected the snapshot to replace the book, got bids %v", got)
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	book := seededBook(t)
+	var violations []Violation
+	book.OnViolation(func(v Violation) { violations = append(violations, v) })
+
+	book.Invalidate()
+	book.Invalidate()
+	if len(violations) != 1 || violations[0].Kind != MessagesLost {
+		t.Errorf("Expected one messages lost violation, got %+v", violations)
+	}
+	if book.Synced() {
+		t.Error("Expected the book to be unsynced")
+	}
+}
+
+func TestRESTResync(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/getboard" || r.URL.Query().Get("product_code") != "BTC_JPY" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"mid_price":100.5,"bids":[{"price":100,"size":0.01}],"asks":[{"price":101,"size":1}]}`))
+	}))
+	defer srv.Close()
+
+	ac, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{}, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	book := seededBook(t, WithRESTResync(ac))
+	resyncs := make(chan Resync, 1)
+	book.OnResync(func(r Resync) { resyncs <- r })
+
+	book.HandleBoard(diff(0, []websocket.PriceLevel{{Price: 101, Size: 1}}, nil))
+	select {
+	case r := <-resyncs:
+		if r.Source != FromREST {
+			t.Errorf("Expected a REST resync, got %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the REST resync")
+	}
+
+	bid, ask, ok := book.Best()
+	if !ok || bid != (websocket.PriceLevel{Price: 100, Size: 0.01}) || ask.Price != 101 {
+		t.Errorf("Best() = %v, %v, %v", bid, ask, ok)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected 1 board request, got %d", got)
+	}
+
+	if err := NewBook("BTC_JPY").Resync(context.Background()); err == nil {
+		t.Error("Expected error without REST resync configured")
+	}
+}
+
+// blockingBoard serves a REST board once release is closed
+type blockingBoard struct {
+	requested chan struct{}
+	release   chan struct{}
+	body      string
+}
+
+func (s *blockingBoard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requested <- struct{}{}
+	<-s.release
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(s.body))
+}
+
+func newBlockingBook(t *testing.T, body string) (*Book, *blockingBoard) {
+	t.Helper()
+	board := &blockingBoard{
+		requested: make(chan struct{}, 1),
+		release:   make(chan struct{}),
+		body:      body,
+	}
+	srv := httptest.NewServer(board)
+	t.Cleanup(srv.Close)
+
+	ac, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{}, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return NewBook("BTC_JPY", WithRESTResync(ac)), board
+}
+
+func TestResync_BuffersDiffs(t *testing.T) {
+	book, board := newBlockingBook(t, `{"mid_price":100,"bids":[{"price":99,"size":1}],"asks":[{"price":101,"size":1}]}`)
+	var resyncs []Resync
+	book.OnResync(func(r Resync) { resyncs = append(resyncs, r) })
+
+	done := make(chan error, 1)
+	go func() { done <- book.Resync(context.Background()) }()
+	<-board.requested
+
+	// Diffs arriving during the round trip are applied on top of the REST board
+	book.HandleBoard(diff(100, []websocket.PriceLevel{{Price: 98, Size: 2}}, nil))
+	book.HandleBoard(diff(99.75, []websocket.PriceLevel{{Price: 99, Size: 0}, {Price: 98.5, Size: 1}}, nil))
+	if book.Synced() {
+		t.Fatal("Expected the book to stay unsynced until the REST board arrives")
+	}
+	close(board.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Resync() error = %v", err)
+	}
+
+	if !book.Synced() {
+		t.Fatal("Expected the REST board to sync the book")
+	}
+	want := []websocket.PriceLevel{{Price: 98.5, Size: 1}, {Price: 98, Size: 2}}
+	if got := book.Bids(0); !reflect.DeepEqual(got, want) {
+		t.Errorf("Bids() = %v, want %v", got, want)
+	}
+	if len(resyncs) != 1 || resyncs[0].Source != FromREST {
+		t.Errorf("Unexpected resyncs %+v", resyncs)
+	}
+
+	// Diffs apply directly once the resync completed
+	book.HandleBoard(diff(0, []websocket.PriceLevel{{Price: 97, Size: 1}}, nil))
+	if got := book.Bids(0); len(got) != 3 {
+		t.Errorf("Expected the diff to apply, got bids %v", got)
+	}
+}
+
+func TestResync_SnapshotWins(t *testing.T) {
+	book, board := newBlockingBook(t, `{"mid_price":50,"bids":[{"price":49,"size":1}],"asks":[{"price":51,"size":1}]}`)
+
+	done := make(chan error, 1)
+	go func() { done <- book.Resync(context.Background()) }()
+	<-board.requested
+
+	// A diff older than the snapshot is dropped, a newer one is kept
+	book.HandleBoard(diff(0, []websocket.PriceLevel{{Price: 10, Size: 1}}, nil))
+	book.HandleBoardSnapshot(snapshot(100,
+		[]websocket.PriceLevel{{Price: 99, Size: 1}},
+		[]websocket.PriceLevel{{Price: 101, Size: 1}},
+	))
+	book.HandleBoard(diff(0, []websocket.PriceLevel{{Price: 98, Size: 1}}, nil))
+	close(board.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Resync() error = %v", err)
+	}
+
+	want := []websocket.PriceLevel{{Price: 99, Size: 1}, {Price: 98, Size: 1}}
+	if got := book.Bids(0); !reflect.DeepEqual(got, want) {
+		t.Errorf("Bids() = %v, want %v", got, want)
+	}
+}
+
+func TestAttach_AppliesDiffsInOrder(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := websocket.NewClient(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	book := NewBook("BTC_JPY")
+	defer book.Attach(client)()
+	var violations atomic.Int32
+	book.OnViolation(func(Violation) { violations.Add(1) })
+
+	channels := []string{websocket.BoardSnapshotChannel("BTC_JPY"), websocket.BoardChannel("BTC_JPY")}
+	for _, channel := range channels {
+		if err := client.Subscribe(ctx, channel); err != nil {
+			t.Fatalf("Subscribe() error = %v", err)
+		}
+	}
+	if err := srv.WaitSubscribed(ctx, channels...); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	publish := func(channel string, data websocket.BoardData) {
+		t.Helper()
+		if _, err := srv.Publish(channel, data); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	publish(channels[0], snapshot(100,
+		[]websocket.PriceLevel{{Price: 99, Size: 1}, {Price: 98, Size: 2}},
+		[]websocket.PriceLevel{{Price: 101, Size: 1}},
+	).Data)
+	// Diffs alternately add and remove the bid at 100: applied out of order,
+	// a stale level would stay or the mid price would not match
+	const n = 200
+	for i := 1; i <= n; i++ {
+		if i%2 == 1 {
+			publish(channels[1], diff(100.5, []websocket.PriceLevel{{Price: 100, Size: float64(i)}}, nil).Data)
+		} else {
+			publish(channels[1], diff(100, []websocket.PriceLevel{{Price: 100, Size: 0}, {Price: 99, Size: float64(i)}}, nil).Data)
+		}
+	}
+
+	want := []websocket.PriceLevel{{Price: 99, Size: n}, {Price: 98, Size: 2}}
+	for !reflect.DeepEqual(book.Bids(0), want) {
+		if ctx.Err() != nil {
+			t.Fatalf("Bids() = %v, want %v", book.Bids(0), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := violations.Load(); got != 0 {
+		t.Errorf("Expected no violations, got %d", got)
+	}
+}
+
+func TestRESTResync_PricesAbove2To24(t *testing.T) {
+	// float32 cannot hold 17000001 or 0.12345678 exactly
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"mid_price":17000002,"bids":[{"price":17000001,"size":0.12345678},{"price":17000000,"size":1}],"asks":[{"price":17000003,"size":1}]}`))
+	}))
+	defer srv.Close()
+
+	ac, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{}, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	book := NewBook("BTC_JPY", WithRESTResync(ac))
+	if err := book.Resync(context.Background()); err != nil {
+		t.Fatalf("Resync() error = %v", err)
+	}
+	wantBids := []websocket.PriceLevel{{Price: 17000001, Size: 0.12345678}, {Price: 17000000, Size: 1}}
+	if got := book.Bids(0); !reflect.DeepEqual(got, wantBids) {
+		t.Fatalf("Bids() = %v, want %v", got, wantBids)
+	}
+
+	// A realtime diff removes the seeded level
+	book.HandleBoard(websocket.BoardMessage{ProductCode: "BTC_JPY", Data: websocket.BoardData{
+		MidPrice: 17000001.5,
+		Bids:     []websocket.PriceLevel{{Price: 17000001, Size: 0}},
+	}})
+	wantBids = wantBids[1:]
+	if got := book.Bids(0); !reflect.DeepEqual(got, wantBids) {
+		t.Errorf("Bids() = %v, want %v", got, wantBids)
+	}
+}
@@ -0,0 +1,304 @@
+// Package sfd tracks the FX/spot price divergence (SFD) and estimates the
+// cost of holding Lightning FX positions.
+package sfd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// Tier is an SFD fee tier. The fee rate applies when the absolute
+// divergence is at or above MinDivergence.
+type Tier struct {
+	MinDivergence float64
+	FeeRate       float64
+}
+
+// DefaultTiers are the SFD tiers published by bitFlyer
+var DefaultTiers = []Tier{
+	{MinDivergence: 0.05, FeeRate: 0.0025},
+	{MinDivergence: 0.10, FeeRate: 0.005},
+	{MinDivergence: 0.15, FeeRate: 0.01},
+	{MinDivergence: 0.20, FeeRate: 0.02},
+}
+
+// Status is the divergence between the FX and spot prices
+type Status struct {
+	FXPrice    float64
+	SpotPrice  float64
+	Divergence float64 // (FXPrice - SpotPrice) / SpotPrice
+	Tier       int     // index into the tiers, -1 when no SFD applies
+	FeeRate    float64
+	Time       time.Time
+}
+
+// Fee returns the SFD charged for an order. Orders that widen the
+// divergence pay the fee; orders that narrow it receive it, which is
+// returned as a negative value.
+func (s Status) Fee(side string, size, price float64) float64 {
+	if s.FeeRate == 0 {
+		return 0
+	}
+	fee := size * price * s.FeeRate
+	widening := (s.Divergence > 0 && side == "BUY") || (s.Divergence < 0 && side == "SELL")
+	if widening {
+		return fee
+	}
+	return -fee
+}
+
+// Funding holds the funding rate and leverage of the FX product
+type Funding struct {
+	Rate        float64   // Current funding rate per settlement
+	NextSettle  time.Time // Next settlement time
+	MaxLeverage float64   // Current maximum leverage, zero if unknown
+}
+
+// HoldingCost is the estimated cost of holding a position.
+// Positive values are costs, negative values are income.
+type HoldingCost struct {
+	SFD                float64
+	Funding            float64
+	Settlements        int
+	Total              float64
+	RequiredCollateral float64
+}
+
+// Tracker tracks the FX/spot divergence from realtime tickers
+type Tracker struct {
+	fxProductCode   string
+	spotProductCode string
+	tiers           []Tier
+	fundingInterval time.Duration
+
+	mu            sync.Mutex
+	fxPrice       float64
+	spotPrice     float64
+	status        Status
+	hasStatus     bool
+	funding       Funding
+	updateHandler func(Status)
+	tierHandler   func(previous, current Status)
+}
+
+// Option configures a Tracker
+type Option func(*Tracker)
+
+// WithProducts sets the FX and spot product codes
+func WithProducts(fxProductCode, spotProductCode string) Option {
+	return func(t *Tracker) {
+		t.fxProductCode = fxProductCode
+		t.spotProductCode = spotProductCode
+	}
+}
+
+// WithTiers sets the SFD tiers, ordered by ascending MinDivergence
+func WithTiers(tiers []Tier) Option {
+	return func(t *Tracker) {
+		t.tiers = tiers
+	}
+}
+
+// WithFundingInterval sets the time between funding settlements
+func WithFundingInterval(d time.Duration) Option {
+	return func(t *Tracker) {
+		t.fundingInterval = d
+	}
+}
+
+// NewTracker creates a new tracker for FX_BTC_JPY against BTC_JPY
+func NewTracker(opts ...Option) *Tracker {
+	t := &Tracker{
+		fxProductCode:   "FX_BTC_JPY",
+		spotProductCode: "BTC_JPY",
+		tiers:           DefaultTiers,
+		fundingInterval: 8 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// OnUpdate sets a callback to receive every divergence update
+func (t *Tracker) OnUpdate(handler func(Status)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.updateHandler = handler
+}
+
+// OnTierChange sets a callback to receive SFD tier changes
+func (t *Tracker) OnTierChange(handler func(previous, current Status)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tierHandler = handler
+}
+
+// HandleTicker updates the divergence from a realtime ticker.
+// Tickers for other products are ignored.
+func (t *Tracker) HandleTicker(ticker websocket.TickerMessage) {
+	if ticker.Ltp == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	switch ticker.ProductCode {
+	case t.fxProductCode:
+		t.fxPrice = ticker.Ltp
+	case t.spotProductCode:
+		t.spotPrice = ticker.Ltp
+	default:
+		t.mu.Unlock()
+		return
+	}
+	if t.fxPrice == 0 || t.spotPrice == 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	previous, hadStatus := t.status, t.hasStatus
+	current := t.compute(t.fxPrice, t.spotPrice)
+	t.status = current
+	t.hasStatus = true
+	updateHandler := t.updateHandler
+	tierHandler := t.tierHandler
+	t.mu.Unlock()
+
+	if updateHandler != nil {
+		updateHandler(current)
+	}
+	if tierHandler != nil && (!hadStatus || previous.Tier != current.Tier) {
+		tierHandler(previous, current)
+	}
+}
+
+// compute derives the status for the prices
+func (t *Tracker) compute(fxPrice, spotPrice float64) Status {
+	s := Status{
+		FXPrice:    fxPrice,
+		SpotPrice:  spotPrice,
+		Divergence: (fxPrice - spotPrice) / spotPrice,
+		Tier:       -1,
+		Time:       time.Now(),
+	}
+	abs := math.Abs(s.Divergence)
+	for i, tier := range t.tiers {
+		if abs >= tier.MinDivergence {
+			s.Tier = i
+			s.FeeRate = tier.FeeRate
+		}
+	}
+	return s
+}
+
+// Status returns the latest divergence. It reports false until both
+// the FX and spot prices have been received.
+func (t *Tracker) Status() (Status, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status, t.hasStatus
+}
+
+// RefreshFunding loads the funding rate and the corporate leverage
+func (t *Tracker) RefreshFunding(ctx context.Context, ac *http.AuthenticatedClient) error {
+	rateResp, err := ac.Client().GetV1GetfundingrateWithResponse(ctx, &http.GetV1GetfundingrateParams{
+		ProductCode: t.fxProductCode,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get funding rate: %w", err)
+	}
+	if err := http.CheckResponse(rateResp.StatusCode(), rateResp.Body); err != nil {
+		return fmt.Errorf("failed to get funding rate: %w", err)
+	}
+
+	leverageResp, err := ac.Client().GetV1GetcorporateleverageWithResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get corporate leverage: %w", err)
+	}
+	if err := http.CheckResponse(leverageResp.StatusCode(), leverageResp.Body); err != nil {
+		return fmt.Errorf("failed to get corporate leverage: %w", err)
+	}
+
+	var funding Funding
+	if r := rateResp.JSON200; r != nil {
+		if r.CurrentFundingRate != nil {
+			funding.Rate = float64(*r.CurrentFundingRate)
+		}
+		if r.NextFundingRateSettledate != nil {
+			funding.NextSettle = *r.NextFundingRateSettledate
+		}
+	}
+	if l := leverageResp.JSON200; l != nil && l.CurrentMax != nil {
+		funding.MaxLeverage = float64(*l.CurrentMax)
+	}
+
+	t.SetFunding(funding)
+	return nil
+}
+
+// SetFunding sets the funding data used by EstimateHoldingCost
+func (t *Tracker) SetFunding(funding Funding) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.funding = funding
+}
+
+// Funding returns the funding data used by EstimateHoldingCost
+func (t *Tracker) Funding() Funding {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.funding
+}
+
+// EstimateHoldingCost estimates the cost of opening a position of size on
+// side at the current FX price and holding it for the horizon.
+// A positive funding rate is paid by longs and received by shorts.
+func (t *Tracker) EstimateHoldingCost(side string, size float64, horizon time.Duration, now time.Time) (HoldingCost, error) {
+	status, ok := t.Status()
+	if !ok {
+		return HoldingCost{}, fmt.Errorf("divergence is not known yet")
+	}
+	funding := t.Funding()
+
+	price := status.FXPrice
+	notional := size * price
+
+	cost := HoldingCost{
+		SFD:         status.Fee(side, size, price),
+		Settlements: settlements(funding.NextSettle, t.fundingInterval, now, now.Add(horizon)),
+	}
+
+	perSettlement := notional * funding.Rate
+	if side == "SELL" {
+		perSettlement = -perSettlement
+	}
+	cost.Funding = perSettlement * float64(cost.Settlements)
+	cost.Total = cost.SFD + cost.Funding
+	if funding.MaxLeverage > 0 {
+		cost.RequiredCollateral = notional / funding.MaxLeverage
+	}
+	return cost, nil
+}
+
+// settlements counts funding settlements in (from, to]
+func settlements(next time.Time, interval time.Duration, from, to time.Time) int {
+	if next.IsZero() || interval <= 0 {
+		return 0
+	}
+	// Move a stale settlement time forward to the first one after from
+	for !next.After(from) {
+		next = next.Add(interval)
+	}
+	count := 0
+	for !next.After(to) {
+		count++
+		next = next.Add(interval)
+	}
+	return count
+}
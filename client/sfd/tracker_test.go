@@ -0,0 +1,150 @@
+package sfd
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-3
+}
+
+func TestHandleTicker_Tiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		fx       float64
+		spot     float64
+		wantTier int
+		wantRate float64
+	}{
+		{"no sfd", 3090000, 3000000, -1, 0},
+		{"tier 0", 3150000, 3000000, 0, 0.0025},
+		{"tier 1", 3300000, 3000000, 1, 0.005},
+		{"tier 3", 3700000, 3000000, 3, 0.02},
+		{"negative divergence", 2850000, 3000000, 0, 0.0025},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker()
+			tracker.HandleTicker(websocket.TickerMessage{ProductCode: "FX_BTC_JPY", Ltp: tt.fx})
+			if _, ok := tracker.Status(); ok {
+				t.Fatal("Expected no status before both prices are known")
+			}
+			tracker.HandleTicker(websocket.TickerMessage{ProductCode: "BTC_JPY", Ltp: tt.spot})
+
+			status, ok := tracker.Status()
+			if !ok {
+				t.Fatal("Expected status")
+			}
+			if status.Tier != tt.wantTier {
+				t.Errorf("Expected tier %d, got %d", tt.wantTier, status.Tier)
+			}
+			if !almostEqual(status.FeeRate, tt.wantRate) {
+				t.Errorf("Expected fee rate %v, got %v", tt.wantRate, status.FeeRate)
+			}
+		})
+	}
+}
+
+func TestOnTierChange(t *testing.T) {
+	tracker := NewTracker()
+	var changes []int
+	tracker.OnTierChange(func(previous, current Status) {
+		changes = append(changes, current.Tier)
+	})
+
+	tracker.HandleTicker(websocket.TickerMessage{ProductCode: "BTC_JPY", Ltp: 3000000})
+	tracker.HandleTicker(websocket.TickerMessage{ProductCode: "FX_BTC_JPY", Ltp: 3030000})
+	tracker.HandleTicker(websocket.TickerMessage{ProductCode: "FX_BTC_JPY", Ltp: 3060000})
+	tracker.HandleTicker(websocket.TickerMessage{ProductCode: "FX_BTC_JPY", Ltp: 3160000})
+	tracker.HandleTicker(websocket.TickerMessage{ProductCode: "ETH_JPY", Ltp: 1})
+
+	if len(changes) != 2 || changes[0] != -1 || changes[1] != 0 {
+		t.Errorf("Unexpected tier changes: %v", changes)
+	}
+}
+
+func TestStatusFee(t *testing.T) {
+	s := Status{Divergence: 0.06, FeeRate: 0.0025}
+	if fee := s.Fee("BUY", 1, 3000000); !almostEqual(fee, 7500) {
+		t.Errorf("Expected widening BUY to pay 7500, got %v", fee)
+	}
+	if fee := s.Fee("SELL", 1, 3000000); !almostEqual(fee, -7500) {
+		t.Errorf("Expected narrowing SELL to receive 7500, got %v", fee)
+	}
+}
+
+func TestEstimateHoldingCost(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/getfundingrate":
+			if r.URL.Query().Get("product_code") != "FX_BTC_JPY" {
+				t.Errorf("Unexpected product code %s", r.URL.Query().Get("product_code"))
+			}
+			_, _ = w.Write([]byte(`{"current_funding_rate":0.0001,"next_funding_rate_settledate":"2024-01-01T04:00:00Z"}`))
+		case "/v1/getcorporateleverage":
+			_, _ = w.Write([]byte(`{"current_max":2}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ac, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{}, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	tracker := NewTracker()
+	if _, err := tracker.EstimateHoldingCost("BUY", 1, time.Hour, now); err == nil {
+		t.Error("Expected error before divergence is known")
+	}
+
+	if err := tracker.RefreshFunding(context.Background(), ac); err != nil {
+		t.Fatalf("RefreshFunding() error = %v", err)
+	}
+	tracker.HandleTicker(websocket.TickerMessage{ProductCode: "BTC_JPY", Ltp: 3000000})
+	tracker.HandleTicker(websocket.TickerMessage{ProductCode: "FX_BTC_JPY", Ltp: 3200000})
+
+	// Settlements at 04:00 and 12:00 fall within 12 hours
+	cost, err := tracker.EstimateHoldingCost("BUY", 0.5, 12*time.Hour, now)
+	if err != nil {
+		t.Fatalf("EstimateHoldingCost() error = %v", err)
+	}
+	if cost.Settlements != 2 {
+		t.Errorf("Expected 2 settlements, got %d", cost.Settlements)
+	}
+	// 0.5 * 3,200,000 = 1,600,000 notional
+	if !almostEqual(cost.Funding, 320) {
+		t.Errorf("Expected funding 320, got %v", cost.Funding)
+	}
+	if !almostEqual(cost.SFD, 4000) {
+		t.Errorf("Expected SFD 4000, got %v", cost.SFD)
+	}
+	if !almostEqual(cost.Total, 4320) {
+		t.Errorf("Expected total 4320, got %v", cost.Total)
+	}
+	if !almostEqual(cost.RequiredCollateral, 800000) {
+		t.Errorf("Expected required collateral 800000, got %v", cost.RequiredCollateral)
+	}
+
+	short, err := tracker.EstimateHoldingCost("SELL", 0.5, 12*time.Hour, now)
+	if err != nil {
+		t.Fatalf("EstimateHoldingCost() error = %v", err)
+	}
+	if !almostEqual(short.Total, -4320) {
+		t.Errorf("Expected short total -4320, got %v", short.Total)
+	}
+}
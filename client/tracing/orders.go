@@ -0,0 +1,120 @@
+// Package tracing links order submissions traced by the REST client to the
+// realtime order events traced by the websocket client.
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the tracer name used by the clients
+const InstrumentationName = "github.com/bmf-san/go-bitflyer-api-client"
+
+// OrderLinker remembers the span of each order submission by acceptance ID
+// so that the order events that follow join the same trace. Pass the same
+// linker to http.WithTracing and websocket.WithTracing.
+type OrderLinker struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]linkEntry
+}
+
+type linkEntry struct {
+	spanContext trace.SpanContext
+	added       time.Time
+}
+
+// LinkerOption configures an OrderLinker
+type LinkerOption func(*OrderLinker)
+
+// WithTTL sets how long a submission is remembered, 24 hours by default
+func WithTTL(ttl time.Duration) LinkerOption {
+	return func(l *OrderLinker) {
+		l.ttl = ttl
+	}
+}
+
+// WithMaxEntries bounds the number of remembered submissions, 10000 by default.
+// The oldest submission is forgotten first.
+func WithMaxEntries(n int) LinkerOption {
+	return func(l *OrderLinker) {
+		l.maxEntries = n
+	}
+}
+
+// NewOrderLinker creates an empty linker
+func NewOrderLinker(opts ...LinkerOption) *OrderLinker {
+	l := &OrderLinker{
+		ttl:        24 * time.Hour,
+		maxEntries: 10000,
+		entries:    make(map[string]linkEntry),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Link remembers the span context of an order submission
+func (l *OrderLinker) Link(acceptanceID string, sc trace.SpanContext) {
+	if acceptanceID == "" || !sc.IsValid() {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+	l.entries[acceptanceID] = linkEntry{spanContext: sc, added: now}
+}
+
+// SpanContext returns the span context of the submission of the order
+func (l *OrderLinker) SpanContext(acceptanceID string) (trace.SpanContext, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[acceptanceID]
+	if !ok || time.Since(e.added) > l.ttl {
+		return trace.SpanContext{}, false
+	}
+	return e.spanContext, true
+}
+
+// Unlink forgets the submission of an order that reached a final state
+func (l *OrderLinker) Unlink(acceptanceID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, acceptanceID)
+}
+
+// Len returns the number of remembered submissions
+func (l *OrderLinker) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// pruneLocked drops expired entries and makes room for one more.
+// l.mu must be held.
+func (l *OrderLinker) pruneLocked(now time.Time) {
+	for id, e := range l.entries {
+		if now.Sub(e.added) > l.ttl {
+			delete(l.entries, id)
+		}
+	}
+	for l.maxEntries > 0 && len(l.entries) >= l.maxEntries {
+		var oldestID string
+		var oldest time.Time
+		for id, e := range l.entries {
+			if oldestID == "" || e.added.Before(oldest) {
+				oldestID, oldest = id, e.added
+			}
+		}
+		delete(l.entries, oldestID)
+	}
+}
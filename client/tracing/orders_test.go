@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanContext(b byte) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{b},
+		SpanID:     trace.SpanID{b},
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func TestOrderLinker(t *testing.T) {
+	l := NewOrderLinker()
+
+	l.Link("JRF1", spanContext(1))
+	l.Link("", spanContext(2))
+	l.Link("JRF3", trace.SpanContext{})
+
+	if l.Len() != 1 {
+		t.Fatalf("Expected 1 entry, got %d", l.Len())
+	}
+	sc, ok := l.SpanContext("JRF1")
+	if !ok || sc.TraceID() != (trace.TraceID{1}) {
+		t.Errorf("SpanContext() = %v, %v", sc, ok)
+	}
+
+	l.Unlink("JRF1")
+	if _, ok := l.SpanContext("JRF1"); ok {
+		t.Error("Expected the entry to be unlinked")
+	}
+}
+
+func TestOrderLinker_Bounds(t *testing.T) {
+	l := NewOrderLinker(WithMaxEntries(2))
+	l.Link("JRF1", spanContext(1))
+	time.Sleep(time.Millisecond)
+	l.Link("JRF2", spanContext(2))
+	time.Sleep(time.Millisecond)
+	l.Link("JRF3", spanContext(3))
+
+	if l.Len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", l.Len())
+	}
+	if _, ok := l.SpanContext("JRF1"); ok {
+		t.Error("Expected the oldest entry to be evicted")
+	}
+
+	l = NewOrderLinker(WithTTL(time.Millisecond))
+	l.Link("JRF1", spanContext(1))
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := l.SpanContext("JRF1"); ok {
+		t.Error("Expected the entry to expire")
+	}
+}
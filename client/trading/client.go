@@ -0,0 +1,209 @@
+// Package trading provides order placement helpers built on top of the
+// authenticated HTTP client.
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// ErrGateClosed is returned when a gate refused a new order
+var ErrGateClosed = errors.New("order rejected by gate")
+
+// Client places and cancels orders through an AuthenticatedClient
+type Client struct {
+	api      *http.ClientWithResponses
+	resolver ProductResolver
+	gates    []Gate
+
+	replaceTimeout time.Duration
+
+	submitAttempts int
+	submitTimeout  time.Duration
+	reconcileDelay time.Duration
+	mu             sync.Mutex
+	submissions    map[string]*submission
+}
+
+// ProductResolver resolves product codes and aliases, such as BTCJPY_MAT1WK,
+// before orders are sent.
+// *markets.Catalog implements this interface.
+type ProductResolver interface {
+	Resolve(codeOrAlias string) (string, error)
+}
+
+// Gate decides whether new orders may be sent for a product.
+// *health.Watcher implements this interface.
+type Gate interface {
+	Allow(productCode string) error
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithProductResolver rejects orders whose product code cannot be resolved
+// and sends the others with the resolved product code, so that gates and
+// reconciliation see the same code whether an alias was used or not
+func WithProductResolver(resolver ProductResolver) Option {
+	return func(c *Client) {
+		c.resolver = resolver
+	}
+}
+
+// WithGate adds a gate that is checked before every new order. A refused
+// order fails with ErrGateClosed. Cancels are never gated.
+func WithGate(gate Gate) Option {
+	return func(c *Client) {
+		c.gates = append(c.gates, gate)
+	}
+}
+
+// NewClient creates a new trading client
+func NewClient(ac *http.AuthenticatedClient, opts ...Option) *Client {
+	c := &Client{
+		api:            ac.Client(),
+		replaceTimeout: defaultReplaceTimeout,
+		submitAttempts: defaultSubmitAttempts,
+		submitTimeout:  defaultSubmitTimeout,
+		reconcileDelay: defaultReconcileDelay,
+		submissions:    make(map[string]*submission),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SendChildOrder sends a new child order and returns its acceptance ID
+func (c *Client) SendChildOrder(ctx context.Context, req http.NewOrderRequest) (string, error) {
+	req, err := c.admit(req)
+	if err != nil {
+		return "", err
+	}
+	return c.send(ctx, req)
+}
+
+// admit validates the order, resolves its product code and checks the gates
+func (c *Client) admit(req http.NewOrderRequest) (http.NewOrderRequest, error) {
+	if err := c.Validate(req); err != nil {
+		return req, err
+	}
+	if c.resolver != nil {
+		code, err := c.resolver.Resolve(req.ProductCode)
+		if err != nil {
+			return req, fmt.Errorf("invalid order: %w", err)
+		}
+		req.ProductCode = code
+	}
+	for _, gate := range c.gates {
+		if err := gate.Allow(req.ProductCode); err != nil {
+			return req, fmt.Errorf("%w: %w", ErrGateClosed, err)
+		}
+	}
+	return req, nil
+}
+
+// send posts the order without any check
+func (c *Client) send(ctx context.Context, req http.NewOrderRequest) (string, error) {
+	resp, err := c.api.PostV1MeSendchildorderWithResponse(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send child order: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return "", fmt.Errorf("failed to send child order: %w", err)
+	}
+	if resp.JSON200 == nil || resp.JSON200.ChildOrderAcceptanceId == nil {
+		return "", fmt.Errorf("failed to send child order: acceptance id is missing")
+	}
+	return *resp.JSON200.ChildOrderAcceptanceId, nil
+}
+
+// CancelChildOrder cancels a child order by its acceptance ID
+func (c *Client) CancelChildOrder(ctx context.Context, productCode, acceptanceID string) error {
+	resp, err := c.api.PostV1MeCancelchildorderWithResponse(ctx, http.CancelChildOrderRequest{
+		ProductCode:            productCode,
+		ChildOrderAcceptanceId: &acceptanceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel child order: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to cancel child order: %w", err)
+	}
+	return nil
+}
+
+// CancelAllChildOrders cancels every open child order for the product
+func (c *Client) CancelAllChildOrders(ctx context.Context, productCode string) error {
+	resp, err := c.api.PostV1MeCancelallchildordersWithResponse(ctx, http.CancelAllOrdersRequest{
+		ProductCode: productCode,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel all child orders: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to cancel all child orders: %w", err)
+	}
+	return nil
+}
+
+// CancelParentOrder cancels a parent order by its acceptance ID
+func (c *Client) CancelParentOrder(ctx context.Context, productCode, acceptanceID string) error {
+	resp, err := c.api.PostV1MeCancelparentorderWithResponse(ctx, http.CancelParentOrderRequest{
+		ProductCode:             productCode,
+		ParentOrderAcceptanceId: &acceptanceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel parent order: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to cancel parent order: %w", err)
+	}
+	return nil
+}
+
+// Validate checks the order request before it is sent
+func (c *Client) Validate(req http.NewOrderRequest) error {
+	if req.ProductCode == "" {
+		return fmt.Errorf("invalid order: product code is empty")
+	}
+	if req.Size <= 0 {
+		return fmt.Errorf("invalid order: size must be positive")
+	}
+	if req.ChildOrderType == http.NewOrderRequestChildOrderTypeLIMIT && (req.Price == nil || *req.Price <= 0) {
+		return fmt.Errorf("invalid order: limit order requires a positive price")
+	}
+	if c.resolver != nil {
+		if _, err := c.resolver.Resolve(req.ProductCode); err != nil {
+			return fmt.Errorf("invalid order: %w", err)
+		}
+	}
+	return nil
+}
+
+// MarketOrder builds a MARKET child order request
+func MarketOrder(productCode string, side http.NewOrderRequestSide, size float64) http.NewOrderRequest {
+	return http.NewOrderRequest{
+		ProductCode:    productCode,
+		ChildOrderType: http.NewOrderRequestChildOrderTypeMARKET,
+		Side:           side,
+		Size:           float32(size),
+	}
+}
+
+// LimitOrder builds a LIMIT child order request
+func LimitOrder(productCode string, side http.NewOrderRequestSide, price, size float64) http.NewOrderRequest {
+	p := float32(price)
+	return http.NewOrderRequest{
+		ProductCode:    productCode,
+		ChildOrderType: http.NewOrderRequestChildOrderTypeLIMIT,
+		Side:           side,
+		Price:          &p,
+		Size:           float32(size),
+	}
+}
@@ -0,0 +1,166 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/http/resttest"
+	"github.com/bmf-san/go-bitflyer-api-client/client/markets"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	return NewClient(resttest.NewClient(t, handler))
+}
+
+func TestSendChildOrder(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/me/sendchildorder" {
+			t.Errorf("Expected path /v1/me/sendchildorder, got %s", r.URL.Path)
+		}
+
+		var req bfhttp.NewOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.ChildOrderType != bfhttp.NewOrderRequestChildOrderTypeLIMIT {
+			t.Errorf("Expected LIMIT order, got %s", req.ChildOrderType)
+		}
+		if req.Price == nil || *req.Price != 3000000 {
+			t.Errorf("Expected price 3000000, got %v", req.Price)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"child_order_acceptance_id":"JRF20150707-050237-639234"}`))
+	})
+
+	id, err := client.SendChildOrder(context.Background(), LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 3000000, 0.01))
+	if err != nil {
+		t.Fatalf("SendChildOrder() error = %v", err)
+	}
+	if id != "JRF20150707-050237-639234" {
+		t.Errorf("Expected acceptance id JRF20150707-050237-639234, got %s", id)
+	}
+}
+
+func TestSendChildOrder_APIError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status":-205,"error_message":"Margin amount is insufficient for this order.","data":null}`))
+	})
+
+	_, err := client.SendChildOrder(context.Background(), MarketOrder("FX_BTC_JPY", bfhttp.NewOrderRequestSideSELL, 0.01))
+	var apiErr *bfhttp.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected *APIError, got %v", err)
+	}
+	if apiErr.Status != -205 {
+		t.Errorf("Expected status -205, got %d", apiErr.Status)
+	}
+}
+
+func TestCancelOrders(t *testing.T) {
+	var paths []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx := context.Background()
+	if err := client.CancelChildOrder(ctx, "BTC_JPY", "JRF20150707-050237-639234"); err != nil {
+		t.Fatalf("CancelChildOrder() error = %v", err)
+	}
+	if err := client.CancelAllChildOrders(ctx, "BTC_JPY"); err != nil {
+		t.Fatalf("CancelAllChildOrders() error = %v", err)
+	}
+	if err := client.CancelParentOrder(ctx, "BTC_JPY", "JRF20150925-060559-396699"); err != nil {
+		t.Fatalf("CancelParentOrder() error = %v", err)
+	}
+
+	if len(paths) != 3 || paths[0] != "/v1/me/cancelchildorder" || paths[1] != "/v1/me/cancelallchildorders" ||
+		paths[2] != "/v1/me/cancelparentorder" {
+		t.Errorf("Unexpected request paths: %v", paths)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ac := resttest.NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"product_code":"BTC_JPY","market_type":"Spot"},` +
+			`{"product_code":"BTCJPY28MAR2025","alias":"BTCJPY_MAT3M","market_type":"Futures"}]`))
+	}))
+	catalog := markets.NewCatalog(ac)
+	if err := catalog.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	client := NewClient(ac, WithProductResolver(catalog))
+
+	tests := []struct {
+		name    string
+		req     bfhttp.NewOrderRequest
+		wantErr bool
+		errIs   error
+	}{
+		{"valid limit", LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 3000000, 0.01), false, nil},
+		{"alias", MarketOrder("BTCJPY_MAT3M", bfhttp.NewOrderRequestSideBUY, 0.01), false, nil},
+		{"unknown product", MarketOrder("ETH_BTC", bfhttp.NewOrderRequestSideBUY, 0.01), true, markets.ErrUnknownProduct},
+		{"zero size", MarketOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0), true, nil},
+		{"limit without price", bfhttp.NewOrderRequest{ProductCode: "BTC_JPY", ChildOrderType: bfhttp.NewOrderRequestChildOrderTypeLIMIT, Side: bfhttp.NewOrderRequestSideBUY, Size: 0.01}, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.Validate(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+				t.Errorf("Expected %v, got %v", tt.errIs, err)
+			}
+		})
+	}
+
+	// Gates see the product code an alias resolves to
+	WithGate(stubGate{"BTCJPY28MAR2025": true})(client)
+	if _, err := client.SendChildOrder(context.Background(), MarketOrder("BTCJPY_MAT3M", bfhttp.NewOrderRequestSideBUY, 0.01)); !errors.Is(err, ErrGateClosed) {
+		t.Errorf("Expected the alias to be gated as BTCJPY28MAR2025, got %v", err)
+	}
+}
+
+// stubGate blocks every product in the set
+type stubGate map[string]bool
+
+func (g stubGate) Allow(productCode string) error {
+	if g[productCode] {
+		return errors.New("paused")
+	}
+	return nil
+}
+
+func TestSendChildOrder_Gate(t *testing.T) {
+	var sent int
+	ac := resttest.NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"child_order_acceptance_id":"JRF-TEST"}`))
+	}))
+	client := NewClient(ac, WithGate(stubGate{"FX_BTC_JPY": true}))
+
+	ctx := context.Background()
+	if _, err := client.SendChildOrder(ctx, MarketOrder("FX_BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0.01)); !errors.Is(err, ErrGateClosed) {
+		t.Errorf("Expected gated order to be rejected with ErrGateClosed, got %v", err)
+	}
+	if _, err := client.SendChildOrder(ctx, MarketOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0.01)); err != nil {
+		t.Errorf("SendChildOrder() error = %v", err)
+	}
+	if err := client.CancelAllChildOrders(ctx, "FX_BTC_JPY"); err != nil {
+		t.Errorf("Expected cancels not to be gated, got %v", err)
+	}
+	if sent != 2 {
+		t.Errorf("Expected 2 requests to reach the server, got %d", sent)
+	}
+}
@@ -0,0 +1,214 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+const (
+	defaultReplaceTimeout = 10 * time.Second
+	// replacePollInterval is how often the order is queried while the REST
+	// API lags behind the realtime CANCEL event
+	replacePollInterval = 200 * time.Millisecond
+	// maxMinuteToExpire is the longest expiry the API accepts, 30 days
+	maxMinuteToExpire = 43200
+)
+
+// WithReplaceTimeout sets how long Replace waits for the cancel to be
+// confirmed, 10 seconds by default
+func WithReplaceTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.replaceTimeout = d
+	}
+}
+
+// ReplaceOutcome is the final state of a Replace
+type ReplaceOutcome string
+
+const (
+	// Replaced means the order was canceled and its remaining size was sent
+	// again at the new price
+	Replaced ReplaceOutcome = "replaced"
+	// ReplaceFilled means the order was fully executed before the cancel
+	// took effect. Nothing was sent.
+	ReplaceFilled ReplaceOutcome = "filled"
+	// ReplaceCanceled means the order was canceled but its remaining size
+	// was not sent again; the error tells why
+	ReplaceCanceled ReplaceOutcome = "canceled"
+	// ReplaceUnconfirmed means the cancel was not confirmed in time. The
+	// order may still be open and nothing was sent.
+	ReplaceUnconfirmed ReplaceOutcome = "unconfirmed"
+	// ReplaceAmbiguous means the order was canceled and its remaining size
+	// was sent, but it is unknown whether the new order was accepted.
+	// Submitting the tag again with SubmitChildOrder reconciles it.
+	ReplaceAmbiguous ReplaceOutcome = "ambiguous"
+)
+
+// ReplaceResult reports what Replace did
+type ReplaceResult struct {
+	Outcome         ReplaceOutcome
+	OldAcceptanceID string
+	NewAcceptanceID string               // set when Replaced
+	Tag             string               // tag of the new order, set when ReplaceAmbiguous
+	Request         http.NewOrderRequest // the new order to submit with Tag, set when ReplaceAmbiguous
+	ExecutedSize    float64              // executed on the old order, including fills during the cancel
+	AveragePrice    float64              // of the executions on the old order
+	ResentSize      float64              // size of the new order, the size not executed
+	Price           float64
+}
+
+// Replace changes the price of an open LIMIT order. bitFlyer has no amend,
+// so the order is canceled, the CANCEL event is awaited on ws, which must be
+// subscribed to child_order_events, and the size that was not executed is
+// sent again at the new price with the same side, time in force and
+// expiry, rounded to the minute.
+//
+// Executions that race with the cancel are accounted for: the executed size
+// is read from the order once the REST API reports it closed, and an order
+// that was filled in full is not sent again. The new order is submitted with
+// SubmitChildOrder under a tag derived from the old acceptance ID, so it
+// goes through the validator and gates like any other, is bounded by the
+// submit timeout (see WithSubmitTimeout) rather than the replace timeout,
+// and is reconciled when a send fails ambiguously. The tag is forgotten
+// once the outcome is known.
+func (c *Client) Replace(ctx context.Context, ws *websocket.Client, productCode, acceptanceID string, price float64) (ReplaceResult, error) {
+	result := ReplaceResult{Outcome: ReplaceUnconfirmed, OldAcceptanceID: acceptanceID, Price: price}
+	if price <= 0 {
+		return result, fmt.Errorf("invalid replace: price must be positive")
+	}
+
+	// Listen before canceling so that the CANCEL event cannot be missed
+	closed := make(chan string, 1)
+	listener := ws.OnOrderEvents(func(m websocket.OrderEventMessage) {
+		if m.ChildOrderAcceptanceID != acceptanceID {
+			return
+		}
+		switch m.EventType {
+		case "CANCEL", "CANCEL_FAILED", "EXPIRE":
+			select {
+			case closed <- m.EventType:
+			default:
+			}
+		}
+	}, websocket.ForProducts(productCode))
+	defer listener.Remove()
+
+	waitCtx, cancel := context.WithTimeout(ctx, c.replaceTimeout)
+	defer cancel()
+
+	// A failed cancel usually means the order is not open anymore; its
+	// state below tells whether it was filled
+	if err := c.CancelChildOrder(waitCtx, productCode, acceptanceID); err == nil {
+		select {
+		case <-closed:
+		case <-waitCtx.Done():
+			return result, fmt.Errorf("failed to replace child order: cancel not confirmed: %w", waitCtx.Err())
+		}
+	}
+
+	order, err := c.closedChildOrder(waitCtx, productCode, acceptanceID)
+	if err != nil {
+		return result, fmt.Errorf("failed to replace child order: %w", err)
+	}
+	size := http.Decimal(order.Size)
+	result.ExecutedSize = http.Decimal(order.ExecutedSize)
+	result.AveragePrice = http.Decimal(order.AveragePrice)
+
+	switch *order.ChildOrderState {
+	case http.ChildOrderChildOrderStateCOMPLETED:
+		result.Outcome = ReplaceFilled
+		return result, nil
+	case http.ChildOrderChildOrderStateREJECTED:
+		result.Outcome = ReplaceCanceled
+		return result, fmt.Errorf("failed to replace child order: order was rejected")
+	}
+
+	result.Outcome = ReplaceCanceled
+	remaining := math.Round((size-result.ExecutedSize)*1e8) / 1e8
+	if remaining <= 0 {
+		result.Outcome = ReplaceFilled
+		return result, nil
+	}
+	if order.ChildOrderType == nil || *order.ChildOrderType != http.ChildOrderChildOrderTypeLIMIT {
+		return result, fmt.Errorf("failed to replace child order: only LIMIT orders can be replaced")
+	}
+
+	req := LimitOrder(productCode, http.NewOrderRequestSide(*order.Side), price, remaining)
+	if order.TimeInForce != nil {
+		tif := http.NewOrderRequestTimeInForce(*order.TimeInForce)
+		req.TimeInForce = &tif
+	}
+	if order.ExpireDate != nil {
+		minutes := min(int(math.Round(time.Until(*order.ExpireDate).Minutes())), maxMinuteToExpire)
+		if minutes < 1 {
+			return result, fmt.Errorf("failed to replace child order: order was about to expire")
+		}
+		req.MinuteToExpire = &minutes
+	}
+	tag := "replace-" + acceptanceID
+	submission, err := c.SubmitChildOrder(ctx, tag, req)
+	if errors.Is(err, ErrAmbiguous) {
+		result.Outcome = ReplaceAmbiguous
+		result.Tag = tag
+		result.Request = req
+		result.ResentSize = remaining
+		return result, fmt.Errorf("failed to replace child order: %w", err)
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to replace child order: %w", err)
+	}
+	c.ForgetSubmission(tag)
+	result.Outcome = Replaced
+	result.NewAcceptanceID = submission.AcceptanceID
+	result.ResentSize = remaining
+	return result, nil
+}
+
+// closedChildOrder queries the order until the REST API reports it closed,
+// as it can lag behind the realtime events
+func (c *Client) closedChildOrder(ctx context.Context, productCode, acceptanceID string) (http.ChildOrder, error) {
+	for {
+		order, err := c.childOrder(ctx, productCode, acceptanceID)
+		if err != nil {
+			return http.ChildOrder{}, err
+		}
+		if order.ChildOrderState == nil || order.Side == nil {
+			return http.ChildOrder{}, fmt.Errorf("order %s is incomplete", acceptanceID)
+		}
+		if *order.ChildOrderState != http.ChildOrderChildOrderStateACTIVE {
+			return order, nil
+		}
+
+		timer := time.NewTimer(replacePollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return http.ChildOrder{}, fmt.Errorf("order %s is still active: %w", acceptanceID, ctx.Err())
+		}
+	}
+}
+
+// childOrder returns a child order by its acceptance ID
+func (c *Client) childOrder(ctx context.Context, productCode, acceptanceID string) (http.ChildOrder, error) {
+	resp, err := c.api.GetV1MeGetchildordersWithResponse(ctx, &http.GetV1MeGetchildordersParams{
+		ProductCode:            productCode,
+		ChildOrderAcceptanceId: &acceptanceID,
+	})
+	if err != nil {
+		return http.ChildOrder{}, fmt.Errorf("failed to get child order: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return http.ChildOrder{}, fmt.Errorf("failed to get child order: %w", err)
+	}
+	if resp.JSON200 == nil || len(*resp.JSON200) == 0 {
+		return http.ChildOrder{}, fmt.Errorf("failed to get child order: %s not found", acceptanceID)
+	}
+	return (*resp.JSON200)[0], nil
+}
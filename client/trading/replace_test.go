@@ -0,0 +1,288 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+// replaceServer stubs the order endpoints used by Replace
+type replaceServer struct {
+	t  *testing.T
+	ws *wstest.Server
+
+	mu        sync.Mutex
+	cancelErr bool     // reject the cancel, as for an order that is not open
+	event     string   // realtime event published when the cancel is accepted
+	states    []string // order states returned in turn; the last one repeats
+	expire    time.Time
+	sendDelay time.Duration // delay of the reply to a send, after it is accepted
+	listSent  bool          // list the accepted replacement among the orders
+	sent      []bfhttp.NewOrderRequest
+}
+
+func (s *replaceServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/v1/me/cancelchildorder":
+		if s.cancelErr {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":-111,"error_message":"Order not found","data":null}`))
+			return
+		}
+		if s.event != "" {
+			go func() {
+				_, _ = s.ws.Publish(websocket.ChildOrderEventsChannel, []map[string]any{
+					{"product_code": "BTC_JPY", "child_order_acceptance_id": "JRF-OTHER", "event_type": s.event},
+					{"product_code": "BTC_JPY", "child_order_acceptance_id": "JRF-1", "event_type": "EXECUTION", "price": 100, "size": 0.3},
+					{"product_code": "BTC_JPY", "child_order_acceptance_id": "JRF-1", "event_type": s.event},
+				})
+			}()
+		}
+	case "/v1/me/getchildorders":
+		switch got := r.URL.Query().Get("child_order_acceptance_id"); got {
+		case "":
+			// Reconciliation of the replacement
+			if !s.listSent || len(s.sent) == 0 {
+				_, _ = w.Write([]byte("[]"))
+				return
+			}
+			_, _ = fmt.Fprintf(w, `[{"child_order_acceptance_id":"JRF-2","product_code":"BTC_JPY","side":"SELL","child_order_type":"LIMIT",`+
+				`"price":101,"size":0.6,"child_order_state":"ACTIVE","child_order_date":%q}]`, time.Now().Format(time.RFC3339Nano))
+			return
+		case "JRF-1":
+		default:
+			s.t.Errorf("Expected the order JRF-1 to be queried, got %q", got)
+		}
+		state := s.states[0]
+		if len(s.states) > 1 {
+			s.states = s.states[1:]
+		}
+		executed := "0.4"
+		if state == "COMPLETED" {
+			executed = "1"
+		}
+		expire := ""
+		if !s.expire.IsZero() {
+			expire = `,"expire_date":"` + s.expire.Format(time.RFC3339) + `"`
+		}
+		_, _ = w.Write([]byte(`[{"child_order_acceptance_id":"JRF-1","product_code":"BTC_JPY","side":"SELL",` +
+			`"child_order_type":"LIMIT","time_in_force":"IOC","price":100,"size":1,"executed_size":` + executed + `,` +
+			`"average_price":100,"child_order_state":"` + state + `"` + expire + `}]`))
+	case "/v1/me/sendchildorder":
+		var req bfhttp.NewOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.t.Errorf("Failed to decode request: %v", err)
+		}
+		s.sent = append(s.sent, req)
+		if s.sendDelay > 0 {
+			s.mu.Unlock()
+			time.Sleep(s.sendDelay)
+			s.mu.Lock()
+		}
+		_, _ = w.Write([]byte(`{"child_order_acceptance_id":"JRF-2"}`))
+	default:
+		s.t.Errorf("Unexpected request %s", r.URL.Path)
+	}
+}
+
+func (s *replaceServer) requests() []bfhttp.NewOrderRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bfhttp.NewOrderRequest(nil), s.sent...)
+}
+
+func newReplaceTest(t *testing.T, s *replaceServer, opts ...Option) (*Client, *websocket.Client) {
+	t.Helper()
+	s.t = t
+	s.ws = wstest.NewServer()
+	t.Cleanup(s.ws.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ws, err := websocket.NewClient(ctx, s.ws.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { ws.Close(context.Background()) })
+	if err := ws.Subscribe(ctx, websocket.ChildOrderEventsChannel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := s.ws.WaitSubscribed(ctx, websocket.ChildOrderEventsChannel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	client := newTestClient(t, s.handle)
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client, ws
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  *replaceServer
+		want    ReplaceResult
+		wantErr bool
+	}{
+		{
+			name:   "partially filled",
+			server: &replaceServer{event: "CANCEL", states: []string{"CANCELED"}},
+			want: ReplaceResult{Outcome: Replaced, OldAcceptanceID: "JRF-1", NewAcceptanceID: "JRF-2",
+				ExecutedSize: 0.4, AveragePrice: 100, ResentSize: 0.6, Price: 101},
+		},
+		{
+			name:   "REST API lags behind the event",
+			server: &replaceServer{event: "CANCEL", states: []string{"ACTIVE", "ACTIVE", "CANCELED"}},
+			want: ReplaceResult{Outcome: Replaced, OldAcceptanceID: "JRF-1", NewAcceptanceID: "JRF-2",
+				ExecutedSize: 0.4, AveragePrice: 100, ResentSize: 0.6, Price: 101},
+		},
+		{
+			name:   "filled before the cancel",
+			server: &replaceServer{cancelErr: true, states: []string{"COMPLETED"}},
+			want:   ReplaceResult{Outcome: ReplaceFilled, OldAcceptanceID: "JRF-1", ExecutedSize: 1, AveragePrice: 100, Price: 101},
+		},
+		{
+			name:   "filled during the cancel",
+			server: &replaceServer{event: "CANCEL_FAILED", states: []string{"COMPLETED"}},
+			want:   ReplaceResult{Outcome: ReplaceFilled, OldAcceptanceID: "JRF-1", ExecutedSize: 1, AveragePrice: 100, Price: 101},
+		},
+		{
+			name:    "cancel not confirmed",
+			server:  &replaceServer{states: []string{"ACTIVE"}},
+			want:    ReplaceResult{Outcome: ReplaceUnconfirmed, OldAcceptanceID: "JRF-1", Price: 101},
+			wantErr: true,
+		},
+		{
+			name:    "still active after a failed cancel",
+			server:  &replaceServer{cancelErr: true, states: []string{"ACTIVE"}},
+			want:    ReplaceResult{Outcome: ReplaceUnconfirmed, OldAcceptanceID: "JRF-1", Price: 101},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, ws := newReplaceTest(t, tt.server, WithReplaceTimeout(time.Second))
+
+			got, err := client.Replace(context.Background(), ws, "BTC_JPY", "JRF-1", 101)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Replace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Replace() = %+v, want %+v", got, tt.want)
+			}
+
+			sent := tt.server.requests()
+			if tt.want.Outcome != Replaced {
+				if len(sent) != 0 {
+					t.Errorf("Expected nothing to be sent, got %+v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 {
+				t.Fatalf("Expected one new order, got %+v", sent)
+			}
+			req := sent[0]
+			if req.Side != bfhttp.NewOrderRequestSideSELL || req.Size != 0.6 || req.Price == nil || *req.Price != 101 ||
+				req.TimeInForce == nil || *req.TimeInForce != bfhttp.NewOrderRequestTimeInForceIOC {
+				t.Errorf("Unexpected replacement %+v", req)
+			}
+		})
+	}
+}
+
+func TestReplace_Expiry(t *testing.T) {
+	server := &replaceServer{event: "CANCEL", states: []string{"CANCELED"}, expire: time.Now().Add(90 * time.Minute)}
+	client, ws := newReplaceTest(t, server, WithReplaceTimeout(time.Second))
+
+	if _, err := client.Replace(context.Background(), ws, "BTC_JPY", "JRF-1", 101); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	sent := server.requests()
+	if len(sent) != 1 || sent[0].MinuteToExpire == nil || *sent[0].MinuteToExpire != 90 {
+		t.Errorf("Expected the replacement to keep the remaining 90 minutes, got %+v", sent)
+	}
+
+	// An order about to expire is not sent again
+	server = &replaceServer{event: "CANCEL", states: []string{"CANCELED"}, expire: time.Now().Add(10 * time.Second)}
+	client, ws = newReplaceTest(t, server, WithReplaceTimeout(time.Second))
+	result, err := client.Replace(context.Background(), ws, "BTC_JPY", "JRF-1", 101)
+	if err == nil || result.Outcome != ReplaceCanceled || len(server.requests()) != 0 {
+		t.Errorf("Expected the replacement not to be sent, got %+v, %v", result, err)
+	}
+}
+
+func TestReplace_AmbiguousSend(t *testing.T) {
+	opts := []Option{WithReplaceTimeout(time.Second), WithSubmitTimeout(50 * time.Millisecond),
+		WithReconcileDelay(time.Millisecond), WithSubmitAttempts(1)}
+	ctx := context.Background()
+
+	// The send times out but the replacement was accepted
+	server := &replaceServer{event: "CANCEL", states: []string{"CANCELED"}, sendDelay: 200 * time.Millisecond, listSent: true}
+	client, ws := newReplaceTest(t, server, opts...)
+	result, err := client.Replace(ctx, ws, "BTC_JPY", "JRF-1", 101)
+	if err != nil || result.Outcome != Replaced || result.NewAcceptanceID != "JRF-2" {
+		t.Errorf("Expected the replacement to be reconciled, got %+v, %v", result, err)
+	}
+	if sent := server.requests(); len(sent) != 1 {
+		t.Errorf("Expected a single send, got %+v", sent)
+	}
+
+	// The replacement cannot be found yet
+	server = &replaceServer{event: "CANCEL", states: []string{"CANCELED"}, sendDelay: 200 * time.Millisecond}
+	client, ws = newReplaceTest(t, server, opts...)
+	result, err = client.Replace(ctx, ws, "BTC_JPY", "JRF-1", 101)
+	if !errors.Is(err, ErrAmbiguous) || result.Outcome != ReplaceAmbiguous || result.Tag == "" || result.ResentSize != 0.6 {
+		t.Fatalf("Expected an ambiguous replacement, got %+v, %v", result, err)
+	}
+
+	// Submitting the tag again finds the replacement instead of sending it twice
+	server.mu.Lock()
+	server.listSent = true
+	server.mu.Unlock()
+	s, err := client.SubmitChildOrder(ctx, result.Tag, result.Request)
+	if err != nil || s.AcceptanceID != "JRF-2" || !s.Reconciled {
+		t.Errorf("Expected the replacement to be reconciled, got %+v, %v", s, err)
+	}
+	if sent := server.requests(); len(sent) != 1 {
+		t.Errorf("Expected a single send, got %+v", sent)
+	}
+}
+
+func TestReplace_CallerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// Cancel once the old order is known to be closed, before the new one
+	// is sent
+	gate := gateFunc(func(string) error {
+		cancel()
+		return nil
+	})
+	server := &replaceServer{event: "CANCEL", states: []string{"CANCELED"}}
+	client, ws := newReplaceTest(t, server, WithReplaceTimeout(time.Second), WithGate(gate))
+
+	result, err := client.Replace(ctx, ws, "BTC_JPY", "JRF-1", 101)
+	if err == nil || result.Outcome != ReplaceCanceled || len(server.requests()) != 0 {
+		t.Errorf("Expected nothing to be sent for a canceled caller, got %+v, %v", result, err)
+	}
+}
+
+// gateFunc adapts a function to a Gate
+type gateFunc func(productCode string) error
+
+func (f gateFunc) Allow(productCode string) error {
+	return f(productCode)
+}
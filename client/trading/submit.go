@@ -0,0 +1,309 @@
+package trading
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+const (
+	defaultSubmitAttempts = 3
+	defaultSubmitTimeout  = 10 * time.Second
+	defaultReconcileDelay = 2 * time.Second
+	// reconcileCount is the number of latest orders searched for a match
+	reconcileCount = 100
+	// reconcileSkew tolerates the difference between the local clock and
+	// the order dates of the exchange
+	reconcileSkew = time.Minute
+)
+
+// ErrAmbiguous is returned by SubmitChildOrder when it cannot tell whether
+// the order was accepted. Submitting the same tag again reconciles first,
+// so it never sends a second order for an accepted one.
+var ErrAmbiguous = errors.New("order submission outcome unknown")
+
+// WithSubmitAttempts sets how many times SubmitChildOrder sends an order
+// whose earlier attempts failed ambiguously and were not found among the
+// orders, 3 by default
+func WithSubmitAttempts(n int) Option {
+	return func(c *Client) {
+		c.submitAttempts = n
+	}
+}
+
+// WithSubmitTimeout bounds every send of SubmitChildOrder, 10 seconds by
+// default. A send that times out is reconciled.
+func WithSubmitTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.submitTimeout = d
+	}
+}
+
+// WithReconcileDelay sets how long SubmitChildOrder waits after an
+// ambiguous failure before searching the orders, 2 seconds by default. The
+// order list can lag behind the acceptance of an order, and an order that
+// is not listed yet would be sent twice.
+func WithReconcileDelay(d time.Duration) Option {
+	return func(c *Client) {
+		c.reconcileDelay = d
+	}
+}
+
+// Submission is the state of a tagged order
+type Submission struct {
+	Tag          string
+	AcceptanceID string    // empty while the outcome is unknown
+	Attempts     int       // number of sends
+	Reconciled   bool      // the acceptance ID was found among the orders after an ambiguous failure
+	SentAt       time.Time // time of the last send
+}
+
+// submission is a tracked tag
+type submission struct {
+	Submission
+	req      http.NewOrderRequest
+	inFlight bool
+	claim    string // acceptance ID found by reconcile, claimed until settled
+}
+
+// NewOrderTag returns a random tag for SubmitChildOrder
+func NewOrderTag() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SubmitChildOrder sends a child order at most once per client-assigned
+// tag. When a send fails without telling whether the order was accepted,
+// as on a timeout or a 5xx response, the latest orders of the product are
+// searched for one placed since the send with the same side, type, size
+// and price and not claimed by another tag. The order is sent again only
+// when none is found.
+//
+// Submitting a tag that has an acceptance ID returns it without sending.
+// Submitting a tag whose outcome is unknown reconciles before sending.
+// Orders placed with SendChildOrder are not tracked and may be mistaken for
+// a tagged order with the same parameters.
+func (c *Client) SubmitChildOrder(ctx context.Context, tag string, req http.NewOrderRequest) (Submission, error) {
+	if tag == "" {
+		return Submission{}, fmt.Errorf("invalid order: tag is empty")
+	}
+	req, err := c.admit(req)
+	if err != nil {
+		return Submission{Tag: tag}, err
+	}
+
+	c.mu.Lock()
+	s, ok := c.submissions[tag]
+	switch {
+	case !ok:
+		s = &submission{Submission: Submission{Tag: tag}, req: req}
+		c.submissions[tag] = s
+	case s.AcceptanceID != "":
+		done := s.Submission
+		c.mu.Unlock()
+		return done, nil
+	case s.inFlight:
+		c.mu.Unlock()
+		return Submission{Tag: tag}, fmt.Errorf("order tag %s is being submitted", tag)
+	case !sameOrder(s.req, req):
+		c.mu.Unlock()
+		return Submission{Tag: tag}, fmt.Errorf("order tag %s is used by another order", tag)
+	}
+	s.inFlight = true
+	state := s.Submission
+	c.mu.Unlock()
+
+	unresolved := state.Attempts > 0
+	var lastErr error
+	for sends := 0; ; sends++ {
+		if unresolved {
+			id, err := c.reconcile(ctx, s, state.SentAt)
+			if err != nil {
+				return c.settle(s, state), fmt.Errorf("%w: %w", ErrAmbiguous, err)
+			}
+			if id != "" {
+				state.AcceptanceID, state.Reconciled = id, true
+				return c.settle(s, state), nil
+			}
+		}
+		if sends == c.submitAttempts {
+			return c.settle(s, state), fmt.Errorf("%w: %w", ErrAmbiguous, lastErr)
+		}
+		if err := ctx.Err(); err != nil && state.Attempts == 0 {
+			// Nothing was sent, so the tag may be submitted again
+			c.ForgetSubmission(tag)
+			return state, fmt.Errorf("failed to send child order: %w", err)
+		}
+
+		state.Attempts++
+		state.SentAt = time.Now()
+		sendCtx, cancel := context.WithTimeout(ctx, c.submitTimeout)
+		id, err := c.send(sendCtx, req)
+		cancel()
+		if err == nil {
+			state.AcceptanceID = id
+			return c.settle(s, state), nil
+		}
+		if !ambiguous(err) {
+			if state.Attempts > 1 {
+				// An earlier ambiguous send may have been accepted after all
+				id, recErr := c.reconcile(ctx, s, state.SentAt)
+				if recErr != nil {
+					return c.settle(s, state), fmt.Errorf("%w: %w", ErrAmbiguous, recErr)
+				}
+				if id != "" {
+					state.AcceptanceID, state.Reconciled = id, true
+					return c.settle(s, state), nil
+				}
+			}
+			// The order was rejected, so the tag may be submitted again
+			c.ForgetSubmission(tag)
+			return state, err
+		}
+		unresolved = true
+		lastErr = err
+	}
+}
+
+// Submission returns the state of a tag
+func (c *Client) Submission(tag string) (Submission, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.submissions[tag]
+	if !ok {
+		return Submission{}, false
+	}
+	return s.Submission, true
+}
+
+// ForgetSubmission stops tracking a tag, for example once its order is
+// closed. A forgotten tag can be submitted again as a new order.
+func (c *Client) ForgetSubmission(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.submissions, tag)
+}
+
+// settle stores the state of a submission that is no longer in flight
+func (c *Client) settle(s *submission, state Submission) Submission {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.Submission = state
+	s.inFlight = false
+	s.claim = ""
+	return state
+}
+
+// reconcile returns the acceptance ID of the earliest order matching the
+// request of s that was placed since sentAt and is not claimed by a tag, or
+// an empty string if there is none. The ID is claimed for s at once, so that
+// concurrent tags cannot take the same order.
+func (c *Client) reconcile(ctx context.Context, s *submission, sentAt time.Time) (string, error) {
+	req := s.req
+	timer := time.NewTimer(c.reconcileDelay)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+		return "", fmt.Errorf("failed to reconcile child order: %w", ctx.Err())
+	}
+
+	count := reconcileCount
+	resp, err := c.api.GetV1MeGetchildordersWithResponse(ctx, &http.GetV1MeGetchildordersParams{
+		ProductCode: req.ProductCode,
+		Count:       &count,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to reconcile child order: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return "", fmt.Errorf("failed to reconcile child order: %w", err)
+	}
+	if resp.JSON200 == nil {
+		return "", nil
+	}
+
+	from := sentAt.Add(-reconcileSkew)
+	var matches []http.ChildOrder
+	for _, o := range *resp.JSON200 {
+		if o.ChildOrderAcceptanceId == nil || o.ChildOrderDate == nil || o.ChildOrderDate.Before(from) || !matchesOrder(o, req) {
+			continue
+		}
+		matches = append(matches, o)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].ChildOrderDate.Before(*matches[j].ChildOrderDate)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	claimed := make(map[string]bool, len(c.submissions))
+	for _, other := range c.submissions {
+		if other.AcceptanceID != "" {
+			claimed[other.AcceptanceID] = true
+		}
+		if other.claim != "" {
+			claimed[other.claim] = true
+		}
+	}
+	for _, o := range matches {
+		if !claimed[*o.ChildOrderAcceptanceId] {
+			s.claim = *o.ChildOrderAcceptanceId
+			return s.claim, nil
+		}
+	}
+	return "", nil
+}
+
+// ambiguous reports whether a send error leaves it unknown whether the
+// order was accepted. Only a 4xx response is a certain rejection.
+func ambiguous(err error) bool {
+	var apiErr *http.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return true
+}
+
+// matchesOrder reports whether an order has the side, type, size and, for a
+// LIMIT order, the price of req
+func matchesOrder(o http.ChildOrder, req http.NewOrderRequest) bool {
+	if o.Side == nil || string(*o.Side) != string(req.Side) ||
+		o.ChildOrderType == nil || string(*o.ChildOrderType) != string(req.ChildOrderType) ||
+		o.Size == nil || !sameValue(*o.Size, req.Size) {
+		return false
+	}
+	if req.ChildOrderType == http.NewOrderRequestChildOrderTypeLIMIT {
+		return o.Price != nil && req.Price != nil && sameValue(*o.Price, *req.Price)
+	}
+	return true
+}
+
+// sameValue reports whether a value echoed by the API is the value sent,
+// allowing for one float32 step of rounding since prices above 2^24 and
+// sizes with many digits cannot be held exactly
+func sameValue(echoed, sent float32) bool {
+	return echoed == sent || math.Nextafter32(echoed, sent) == sent
+}
+
+// sameOrder reports whether two requests are for the same order
+func sameOrder(a, b http.NewOrderRequest) bool {
+	return a.ProductCode == b.ProductCode && a.Side == b.Side && a.ChildOrderType == b.ChildOrderType &&
+		a.Size == b.Size && equalPtr(a.Price, b.Price) &&
+		equalPtr(a.MinuteToExpire, b.MinuteToExpire) && equalPtr(a.TimeInForce, b.TimeInForce)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
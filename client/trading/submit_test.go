@@ -0,0 +1,313 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// submitServer stubs the order endpoints used by SubmitChildOrder
+type submitServer struct {
+	mu      sync.Mutex
+	replies []func(w http.ResponseWriter) // replies to sends in turn
+	orders  []string                      // child orders listed by getchildorders
+	late    []string                      // child orders listed from the second list on
+	listErr bool
+	sends   int
+	lists   int
+}
+
+func (s *submitServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/v1/me/sendchildorder":
+		reply := s.replies[min(s.sends, len(s.replies)-1)]
+		s.sends++
+		reply(w)
+	case "/v1/me/getchildorders":
+		s.lists++
+		if s.listErr {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		orders := s.orders
+		if s.lists > 1 {
+			orders = append(orders, s.late...)
+		}
+		body := "["
+		for i, o := range orders {
+			if i > 0 {
+				body += ","
+			}
+			body += o
+		}
+		_, _ = w.Write([]byte(body + "]"))
+	}
+}
+
+func (s *submitServer) counts() (sends, lists int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sends, s.lists
+}
+
+func accepted(id string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		_, _ = fmt.Fprintf(w, `{"child_order_acceptance_id":%q}`, id)
+	}
+}
+
+func failed(status int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"status":-1,"error_message":"error","data":null}`))
+	}
+}
+
+// acceptedLate accepts the order after the send timed out
+func acceptedLate(id string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		time.Sleep(100 * time.Millisecond)
+		accepted(id)(w)
+	}
+}
+
+func listedOrder(id string, size float64, date time.Time) string {
+	return listedOrderAt(id, 3000000, size, date)
+}
+
+func listedOrderAt(id string, price, size float64, date time.Time) string {
+	return fmt.Sprintf(`{"child_order_acceptance_id":%q,"product_code":"BTC_JPY","side":"BUY","child_order_type":"LIMIT",`+
+		`"price":%v,"size":%v,"child_order_state":"ACTIVE","child_order_date":%q}`, id, price, size, date.Format(time.RFC3339Nano))
+}
+
+func newSubmitTest(t *testing.T, s *submitServer) *Client {
+	t.Helper()
+	client := newTestClient(t, s.handle)
+	for _, opt := range []Option{WithSubmitTimeout(50 * time.Millisecond), WithReconcileDelay(time.Millisecond)} {
+		opt(client)
+	}
+	return client
+}
+
+func TestSubmitChildOrder(t *testing.T) {
+	now := time.Now()
+	order := LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 3000000, 0.01)
+
+	tests := []struct {
+		name      string
+		server    *submitServer
+		want      Submission
+		wantSends int
+		wantLists int
+	}{
+		{
+			name:      "accepted",
+			server:    &submitServer{replies: []func(http.ResponseWriter){accepted("JRF-1")}},
+			want:      Submission{Tag: "tag", AcceptanceID: "JRF-1", Attempts: 1},
+			wantSends: 1,
+		},
+		{
+			name: "timeout reconciled",
+			server: &submitServer{
+				replies: []func(http.ResponseWriter){acceptedLate("JRF-1")},
+				orders: []string{
+					listedOrder("JRF-0", 0.02, now),
+					listedOrder("JRF-1", 0.01, now),
+				},
+			},
+			want:      Submission{Tag: "tag", AcceptanceID: "JRF-1", Attempts: 1, Reconciled: true},
+			wantSends: 1,
+			wantLists: 1,
+		},
+		{
+			name: "5xx not found is retried",
+			server: &submitServer{
+				replies: []func(http.ResponseWriter){failed(http.StatusInternalServerError), accepted("JRF-2")},
+				orders:  []string{listedOrder("JRF-OLD", 0.01, now.Add(-time.Hour))},
+			},
+			want:      Submission{Tag: "tag", AcceptanceID: "JRF-2", Attempts: 2},
+			wantSends: 2,
+			wantLists: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newSubmitTest(t, tt.server)
+
+			got, err := client.SubmitChildOrder(context.Background(), "tag", order)
+			if err != nil {
+				t.Fatalf("SubmitChildOrder() error = %v", err)
+			}
+			got.SentAt = time.Time{}
+			if got != tt.want {
+				t.Errorf("SubmitChildOrder() = %+v, want %+v", got, tt.want)
+			}
+
+			// The same tag is never sent again
+			again, err := client.SubmitChildOrder(context.Background(), "tag", order)
+			if err != nil || again.AcceptanceID != tt.want.AcceptanceID {
+				t.Errorf("Expected the tag to return %s again, got %+v, %v", tt.want.AcceptanceID, again, err)
+			}
+			if sends, lists := tt.server.counts(); sends != tt.wantSends || lists != tt.wantLists {
+				t.Errorf("Expected %d sends and %d lists, got %d and %d", tt.wantSends, tt.wantLists, sends, lists)
+			}
+		})
+	}
+}
+
+func TestSubmitChildOrder_Rejected(t *testing.T) {
+	server := &submitServer{replies: []func(http.ResponseWriter){failed(http.StatusBadRequest), accepted("JRF-1")}}
+	client := newSubmitTest(t, server)
+	order := MarketOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0.01)
+
+	_, err := client.SubmitChildOrder(context.Background(), "tag", order)
+	var apiErr *bfhttp.APIError
+	if !errors.As(err, &apiErr) || errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("Expected a certain rejection, got %v", err)
+	}
+	if _, ok := client.Submission("tag"); ok {
+		t.Error("Expected a rejected tag to be forgotten")
+	}
+	if sends, lists := server.counts(); sends != 1 || lists != 0 {
+		t.Errorf("Expected a single send and no reconciliation, got %d sends and %d lists", sends, lists)
+	}
+
+	if s, err := client.SubmitChildOrder(context.Background(), "tag", order); err != nil || s.AcceptanceID != "JRF-1" {
+		t.Errorf("Expected the tag to be submitted again, got %+v, %v", s, err)
+	}
+}
+
+func TestSubmitChildOrder_RejectedAfterAmbiguous(t *testing.T) {
+	// The first send was accepted but only shows up after the second one is rejected
+	server := &submitServer{
+		replies: []func(http.ResponseWriter){failed(http.StatusBadGateway), failed(http.StatusBadRequest)},
+		late:    []string{listedOrder("JRF-1", 0.01, time.Now())},
+	}
+	client := newSubmitTest(t, server)
+	order := LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 3000000, 0.01)
+
+	s, err := client.SubmitChildOrder(context.Background(), "tag", order)
+	if err != nil || s.AcceptanceID != "JRF-1" || !s.Reconciled || s.Attempts != 2 {
+		t.Fatalf("Expected the earlier send to be reconciled, got %+v, %v", s, err)
+	}
+	if got, ok := client.Submission("tag"); !ok || got.AcceptanceID != "JRF-1" {
+		t.Errorf("Expected the tag to keep JRF-1, got %+v, %v", got, ok)
+	}
+	if sends, lists := server.counts(); sends != 2 || lists != 2 {
+		t.Errorf("Expected 2 sends and 2 lists, got %d and %d", sends, lists)
+	}
+}
+
+func TestSubmitChildOrder_RoundedEcho(t *testing.T) {
+	// float32 cannot hold 17000001, and the listed price is one step away
+	server := &submitServer{
+		replies: []func(http.ResponseWriter){acceptedLate("JRF-1")},
+		orders:  []string{listedOrderAt("JRF-1", 17000002, 0.12345678, time.Now())},
+	}
+	client := newSubmitTest(t, server)
+	order := LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 17000001, 0.12345678)
+
+	s, err := client.SubmitChildOrder(context.Background(), "tag", order)
+	if err != nil || s.AcceptanceID != "JRF-1" || !s.Reconciled {
+		t.Errorf("Expected the order to be reconciled, got %+v, %v", s, err)
+	}
+}
+
+func TestSubmitChildOrder_ClaimedOrders(t *testing.T) {
+	now := time.Now()
+	server := &submitServer{
+		replies: []func(http.ResponseWriter){accepted("JRF-1"), failed(http.StatusBadGateway), accepted("JRF-2")},
+		orders:  []string{listedOrder("JRF-1", 0.01, now)},
+	}
+	client := newSubmitTest(t, server)
+	order := LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 3000000, 0.01)
+
+	if _, err := client.SubmitChildOrder(context.Background(), "first", order); err != nil {
+		t.Fatalf("SubmitChildOrder() error = %v", err)
+	}
+	// JRF-1 matches but belongs to the first tag
+	s, err := client.SubmitChildOrder(context.Background(), "second", order)
+	if err != nil || s.AcceptanceID != "JRF-2" || s.Reconciled {
+		t.Errorf("Expected the second order to be sent again, got %+v, %v", s, err)
+	}
+}
+
+func TestReconcile_Claims(t *testing.T) {
+	server := &submitServer{orders: []string{listedOrder("JRF-1", 0.01, time.Now())}}
+	client := newSubmitTest(t, server)
+	order := LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 3000000, 0.01)
+
+	// Two tags with the same order are both being reconciled
+	first := &submission{Submission: Submission{Tag: "first"}, req: order, inFlight: true}
+	second := &submission{Submission: Submission{Tag: "second"}, req: order, inFlight: true}
+	client.submissions["first"], client.submissions["second"] = first, second
+
+	ctx := context.Background()
+	if id, err := client.reconcile(ctx, first, time.Now()); err != nil || id != "JRF-1" {
+		t.Fatalf("reconcile() = %q, %v, want JRF-1", id, err)
+	}
+	if id, err := client.reconcile(ctx, second, time.Now()); err != nil || id != "" {
+		t.Errorf("Expected JRF-1 to stay claimed by the first tag, got %q, %v", id, err)
+	}
+}
+
+func TestSubmitChildOrder_Unresolved(t *testing.T) {
+	server := &submitServer{
+		replies: []func(http.ResponseWriter){failed(http.StatusServiceUnavailable)},
+		listErr: true,
+	}
+	client := newSubmitTest(t, server)
+	order := LimitOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 3000000, 0.01)
+
+	_, err := client.SubmitChildOrder(context.Background(), "tag", order)
+	if !errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("Expected ErrAmbiguous, got %v", err)
+	}
+	if s, ok := client.Submission("tag"); !ok || s.AcceptanceID != "" || s.Attempts != 1 {
+		t.Fatalf("Expected the tag to stay unresolved, got %+v, %v", s, ok)
+	}
+
+	if _, err := client.SubmitChildOrder(context.Background(), "tag", MarketOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0.01)); err == nil {
+		t.Error("Expected the tag to be refused for another order")
+	}
+
+	// The order shows up once the API recovers
+	server.mu.Lock()
+	server.listErr = false
+	server.orders = []string{listedOrder("JRF-1", 0.01, time.Now())}
+	server.mu.Unlock()
+
+	s, err := client.SubmitChildOrder(context.Background(), "tag", order)
+	if err != nil || s.AcceptanceID != "JRF-1" || !s.Reconciled {
+		t.Errorf("Expected the order to be reconciled, got %+v, %v", s, err)
+	}
+	if sends, _ := server.counts(); sends != 1 {
+		t.Errorf("Expected no second send, got %d sends", sends)
+	}
+}
+
+func TestSubmitChildOrder_Exhausted(t *testing.T) {
+	server := &submitServer{replies: []func(http.ResponseWriter){failed(http.StatusInternalServerError)}}
+	client := newSubmitTest(t, server)
+	WithSubmitAttempts(2)(client)
+
+	_, err := client.SubmitChildOrder(context.Background(), "tag", MarketOrder("BTC_JPY", bfhttp.NewOrderRequestSideBUY, 0.01))
+	if !errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("Expected ErrAmbiguous, got %v", err)
+	}
+	// Every send is reconciled, including the last one
+	if sends, lists := server.counts(); sends != 2 || lists != 2 {
+		t.Errorf("Expected 2 sends and 2 lists, got %d and %d", sends, lists)
+	}
+}
@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+)
+
+// Channel name prefixes of the public channels
+const (
+	TickerChannelPrefix        = "lightning_ticker_"
+	ExecutionsChannelPrefix    = "lightning_executions_"
+	BoardChannelPrefix         = "lightning_board_"
+	BoardSnapshotChannelPrefix = "lightning_board_snapshot_"
+)
+
+// Private channel names
+const (
+	ChildOrderEventsChannel  = "child_order_events"
+	ParentOrderEventsChannel = "parent_order_events"
+)
+
+// TickerChannel returns the ticker channel name for the product
+func TickerChannel(productCode string) string {
+	return TickerChannelPrefix + productCode
+}
+
+// ExecutionsChannel returns the executions channel name for the product
+func ExecutionsChannel(productCode string) string {
+	return ExecutionsChannelPrefix + productCode
+}
+
+// BoardChannel returns the board diff channel name for the product
+func BoardChannel(productCode string) string {
+	return BoardChannelPrefix + productCode
+}
+
+// BoardSnapshotChannel returns the board snapshot channel name for the product
+func BoardSnapshotChannel(productCode string) string {
+	return BoardSnapshotChannelPrefix + productCode
+}
+
+// ProductResolver resolves product codes and aliases, such as BTCJPY_MAT1WK,
+// to the product codes used in channel names and messages.
+// *markets.Catalog implements this interface.
+type ProductResolver interface {
+	Resolve(codeOrAlias string) (string, error)
+}
+
+// SetProductResolver sets the resolver used by typed subscriptions and
+// streams. Without one, product codes are used as given.
+func (c *Client) SetProductResolver(resolver ProductResolver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.productResolver = resolver
+}
+
+// SubscribeTicker subscribes to the ticker channel of the product
+func (c *Client) SubscribeTicker(ctx context.Context, productCode string) error {
+	return c.subscribeProduct(ctx, TickerChannelPrefix, productCode)
+}
+
+// SubscribeExecutions subscribes to the executions channel of the product
+func (c *Client) SubscribeExecutions(ctx context.Context, productCode string) error {
+	return c.subscribeProduct(ctx, ExecutionsChannelPrefix, productCode)
+}
+
+// SubscribeBoard subscribes to the board diff channel of the product
+func (c *Client) SubscribeBoard(ctx context.Context, productCode string) error {
+	return c.subscribeProduct(ctx, BoardChannelPrefix, productCode)
+}
+
+// SubscribeBoardSnapshot subscribes to the board snapshot channel of the product
+func (c *Client) SubscribeBoardSnapshot(ctx context.Context, productCode string) error {
+	return c.subscribeProduct(ctx, BoardSnapshotChannelPrefix, productCode)
+}
+
+// subscribeProduct resolves the product code and subscribes to prefix+productCode
+func (c *Client) subscribeProduct(ctx context.Context, prefix, productCode string) error {
+	code, err := c.resolveProduct(productCode)
+	if err != nil {
+		return err
+	}
+	return c.Subscribe(ctx, prefix+code)
+}
+
+// resolveProduct returns the product code for a product code or alias with
+// the resolver, if any
+func (c *Client) resolveProduct(codeOrAlias string) (string, error) {
+	if codeOrAlias == "" {
+		return "", fmt.Errorf("product code is empty")
+	}
+
+	c.mu.Lock()
+	resolver := c.productResolver
+	c.mu.Unlock()
+
+	if resolver == nil {
+		return codeOrAlias, nil
+	}
+	code, err := resolver.Resolve(codeOrAlias)
+	if err != nil {
+		return "", fmt.Errorf("invalid product code %s: %w", codeOrAlias, err)
+	}
+	return code, nil
+}
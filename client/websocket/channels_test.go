@@ -0,0 +1,64 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// stubResolver resolves the listed product codes and aliases
+type stubResolver map[string]string
+
+func (r stubResolver) Resolve(codeOrAlias string) (string, error) {
+	code, ok := r[codeOrAlias]
+	if !ok {
+		return "", errors.New("unknown product code")
+	}
+	return code, nil
+}
+
+func TestChannelNames(t *testing.T) {
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{TickerChannel("BTC_JPY"), "lightning_ticker_BTC_JPY"},
+		{ExecutionsChannel("BTC_JPY"), "lightning_executions_BTC_JPY"},
+		{BoardChannel("FX_BTC_JPY"), "lightning_board_FX_BTC_JPY"},
+		{BoardSnapshotChannel("FX_BTC_JPY"), "lightning_board_snapshot_FX_BTC_JPY"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, tt.got)
+		}
+	}
+}
+
+func TestSubscribeProduct_Resolution(t *testing.T) {
+	client := &Client{
+		subscribedChannels: make(map[string]struct{}),
+	}
+	client.SetProductResolver(stubResolver{"BTC_JPY": "BTC_JPY", "BTCJPY_MAT1WK": "BTCJPY24OCT2026"})
+
+	if err := client.SubscribeTicker(context.Background(), "ETH_BTC"); err == nil {
+		t.Error("Expected error for unknown product code, got nil")
+	}
+	if err := client.SubscribeBoard(context.Background(), ""); err == nil {
+		t.Error("Expected error for empty product code, got nil")
+	}
+	if len(client.subscribedChannels) != 0 {
+		t.Errorf("Expected no subscriptions, got %v", client.subscribedChannels)
+	}
+
+	// A known product reaches Subscribe, which rejects duplicates
+	client.subscribedChannels[TickerChannel("BTC_JPY")] = struct{}{}
+	if err := client.SubscribeTicker(context.Background(), "BTC_JPY"); err == nil {
+		t.Error("Expected already subscribed error, got nil")
+	}
+	// An alias subscribes to the channel of the product code
+	client.subscribedChannels[TickerChannel("BTCJPY24OCT2026")] = struct{}{}
+	if err := client.SubscribeTicker(context.Background(), "BTCJPY_MAT1WK"); err == nil {
+		t.Error("Expected the alias to resolve to the subscribed channel, got nil")
+	}
+}
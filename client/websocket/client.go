@@ -7,17 +7,26 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/tracing"
 )
 
+// queueSize is the number of received frames held before the receive loop
+// waits for the listeners
+const queueSize = 1024
+
 // Client represents a bitFlyer WebSocket API client
 type Client struct {
 	conn                 *websocket.Conn
@@ -25,15 +34,50 @@ type Client struct {
 	mu                   sync.Mutex
 	jsonRPCID            int
 	subscribedChannels   map[string]struct{}
-	messageHandlers      map[string]MessageHandler
-	tickerHandler        func(TickerMessage)
-	executionsHandler    func(ExecutionsMessage)
-	boardHandler         func(BoardMessage)
-	boardSnapshotHandler func(BoardSnapshotMessage)
-	privateOrderHandler  func(OrderEventMessage)
-	receiveCancel        context.CancelFunc // stops the receiveMessages goroutine on Close
+	streamMu             sync.Mutex     // serializes acquire and release
+	streamRefs           map[string]int // streams per channel
+	streamOwned          map[string]struct{}
+	nextListenerID       uint64
+	tickerListeners      []*listener[TickerMessage]
+	executionsListeners  []*listener[ExecutionsMessage]
+	boardListeners       []*listener[BoardMessage]
+	snapshotListeners    []*listener[BoardSnapshotMessage]
+	orderListeners       []*listener[OrderEventMessage]
+	rawListeners         []*listener[channelMessage]
+	unknownListeners     []*listener[channelMessage]
+	decodeErrorListeners []*listener[decodeFailure]
+	productResolver      ProductResolver
+	metrics              Metrics
+	logger               *slog.Logger
+	tracer               trace.Tracer
+	linker               *tracing.OrderLinker
+	pending              atomic.Int64         // messages received but not handled yet
+	queue                chan json.RawMessage // frames waiting to be handled, in order
+	receiveCancel        context.CancelFunc   // stops the receiveMessages goroutine on Close
+	done                 chan struct{}        // closed when the receive loop ends
+	apiKey               string               // kept to authenticate again after a reconnect
+	apiSecret            string
+
+	// Watchdog, see watchdog.go
+	pingInterval        time.Duration
+	staleTimeout        time.Duration
+	gapThreshold        int64
+	autoReconnect       bool
+	reconnectMu         sync.Mutex     // serializes reconnects
+	restoring           map[int]string // requests sent by Reconnect and not answered yet, by ID
+	watchMu             sync.Mutex
+	lastMessage         map[string]time.Time
+	staleReported       map[string]struct{}
+	lastExecID          map[string]int64
+	staleListeners      []*listener[StaleChannel]
+	gapListeners        []*listener[ExecutionGap]
+	reconnectListeners  []*listener[struct{}]
+	disconnectListeners []*listener[error]
 }
 
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
 // JSON-RPC message structure
 type jsonRPCRequest struct {
 	Version string      `json:"jsonrpc"`
@@ -45,6 +89,24 @@ type jsonRPCRequest struct {
 // MessageHandler is a function type that processes messages from a specific channel
 type MessageHandler func(channel string, data json.RawMessage)
 
+// DecodeErrorHandler is a function type that receives data that could not be
+// decoded. channel is empty and raw is the whole frame when the frame itself
+// is malformed; otherwise raw is the channel message.
+type DecodeErrorHandler func(channel string, raw []byte, err error)
+
+// channelMessage is an undecoded channel message passed to raw listeners
+type channelMessage struct {
+	channel string
+	raw     json.RawMessage
+}
+
+// decodeFailure is passed to decode error listeners
+type decodeFailure struct {
+	channel string
+	raw     []byte
+	err     error
+}
+
 // Message type definitions
 type TickerMessage struct {
 	ProductCode     string  `json:"product_code"`
@@ -112,7 +174,42 @@ type OrderEventMessage struct {
 }
 
 // NewClient creates a new WebSocket client
-func NewClient(ctx context.Context, wsURL string) (*Client, error) {
+func NewClient(ctx context.Context, wsURL string, opts ...ClientOption) (*Client, error) {
+	client := &Client{
+		wsURL:              wsURL,
+		jsonRPCID:          1,
+		subscribedChannels: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	conn, err := client.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client.conn = conn
+
+	// Use an independent context for the receive loop so it is not tied to the
+	// short-lived dial context (which expires after 30 s). The loop runs until
+	// Close() is called.
+	receiveCtx, receiveCancel := context.WithCancel(context.Background())
+	client.receiveCancel = receiveCancel
+	client.done = make(chan struct{})
+	client.queue = make(chan json.RawMessage, queueSize)
+
+	// Start message receiving loop
+	go client.receiveMessages(receiveCtx)
+	go client.handleMessages(receiveCtx)
+	if client.pingInterval > 0 || client.staleTimeout > 0 {
+		go client.watch(receiveCtx)
+	}
+
+	return client, nil
+}
+
+// dial opens a connection to the realtime API
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
 	// Enable TCP keepalive so the OS sends keepalive probes every 30 seconds.
 	// This prevents VPS NAT firewalls from silently dropping idle TCP connections
 	// (typical NAT idle timeout: 30–60 minutes) during low-volatility periods when
@@ -124,32 +221,22 @@ func NewClient(ctx context.Context, wsURL string) (*Client, error) {
 		DialContext: netDialer.DialContext,
 	}
 
-	// Connect to WebSocket
-	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+	conn, _, err := websocket.Dial(ctx, c.wsURL, &websocket.DialOptions{
 		HTTPClient: &http.Client{Transport: transport},
 	})
 	if err != nil {
+		c.log().Warn("websocket connection failed", "url", c.wsURL, "error", err)
 		return nil, fmt.Errorf("websocket connection error: %w", err)
 	}
+	c.log().Info("websocket connected", "url", c.wsURL)
+	return conn, nil
+}
 
-	// Use an independent context for the receive loop so it is not tied to the
-	// short-lived dial context (which expires after 30 s). The loop runs until
-	// Close() is called.
-	receiveCtx, receiveCancel := context.WithCancel(context.Background())
-
-	client := &Client{
-		conn:               conn,
-		wsURL:              wsURL,
-		jsonRPCID:          1,
-		subscribedChannels: make(map[string]struct{}),
-		messageHandlers:    make(map[string]MessageHandler),
-		receiveCancel:      receiveCancel,
-	}
-
-	// Start message receiving loop
-	go client.receiveMessages(receiveCtx)
-
-	return client, nil
+// currentConn returns the connection in use
+func (c *Client) currentConn() *websocket.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
 }
 
 // Close closes the WebSocket connection
@@ -158,62 +245,90 @@ func (c *Client) Close(ctx context.Context) {
 	if c.receiveCancel != nil {
 		c.receiveCancel()
 	}
-	if c.conn != nil {
-		err := c.conn.Close(websocket.StatusNormalClosure, "client closed")
+	if conn := c.currentConn(); conn != nil {
+		err := conn.Close(websocket.StatusNormalClosure, "client closed")
 		if err != nil {
-			// Log the error or handle it according to context
-			fmt.Printf("An error occurred while closing the WebSocket connection: %v\n", err)
+			c.log().Warn("failed to close websocket connection", "url", c.wsURL, "error", err)
+			return
 		}
+		c.log().Info("websocket closed", "url", c.wsURL)
 	}
 }
 
+// Done returns a channel that is closed when the connection is lost or
+// closed. With WithAutoReconnect it is only closed when a lost connection
+// could not be restored.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
 // Ping sends a WebSocket ping frame and waits for a pong response.
 // This can be called periodically to keep the connection alive through NAT
 // firewalls that drop idle TCP connections.
 func (c *Client) Ping(ctx context.Context) error {
-	if c.conn == nil {
+	conn := c.currentConn()
+	if conn == nil {
 		return fmt.Errorf("websocket connection is not established")
 	}
-	return c.conn.Ping(ctx)
+	return conn.Ping(ctx)
 }
 
-// OnTicker sets a callback to receive ticker information
-func (c *Client) OnTicker(handler func(TickerMessage)) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.tickerHandler = handler
+// OnTicker registers a callback to receive ticker information. Every call
+// adds a listener; remove it with the returned handle.
+func (c *Client) OnTicker(handler func(TickerMessage), opts ...ListenerOption) *Listener {
+	return addListener(c, &c.tickerListeners, handler, opts)
 }
 
-// OnExecutions sets a callback to receive execution information
-func (c *Client) OnExecutions(handler func(ExecutionsMessage)) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.executionsHandler = handler
+// OnExecutions registers a callback to receive execution information
+func (c *Client) OnExecutions(handler func(ExecutionsMessage), opts ...ListenerOption) *Listener {
+	return addListener(c, &c.executionsListeners, handler, opts)
 }
 
-// OnBoard sets a callback to receive order book information
-func (c *Client) OnBoard(handler func(BoardMessage)) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.boardHandler = handler
+// OnBoard registers a callback to receive order book information
+func (c *Client) OnBoard(handler func(BoardMessage), opts ...ListenerOption) *Listener {
+	return addListener(c, &c.boardListeners, handler, opts)
 }
 
-// OnBoardSnapshot sets a callback to receive order book snapshots
-func (c *Client) OnBoardSnapshot(handler func(BoardSnapshotMessage)) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.boardSnapshotHandler = handler
+// OnBoardSnapshot registers a callback to receive order book snapshots
+func (c *Client) OnBoardSnapshot(handler func(BoardSnapshotMessage), opts ...ListenerOption) *Listener {
+	return addListener(c, &c.snapshotListeners, handler, opts)
 }
 
-// OnOrderEvents sets a callback to receive order events
-func (c *Client) OnOrderEvents(handler func(OrderEventMessage)) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.privateOrderHandler = handler
+// OnOrderEvents registers a callback to receive order events
+func (c *Client) OnOrderEvents(handler func(OrderEventMessage), opts ...ListenerOption) *Listener {
+	return addListener(c, &c.orderListeners, handler, opts)
+}
+
+// OnRaw registers a callback to receive the undecoded message of every
+// channel, before the typed handlers run
+func (c *Client) OnRaw(handler func(channel string, raw json.RawMessage)) *Listener {
+	return addListener(c, &c.rawListeners, func(m channelMessage) { handler(m.channel, m.raw) }, nil)
+}
+
+// OnDecodeError registers a callback to receive frames and messages that
+// could not be decoded, such as after a schema change
+func (c *Client) OnDecodeError(handler func(channel string, raw []byte, err error)) *Listener {
+	return addListener(c, &c.decodeErrorListeners, func(f decodeFailure) { handler(f.channel, f.raw, f.err) }, nil)
+}
+
+// OnUnknownChannel registers a callback to receive messages of channels that
+// have no typed handler, such as channels added to the API later
+func (c *Client) OnUnknownChannel(handler func(channel string, raw json.RawMessage)) *Listener {
+	return addListener(c, &c.unknownListeners, func(m channelMessage) { handler(m.channel, m.raw) }, nil)
 }
 
 // Auth authenticates for using private API
 func (c *Client) Auth(ctx context.Context, apiKey, apiSecret string) error {
+	c.mu.Lock()
+	c.apiKey, c.apiSecret = apiKey, apiSecret
+	c.mu.Unlock()
+
+	// Send authentication message
+	return c.sendJSONRPC(ctx, "auth", c.authParams(apiKey, apiSecret))
+}
+
+// authParams returns the params of an auth request
+func (c *Client) authParams(apiKey, apiSecret string) map[string]interface{} {
 	// Get current timestamp (using Unix timestamp as int64)
 	unixTime := time.Now().Unix()
 
@@ -227,15 +342,12 @@ func (c *Client) Auth(ctx context.Context, apiKey, apiSecret string) error {
 	signature := hex.EncodeToString(h.Sum(nil))
 
 	// Create authentication message
-	authParams := map[string]interface{}{
+	return map[string]interface{}{
 		"api_key":   apiKey,
 		"timestamp": unixTime,
 		"nonce":     nonce,
 		"signature": signature,
 	}
-
-	// Send authentication message
-	return c.sendJSONRPC(ctx, "auth", authParams)
 }
 
 // Subscribe subscribes to the specified channel
@@ -252,7 +364,13 @@ func (c *Client) Subscribe(ctx context.Context, channel string) error {
 		"channel": channel,
 	}
 
-	return c.sendJSONRPC(ctx, "subscribe", params)
+	if err := c.sendJSONRPC(ctx, "subscribe", params); err != nil {
+		c.log().Warn("failed to subscribe", "channel", channel, "error", err)
+		return err
+	}
+	c.log().Info("subscribed", "channel", channel)
+	c.watchChannel(channel)
+	return nil
 }
 
 // Unsubscribe cancels subscription to the specified channel
@@ -269,7 +387,13 @@ func (c *Client) Unsubscribe(ctx context.Context, channel string) error {
 		"channel": channel,
 	}
 
-	return c.sendJSONRPC(ctx, "unsubscribe", params)
+	if err := c.sendJSONRPC(ctx, "unsubscribe", params); err != nil {
+		c.log().Warn("failed to unsubscribe", "channel", channel, "error", err)
+		return err
+	}
+	c.log().Info("unsubscribed", "channel", channel)
+	c.unwatchChannel(channel)
+	return nil
 }
 
 // getNextID gets the next JSON-RPC ID
@@ -283,12 +407,18 @@ func (c *Client) getNextID() int {
 
 // sendJSONRPC sends a JSON-RPC message
 func (c *Client) sendJSONRPC(ctx context.Context, method string, params interface{}) error {
+	return c.sendRequest(ctx, c.getNextID(), method, params)
+}
+
+// sendRequest sends a JSON-RPC message with an ID taken from getNextID
+func (c *Client) sendRequest(ctx context.Context, id int, method string, params interface{}) error {
 	request := jsonRPCRequest{
 		Version: "2.0",
 		Method:  method,
 		Params:  params,
-		ID:      c.getNextID(),
+		ID:      id,
 	}
+	c.log().Debug("sending request", "method", method, "id", request.ID, "params", logParams(method, params))
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -302,16 +432,50 @@ func (c *Client) sendJSONRPC(ctx context.Context, method string, params interfac
 
 // receiveMessages is a continuous message receiving loop from WebSocket
 func (c *Client) receiveMessages(ctx context.Context) {
+	defer close(c.done)
+	defer close(c.queue)
 	for {
-		var response json.RawMessage
-		err := wsjson.Read(ctx, c.conn, &response)
+		// Read raw frames so that a malformed frame does not end the loop
+		conn := c.currentConn()
+		_, data, err := conn.Read(ctx)
 		if err != nil {
 			// End if connection is closed
+			if ctx.Err() != nil {
+				return
+			}
+			if c.currentConn() != conn {
+				// Replaced by Reconnect
+				continue
+			}
+			c.disconnected(err)
+			if c.autoReconnect {
+				c.log().Warn("websocket connection lost, reconnecting", "url", c.wsURL, "error", err)
+				if c.reconnectWithRetry(ctx) {
+					continue
+				}
+				return
+			}
+			c.log().Warn("websocket receive loop stopped", "url", c.wsURL, "error", err)
+			return
+		}
+		response := json.RawMessage(data)
+
+		// Process message (in background, in the order received)
+		c.observeQueueDepth(c.pending.Add(1))
+		select {
+		case c.queue <- response:
+		case <-ctx.Done():
 			return
 		}
+	}
+}
 
-		// Process message (in background)
-		go c.handleMessage(ctx, response)
+// handleMessages handles the received frames one at a time, so that
+// listeners see the messages of a channel in the order they were sent
+func (c *Client) handleMessages(ctx context.Context) {
+	for response := range c.queue {
+		c.handleMessage(ctx, response)
+		c.observeQueueDepth(c.pending.Add(-1))
 	}
 }
 
@@ -319,99 +483,153 @@ func (c *Client) receiveMessages(ctx context.Context) {
 func (c *Client) handleMessage(ctx context.Context, rawMsg json.RawMessage) {
 	var msg map[string]json.RawMessage
 	if err := json.Unmarshal(rawMsg, &msg); err != nil {
+		c.log().Warn("dropped malformed frame", "size", len(rawMsg), "error", err)
+		c.decodeError("", rawMsg, err)
 		return
 	}
 
 	// Check if parameters exist
 	paramsRaw, ok := msg["params"]
 	if !ok {
+		// Responses to requests carry no params
+		c.handleResponse(msg)
 		return
 	}
 
 	// Parse parameters as a map
 	var params map[string]json.RawMessage
 	if err := json.Unmarshal(paramsRaw, &params); err != nil {
+		c.log().Warn("dropped frame with malformed params", "size", len(rawMsg), "error", err)
+		c.decodeError("", rawMsg, err)
 		return
 	}
 
 	// Get channel name
 	channelRaw, ok := params["channel"]
 	if !ok {
+		c.log().Debug("dropped frame without channel", "size", len(rawMsg))
 		return
 	}
 
 	var channel string
 	if err := json.Unmarshal(channelRaw, &channel); err != nil {
+		c.log().Warn("dropped frame with malformed channel", "size", len(rawMsg), "error", err)
+		c.decodeError("", rawMsg, err)
 		return
 	}
+	c.observeMessage(channel)
+	c.touchChannel(channel)
 
-	// Get handlers under mutex protection
+	// Get listeners under mutex protection
 	c.mu.Lock()
-	tickerHandler := c.tickerHandler
-	executionsHandler := c.executionsHandler
-	boardHandler := c.boardHandler
-	boardSnapshotHandler := c.boardSnapshotHandler
-	privateOrderHandler := c.privateOrderHandler
+	tickerListeners := c.tickerListeners
+	executionsListeners := c.executionsListeners
+	boardListeners := c.boardListeners
+	snapshotListeners := c.snapshotListeners
+	orderListeners := c.orderListeners
+	rawListeners := c.rawListeners
+	unknownListeners := c.unknownListeners
 	c.mu.Unlock()
 
-	// Call the appropriate handler based on the channel
+	message := params["message"]
+	if message == nil {
+		return
+	}
+	for _, l := range rawListeners {
+		l.handler(channelMessage{channel: channel, raw: message})
+	}
+
+	// Call the appropriate listeners based on the channel
 	if strings.HasPrefix(channel, "lightning_ticker_") {
-		if tickerHandler != nil && params["message"] != nil {
+		if len(tickerListeners) > 0 {
 			var ticker TickerMessage
-			if err := json.Unmarshal(params["message"], &ticker); err == nil {
-				tickerHandler(ticker)
+			if err := json.Unmarshal(message, &ticker); err == nil {
+				dispatch(c, channel, tickerListeners, ticker.ProductCode, ticker)
+			} else {
+				c.decodeError(channel, message, err)
 			}
 		}
 	} else if strings.HasPrefix(channel, "lightning_executions_") {
-		if executionsHandler != nil && params["message"] != nil {
+		if len(executionsListeners) > 0 || c.gapThreshold > 0 {
+			// Extract product code from channel name (example: lightning_executions_BTC_JPY -> BTC_JPY)
+			productCode := strings.TrimPrefix(channel, "lightning_executions_")
+
 			var executions ExecutionsMessage
-			if err := json.Unmarshal(params["message"], &executions); err == nil {
-				executionsHandler(executions)
+			if err := json.Unmarshal(message, &executions); err == nil {
+				if executions.ProductCode == "" {
+					executions.ProductCode = productCode
+				}
+				c.checkExecutionGap(channel, executions)
+				dispatch(c, channel, executionsListeners, productCode, executions)
+			} else {
+				c.decodeError(channel, message, err)
 			}
 		}
 	} else if strings.HasPrefix(channel, "lightning_board_") && !strings.HasPrefix(channel, "lightning_board_snapshot_") {
-		if boardHandler != nil && params["message"] != nil {
+		if len(boardListeners) > 0 {
 			// Extract product code from channel name (example: lightning_board_BTC_JPY -> BTC_JPY)
 			productCode := strings.TrimPrefix(channel, "lightning_board_")
 
 			// Parse BoardData directly
 			var boardData BoardData
-			if err := json.Unmarshal(params["message"], &boardData); err == nil {
+			if err := json.Unmarshal(message, &boardData); err == nil {
 				// Create BoardMessage
 				board := BoardMessage{
 					ProductCode: productCode,
 					Data:        boardData,
 				}
-				boardHandler(board)
+				dispatch(c, channel, boardListeners, productCode, board)
+			} else {
+				c.decodeError(channel, message, err)
 			}
 		}
 	} else if strings.HasPrefix(channel, "lightning_board_snapshot_") {
-		if boardSnapshotHandler != nil && params["message"] != nil {
+		if len(snapshotListeners) > 0 {
 			// Extract product code from channel name (example: lightning_board_snapshot_BTC_JPY -> BTC_JPY)
 			productCode := strings.TrimPrefix(channel, "lightning_board_snapshot_")
 
 			// Parse BoardData directly
 			var boardData BoardData
-			if err := json.Unmarshal(params["message"], &boardData); err == nil {
+			if err := json.Unmarshal(message, &boardData); err == nil {
 				// Create BoardSnapshotMessage
 				snapshot := BoardSnapshotMessage{
 					ProductCode: productCode,
 					Data:        boardData,
 				}
-				boardSnapshotHandler(snapshot)
+				dispatch(c, channel, snapshotListeners, productCode, snapshot)
+			} else {
+				c.decodeError(channel, message, err)
 			}
 		}
 	} else if channel == "child_order_events" || channel == "parent_order_events" {
-		if privateOrderHandler != nil && params["message"] != nil {
-			var event OrderEventMessage
-			if err := json.Unmarshal(params["message"], &event); err == nil {
-				privateOrderHandler(event)
+		if len(orderListeners) > 0 || c.tracer != nil {
+			// The realtime API sends a batch of events; accept a single one too
+			events, err := decodeOrderEvents(message)
+			if err != nil {
+				c.decodeError(channel, message, err)
 			}
+			for _, event := range events {
+				if channel == ChildOrderEventsChannel {
+					c.traceOrderEvent(event)
+				}
+				dispatch(c, channel, orderListeners, event.ProductCode, event)
+			}
+		}
+	} else {
+		for _, l := range unknownListeners {
+			l.handler(channelMessage{channel: channel, raw: message})
 		}
 	}
+}
+
+// decodeError reports a frame or channel message that could not be decoded
+func (c *Client) decodeError(channel string, raw []byte, err error) {
+	c.observeDecodeError(channel)
+	if channel != "" {
+		c.log().Warn("dropped unparseable message", "channel", channel, "error", err)
+	}
 
-	// Call user-defined handler if it exists
-	if handler, exists := c.messageHandlers[channel]; exists {
-		handler(channel, paramsRaw)
+	for _, l := range listenersOf(c, &c.decodeErrorListeners) {
+		l.handler(decodeFailure{channel: channel, raw: raw, err: err})
 	}
 }
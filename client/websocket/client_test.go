@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -307,23 +309,83 @@ func TestOnHandlers(t *testing.T) {
 	client.OnOrderEvents(func(event OrderEventMessage) {})
 
 	// Confirm handlers are registered
-	if client.tickerHandler == nil {
+	if len(client.tickerListeners) != 1 {
 		t.Error("Expected ticker handler to be registered")
 	}
-	if client.executionsHandler == nil {
+	if len(client.executionsListeners) != 1 {
 		t.Error("Expected executions handler to be registered")
 	}
-	if client.boardHandler == nil {
+	if len(client.boardListeners) != 1 {
 		t.Error("Expected board handler to be registered")
 	}
-	if client.boardSnapshotHandler == nil {
+	if len(client.snapshotListeners) != 1 {
 		t.Error("Expected board snapshot handler to be registered")
 	}
-	if client.privateOrderHandler == nil {
+	if len(client.orderListeners) != 1 {
 		t.Error("Expected order events handler to be registered")
 	}
 }
 
+// TestListeners confirms that listeners can be stacked, filtered and removed
+func TestListeners(t *testing.T) {
+	client := &Client{}
+
+	var all, btc, fx []string
+	first := client.OnTicker(func(ticker TickerMessage) { all = append(all, ticker.ProductCode) })
+	client.OnTicker(func(ticker TickerMessage) { btc = append(btc, ticker.ProductCode) }, ForProducts("BTC_JPY"))
+	client.OnTicker(func(ticker TickerMessage) { fx = append(fx, ticker.ProductCode) }, ForProducts("FX_BTC_JPY", "ETH_JPY"))
+
+	publish := func(productCode string) {
+		frame := fmt.Sprintf(`{"params":{"channel":"lightning_ticker_%s","message":{"product_code":%q}}}`, productCode, productCode)
+		client.handleMessage(context.Background(), []byte(frame))
+	}
+	publish("BTC_JPY")
+	publish("FX_BTC_JPY")
+
+	first.Remove()
+	first.Remove()
+	publish("ETH_JPY")
+
+	if !reflect.DeepEqual(all, []string{"BTC_JPY", "FX_BTC_JPY"}) {
+		t.Errorf("Unfiltered listener got %v", all)
+	}
+	if !reflect.DeepEqual(btc, []string{"BTC_JPY"}) {
+		t.Errorf("BTC_JPY listener got %v", btc)
+	}
+	if !reflect.DeepEqual(fx, []string{"FX_BTC_JPY", "ETH_JPY"}) {
+		t.Errorf("FX_BTC_JPY/ETH_JPY listener got %v", fx)
+	}
+	if len(client.tickerListeners) != 2 {
+		t.Errorf("Expected 2 listeners after removal, got %d", len(client.tickerListeners))
+	}
+}
+
+// TestListeners_ProductFromChannel confirms that board and executions
+// listeners are filtered by the product of the channel
+func TestListeners_ProductFromChannel(t *testing.T) {
+	client := &Client{}
+
+	var boards, executions []string
+	client.OnBoard(func(board BoardMessage) { boards = append(boards, board.ProductCode) }, ForProducts("BTC_JPY"))
+	client.OnExecutions(func(execs ExecutionsMessage) { executions = append(executions, execs.ProductCode) }, ForProducts("BTC_JPY"))
+
+	for _, frame := range []string{
+		`{"params":{"channel":"lightning_board_BTC_JPY","message":{"bids":[]}}}`,
+		`{"params":{"channel":"lightning_board_ETH_JPY","message":{"bids":[]}}}`,
+		`{"params":{"channel":"lightning_executions_BTC_JPY","message":{"data":[]}}}`,
+		`{"params":{"channel":"lightning_executions_ETH_JPY","message":{"data":[]}}}`,
+	} {
+		client.handleMessage(context.Background(), []byte(frame))
+	}
+
+	if !reflect.DeepEqual(boards, []string{"BTC_JPY"}) {
+		t.Errorf("Board listener got %v", boards)
+	}
+	if !reflect.DeepEqual(executions, []string{"BTC_JPY"}) {
+		t.Errorf("Executions listener got %v", executions)
+	}
+}
+
 // TestAuth_InvalidCredentials confirms that an error occurs when using invalid credentials
 func TestAuth_InvalidCredentials(t *testing.T) {
 	// Set up WebSocket server mock
@@ -384,6 +446,59 @@ func TestHandleMessage_InvalidJSON(t *testing.T) {
 	}
 }
 
+// TestHooks confirms that raw, decode error and unknown channel hooks are called
+func TestHooks(t *testing.T) {
+	client := &Client{}
+
+	type call struct {
+		channel string
+		raw     string
+	}
+	var raws, unknowns, decodeErrors []call
+	client.OnRaw(func(channel string, raw json.RawMessage) {
+		raws = append(raws, call{channel, string(raw)})
+	})
+	client.OnUnknownChannel(func(channel string, raw json.RawMessage) {
+		unknowns = append(unknowns, call{channel, string(raw)})
+	})
+	client.OnDecodeError(func(channel string, raw []byte, err error) {
+		if err == nil {
+			t.Error("Expected a decode error")
+		}
+		decodeErrors = append(decodeErrors, call{channel, string(raw)})
+	})
+	client.OnTicker(func(TickerMessage) {})
+
+	for _, frame := range []string{
+		`{"params":{"channel":"lightning_ticker_BTC_JPY","message":{"ltp":1}}}`,
+		`{"params":{"channel":"lightning_ticker_BTC_JPY","message":{"ltp":"1"}}}`,
+		`{"params":{"channel":"lightning_new_BTC_JPY","message":{"x":1}}}`,
+		`{"params":`,
+	} {
+		client.handleMessage(context.Background(), []byte(frame))
+	}
+
+	wantRaws := []call{
+		{"lightning_ticker_BTC_JPY", `{"ltp":1}`},
+		{"lightning_ticker_BTC_JPY", `{"ltp":"1"}`},
+		{"lightning_new_BTC_JPY", `{"x":1}`},
+	}
+	if !reflect.DeepEqual(raws, wantRaws) {
+		t.Errorf("OnRaw calls = %v, want %v", raws, wantRaws)
+	}
+	wantUnknowns := []call{{"lightning_new_BTC_JPY", `{"x":1}`}}
+	if !reflect.DeepEqual(unknowns, wantUnknowns) {
+		t.Errorf("OnUnknownChannel calls = %v, want %v", unknowns, wantUnknowns)
+	}
+	wantDecodeErrors := []call{
+		{"lightning_ticker_BTC_JPY", `{"ltp":"1"}`},
+		{"", `{"params":`},
+	}
+	if !reflect.DeepEqual(decodeErrors, wantDecodeErrors) {
+		t.Errorf("OnDecodeError calls = %v, want %v", decodeErrors, wantDecodeErrors)
+	}
+}
+
 // TestContextCancellation confirms that context cancel is processed correctly
 func TestContextCancellation(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
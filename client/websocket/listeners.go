@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// Listener is a handle to a handler registered with one of the On... methods
+type Listener struct {
+	once   sync.Once
+	remove func()
+}
+
+// Remove unregisters the handler. Messages already being dispatched may
+// still reach it. Remove is safe to call more than once.
+func (l *Listener) Remove() {
+	if l == nil {
+		return
+	}
+	l.once.Do(l.remove)
+}
+
+// ListenerOption configures a listener
+type ListenerOption func(*listenerConfig)
+
+type listenerConfig struct {
+	products map[string]struct{}
+	channel  string
+}
+
+// ForProducts only delivers messages of the given product codes
+func ForProducts(productCodes ...string) ListenerOption {
+	return func(cfg *listenerConfig) {
+		if cfg.products == nil {
+			cfg.products = make(map[string]struct{}, len(productCodes))
+		}
+		for _, code := range productCodes {
+			cfg.products[code] = struct{}{}
+		}
+	}
+}
+
+// forChannel only delivers messages of the channel. It tells apart
+// handlers of channels that share a message type.
+func forChannel(channel string) ListenerOption {
+	return func(cfg *listenerConfig) {
+		cfg.channel = channel
+	}
+}
+
+// listener is a registered handler
+type listener[T any] struct {
+	id       uint64
+	handler  func(T)
+	products map[string]struct{}
+	channel  string
+}
+
+// accepts reports whether the listener wants messages of the channel and product
+func (l *listener[T]) accepts(channel, productCode string) bool {
+	if l.channel != "" && l.channel != channel {
+		return false
+	}
+	if l.products == nil {
+		return true
+	}
+	_, ok := l.products[productCode]
+	return ok
+}
+
+// addListener registers a handler. The slice is replaced rather than
+// modified so that dispatch can iterate over a snapshot without the lock.
+func addListener[T any](c *Client, set *[]*listener[T], handler func(T), opts []ListenerOption) *Listener {
+	var cfg listenerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextListenerID++
+	id := c.nextListenerID
+	*set = append((*set)[:len(*set):len(*set)], &listener[T]{id: id, handler: handler, products: cfg.products, channel: cfg.channel})
+
+	return &Listener{remove: func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		kept := make([]*listener[T], 0, len(*set))
+		for _, l := range *set {
+			if l.id != id {
+				kept = append(kept, l)
+			}
+		}
+		*set = kept
+	}}
+}
+
+// listenersOf returns the current listeners of a set
+func listenersOf[T any](c *Client, set *[]*listener[T]) []*listener[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *set
+}
+
+// dispatch calls every listener that accepts the channel and product
+func dispatch[T any](c *Client, channel string, listeners []*listener[T], productCode string, msg T) {
+	for _, l := range listeners {
+		if !l.accepts(channel, productCode) {
+			continue
+		}
+		start := time.Now()
+		l.handler(msg)
+		c.observeHandler(channel, time.Since(start))
+	}
+}
@@ -0,0 +1,44 @@
+package websocket
+
+import "log/slog"
+
+// redacted replaces credentials in log output
+const redacted = "[REDACTED]"
+
+// WithStructuredLogger logs the connection lifecycle and subscription
+// changes at Info, dropped or unparseable frames and JSON-RPC errors at
+// Warn, and outgoing requests at Debug. The API key and signature of auth
+// requests are redacted. (WithLogger configures the generated controller.)
+func WithStructuredLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// discardLogger is used when no logger is configured
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// log returns the configured logger or one that discards everything
+func (c *Client) log() *slog.Logger {
+	if c.logger == nil {
+		return discardLogger
+	}
+	return c.logger
+}
+
+// logParams returns the request params as logged, without credentials
+func logParams(method string, params interface{}) interface{} {
+	authParams, ok := params.(map[string]interface{})
+	if method != "auth" || !ok {
+		return params
+	}
+
+	safe := make(map[string]interface{}, len(authParams))
+	for k, v := range authParams {
+		if k == "api_key" || k == "signature" {
+			v = redacted
+		}
+		safe[k] = v
+	}
+	return safe
+}
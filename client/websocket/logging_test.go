@@ -0,0 +1,93 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+// syncBuffer is a log destination safe for concurrent writes
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestWithStructuredLogger(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := NewClient(ctx, srv.URL, WithStructuredLogger(logger))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.Auth(ctx, "test-key", "test-secret"); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	channel := TickerChannel("BTC_JPY")
+	if err := client.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, channel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+	if _, err := srv.Publish(channel, "not a ticker"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	client.OnTicker(func(TickerMessage) {})
+	if _, err := srv.Publish(channel, "not a ticker"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := srv.PublishRaw([]byte(`{"params":`)); err != nil {
+		t.Fatalf("PublishRaw() error = %v", err)
+	}
+
+	want := []string{
+		`level=INFO msg="websocket connected"`,
+		`msg="sending request" method=auth`,
+		`api_key:[REDACTED]`,
+		`signature:[REDACTED]`,
+		`level=INFO msg=subscribed channel=lightning_ticker_BTC_JPY`,
+		`level=WARN msg="dropped unparseable message" channel=lightning_ticker_BTC_JPY`,
+		`level=WARN msg="dropped malformed frame"`,
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && !strings.Contains(out.String(), want[len(want)-1]) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client.Close(ctx)
+	want = append(want, `level=INFO msg="websocket closed"`)
+
+	log := out.String()
+	for _, w := range want {
+		if !strings.Contains(log, w) {
+			t.Errorf("Expected %q in log:\n%s", w, log)
+		}
+	}
+	if strings.Contains(log, "test-key") {
+		t.Errorf("Log leaks the API key:\n%s", log)
+	}
+}
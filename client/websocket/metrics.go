@@ -0,0 +1,52 @@
+package websocket
+
+import "time"
+
+// Metrics records realtime client metrics.
+// *metrics.Registry implements this interface.
+type Metrics interface {
+	// ObserveMessage is called for every channel message received
+	ObserveMessage(channel string)
+	// ObserveDecodeError is called when a frame or a channel message cannot
+	// be decoded. channel is empty when the frame itself is malformed.
+	ObserveDecodeError(channel string)
+	// ObserveReconnect is called each time the client reconnects
+	ObserveReconnect()
+	// ObserveHandler is called with the time an On... handler took
+	ObserveHandler(channel string, duration time.Duration)
+	// SetQueueDepth is called with the number of received messages that
+	// have not been handled yet
+	SetQueueDepth(depth int)
+}
+
+// WithMetrics records messages per channel, decode errors, reconnects,
+// handler latency and queue depth
+func WithMetrics(metrics Metrics) ClientOption {
+	return func(c *Client) {
+		c.metrics = metrics
+	}
+}
+
+func (c *Client) observeMessage(channel string) {
+	if c.metrics != nil {
+		c.metrics.ObserveMessage(channel)
+	}
+}
+
+func (c *Client) observeDecodeError(channel string) {
+	if c.metrics != nil {
+		c.metrics.ObserveDecodeError(channel)
+	}
+}
+
+func (c *Client) observeHandler(channel string, duration time.Duration) {
+	if c.metrics != nil {
+		c.metrics.ObserveHandler(channel, duration)
+	}
+}
+
+func (c *Client) observeQueueDepth(depth int64) {
+	if c.metrics != nil {
+		c.metrics.SetQueueDepth(int(depth))
+	}
+}
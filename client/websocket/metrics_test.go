@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+type stubMetrics struct {
+	mu           sync.Mutex
+	messages     map[string]int
+	decodeErrors map[string]int
+	handled      map[string]int
+	maxDepth     int
+	lastDepth    int
+}
+
+func newStubMetrics() *stubMetrics {
+	return &stubMetrics{
+		messages:     make(map[string]int),
+		decodeErrors: make(map[string]int),
+		handled:      make(map[string]int),
+	}
+}
+
+func (m *stubMetrics) ObserveMessage(channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages[channel]++
+}
+
+func (m *stubMetrics) ObserveDecodeError(channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decodeErrors[channel]++
+}
+
+func (m *stubMetrics) ObserveReconnect() {}
+
+func (m *stubMetrics) ObserveHandler(channel string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handled[channel]++
+}
+
+func (m *stubMetrics) SetQueueDepth(depth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastDepth = depth
+	if depth > m.maxDepth {
+		m.maxDepth = depth
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := newStubMetrics()
+	client, err := NewClient(ctx, srv.URL, WithMetrics(m))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	handled := make(chan struct{}, 2)
+	client.OnTicker(func(TickerMessage) { handled <- struct{}{} })
+
+	channel := TickerChannel("BTC_JPY")
+	if err := client.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, channel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	for _, msg := range []any{
+		map[string]any{"product_code": "BTC_JPY", "ltp": 1},
+		"not a ticker",
+		map[string]any{"product_code": "BTC_JPY", "ltp": 2},
+	} {
+		if _, err := srv.Publish(channel, msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if err := srv.PublishRaw([]byte(`{"params":`)); err != nil {
+		t.Fatalf("PublishRaw() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for tickers")
+		}
+	}
+
+	// Wait for the malformed messages to be processed as well
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		done := m.decodeErrors[channel] == 1 && m.decodeErrors[""] == 1 && m.lastDepth == 0
+		m.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.messages[channel] != 3 {
+		t.Errorf("Expected 3 messages on %s, got %d", channel, m.messages[channel])
+	}
+	if m.decodeErrors[channel] != 1 || m.decodeErrors[""] != 1 {
+		t.Errorf("Unexpected decode errors: %v", m.decodeErrors)
+	}
+	if m.handled[channel] != 2 {
+		t.Errorf("Expected 2 handled tickers, got %d", m.handled[channel])
+	}
+	if m.maxDepth < 1 || m.lastDepth != 0 {
+		t.Errorf("Expected the queue to fill and drain, max %d last %d", m.maxDepth, m.lastDepth)
+	}
+}
@@ -0,0 +1,448 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pool spreads channel subscriptions over several connections, opening a new
+// connection when every open one has reached the channel cap. When a
+// connection is lost, its channels are moved to the remaining connections or
+// a new one. Handlers registered on the pool receive messages from every
+// connection.
+type Pool struct {
+	wsURL         string
+	maxChannels   int
+	retryInterval time.Duration
+	clientOpts    []ClientOption
+	apiKey        string
+	apiSecret     string
+	logger        *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	opMu sync.Mutex // serializes subscription changes and rebalancing
+
+	mu            sync.Mutex
+	conns         []*poolConn
+	placement     map[string]*poolConn
+	moving        map[string]struct{} // channels of a lost connection not placed again yet
+	registrations map[uint64]func(*Client) *Listener
+	nextID        uint64
+	closed        bool
+}
+
+// poolConn is a connection of the pool
+type poolConn struct {
+	client    *Client
+	channels  map[string]struct{}
+	listeners map[uint64]*Listener // by registration
+}
+
+// PoolOption configures a Pool
+type PoolOption func(*Pool)
+
+// WithMaxChannelsPerConnection caps the channels subscribed on one
+// connection, 20 by default
+func WithMaxChannelsPerConnection(n int) PoolOption {
+	return func(p *Pool) {
+		p.maxChannels = n
+	}
+}
+
+// WithPoolClientOptions sets the options of every connection
+func WithPoolClientOptions(opts ...ClientOption) PoolOption {
+	return func(p *Pool) {
+		p.clientOpts = opts
+	}
+}
+
+// WithPoolCredentials authenticates every connection so that private
+// channels can be placed on any of them
+func WithPoolCredentials(apiKey, apiSecret string) PoolOption {
+	return func(p *Pool) {
+		p.apiKey = apiKey
+		p.apiSecret = apiSecret
+	}
+}
+
+// WithRetryInterval sets how long the pool waits before retrying to move a
+// channel off a lost connection, one second by default
+func WithRetryInterval(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.retryInterval = d
+	}
+}
+
+// WithPoolLogger logs connection losses and rebalancing
+func WithPoolLogger(logger *slog.Logger) PoolOption {
+	return func(p *Pool) {
+		p.logger = logger
+	}
+}
+
+// NewPool creates a pool for the realtime API at wsURL. Connections are
+// opened as channels are subscribed.
+func NewPool(wsURL string, opts ...PoolOption) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		wsURL:         wsURL,
+		maxChannels:   20,
+		retryInterval: time.Second,
+		logger:        discardLogger,
+		ctx:           ctx,
+		cancel:        cancel,
+		placement:     make(map[string]*poolConn),
+		moving:        make(map[string]struct{}),
+		registrations: make(map[uint64]func(*Client) *Listener),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Subscribe subscribes to the channel on the least loaded connection with
+// room, opening a new connection if needed
+func (p *Pool) Subscribe(ctx context.Context, channel string) error {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+
+	p.mu.Lock()
+	closed := p.closed
+	_, exists := p.placement[channel]
+	_, moving := p.moving[channel]
+	p.mu.Unlock()
+
+	if closed {
+		return fmt.Errorf("pool is closed")
+	}
+	if exists || moving {
+		return fmt.Errorf("channel %s already subscribed", channel)
+	}
+	return p.place(ctx, channel)
+}
+
+// Unsubscribe cancels the subscription to the channel. A connection left
+// without channels is closed unless it is the last one.
+func (p *Pool) Unsubscribe(ctx context.Context, channel string) error {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+
+	p.mu.Lock()
+	conn, ok := p.placement[channel]
+	_, moving := p.moving[channel]
+	if moving {
+		// Lost with its connection, so it only needs not to be moved
+		delete(p.moving, channel)
+	}
+	p.mu.Unlock()
+	if moving {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("channel %s not subscribed", channel)
+	}
+
+	if err := conn.client.Unsubscribe(ctx, channel); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.placement, channel)
+	delete(conn.channels, channel)
+	idle := len(conn.channels) == 0 && len(p.conns) > 1 && p.removeConnLocked(conn)
+	p.mu.Unlock()
+
+	if idle {
+		conn.client.Close(ctx)
+	}
+	return nil
+}
+
+// Connections returns the number of open connections
+func (p *Pool) Connections() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+// Channels returns the sorted channels of each connection
+func (p *Pool) Channels() [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([][]string, 0, len(p.conns))
+	for _, conn := range p.conns {
+		channels := make([]string, 0, len(conn.channels))
+		for ch := range conn.channels {
+			channels = append(channels, ch)
+		}
+		sort.Strings(channels)
+		result = append(result, channels)
+	}
+	return result
+}
+
+// Close closes every connection. The pool cannot be used afterwards.
+func (p *Pool) Close(ctx context.Context) {
+	p.cancel()
+
+	p.mu.Lock()
+	p.closed = true
+	conns := p.conns
+	p.conns = nil
+	p.placement = make(map[string]*poolConn)
+	p.moving = make(map[string]struct{})
+	p.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.client.Close(ctx)
+	}
+}
+
+// OnTicker registers a callback to receive ticker information from every connection
+func (p *Pool) OnTicker(handler func(TickerMessage), opts ...ListenerOption) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnTicker(handler, opts...) })
+}
+
+// OnExecutions registers a callback to receive execution information from every connection
+func (p *Pool) OnExecutions(handler func(ExecutionsMessage), opts ...ListenerOption) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnExecutions(handler, opts...) })
+}
+
+// OnBoard registers a callback to receive order book information from every connection
+func (p *Pool) OnBoard(handler func(BoardMessage), opts ...ListenerOption) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnBoard(handler, opts...) })
+}
+
+// OnBoardSnapshot registers a callback to receive order book snapshots from every connection
+func (p *Pool) OnBoardSnapshot(handler func(BoardSnapshotMessage), opts ...ListenerOption) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnBoardSnapshot(handler, opts...) })
+}
+
+// OnOrderEvents registers a callback to receive order events from every connection
+func (p *Pool) OnOrderEvents(handler func(OrderEventMessage), opts ...ListenerOption) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnOrderEvents(handler, opts...) })
+}
+
+// OnRaw registers a callback to receive the undecoded message of every channel
+func (p *Pool) OnRaw(handler func(channel string, raw json.RawMessage)) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnRaw(handler) })
+}
+
+// OnDecodeError registers a callback to receive data that could not be decoded
+func (p *Pool) OnDecodeError(handler func(channel string, raw []byte, err error)) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnDecodeError(handler) })
+}
+
+// OnUnknownChannel registers a callback to receive messages of channels
+// that have no typed handler
+func (p *Pool) OnUnknownChannel(handler func(channel string, raw json.RawMessage)) *Listener {
+	return p.listen(func(c *Client) *Listener { return c.OnUnknownChannel(handler) })
+}
+
+// listen registers a handler on every current and future connection
+func (p *Pool) listen(register func(*Client) *Listener) *Listener {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextID++
+	id := p.nextID
+	p.registrations[id] = register
+	for _, conn := range p.conns {
+		conn.listeners[id] = register(conn.client)
+	}
+
+	return &Listener{remove: func() {
+		p.mu.Lock()
+		delete(p.registrations, id)
+		var listeners []*Listener
+		for _, conn := range p.conns {
+			if l, ok := conn.listeners[id]; ok {
+				listeners = append(listeners, l)
+				delete(conn.listeners, id)
+			}
+		}
+		p.mu.Unlock()
+
+		for _, l := range listeners {
+			l.Remove()
+		}
+	}}
+}
+
+// place subscribes to the channel on a connection with room. p.opMu must be held.
+func (p *Pool) place(ctx context.Context, channel string) error {
+	p.mu.Lock()
+	conn := p.leastLoadedLocked()
+	p.mu.Unlock()
+
+	dialed := conn == nil
+	if dialed {
+		var err error
+		if conn, err = p.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := conn.client.Subscribe(ctx, channel); err != nil {
+		if dialed {
+			// Do not keep a connection without channels
+			p.mu.Lock()
+			removed := p.removeConnLocked(conn)
+			p.mu.Unlock()
+			if removed {
+				conn.client.Close(ctx)
+			}
+		}
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn.channels[channel] = struct{}{}
+	p.placement[channel] = conn
+	return nil
+}
+
+// leastLoadedLocked returns the connection with the fewest channels among
+// those with room, or nil. p.mu must be held.
+func (p *Pool) leastLoadedLocked() *poolConn {
+	var best *poolConn
+	for _, conn := range p.conns {
+		if p.maxChannels > 0 && len(conn.channels) >= p.maxChannels {
+			continue
+		}
+		if best == nil || len(conn.channels) < len(best.channels) {
+			best = conn
+		}
+	}
+	return best
+}
+
+// connect opens a connection and registers the pool handlers on it
+func (p *Pool) connect(ctx context.Context) (*poolConn, error) {
+	client, err := NewClient(ctx, p.wsURL, p.clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		if err := client.Auth(ctx, p.apiKey, p.apiSecret); err != nil {
+			client.Close(ctx)
+			return nil, fmt.Errorf("failed to authenticate pool connection: %w", err)
+		}
+	}
+
+	conn := &poolConn{
+		client:    client,
+		channels:  make(map[string]struct{}),
+		listeners: make(map[uint64]*Listener),
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		client.Close(ctx)
+		return nil, fmt.Errorf("pool is closed")
+	}
+	for id, register := range p.registrations {
+		conn.listeners[id] = register(client)
+	}
+	p.conns = append(p.conns, conn)
+	p.mu.Unlock()
+
+	go p.watch(conn)
+	return conn, nil
+}
+
+// removeConnLocked removes the connection from the pool and reports whether
+// it was still there. p.mu must be held.
+func (p *Pool) removeConnLocked(conn *poolConn) bool {
+	for i, c := range p.conns {
+		if c == conn {
+			p.conns = append(p.conns[:i:i], p.conns[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// watch moves the channels of a lost connection to other connections.
+// p.opMu is held only while a channel is placed, so that subscription
+// changes are not blocked while a move is retried; a channel unsubscribed
+// in between is not moved.
+func (p *Pool) watch(conn *poolConn) {
+	select {
+	case <-conn.client.Done():
+	case <-p.ctx.Done():
+		return
+	}
+
+	p.opMu.Lock()
+	p.mu.Lock()
+	if !p.removeConnLocked(conn) {
+		// Closed by Unsubscribe or Close
+		p.mu.Unlock()
+		p.opMu.Unlock()
+		return
+	}
+	channels := make([]string, 0, len(conn.channels))
+	for ch := range conn.channels {
+		channels = append(channels, ch)
+		delete(p.placement, ch)
+		p.moving[ch] = struct{}{}
+	}
+	p.mu.Unlock()
+	p.opMu.Unlock()
+
+	conn.client.Close(p.ctx)
+	sort.Strings(channels)
+	p.logger.Warn("pool connection lost, moving channels", "channels", channels)
+
+	for _, channel := range channels {
+		for {
+			err := p.move(channel)
+			if err == nil {
+				break
+			}
+			p.logger.Warn("failed to move channel, retrying", "channel", channel, "error", err)
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(p.retryInterval):
+			}
+		}
+	}
+	p.logger.Info("pool channels moved", "channels", channels)
+}
+
+// move places a channel of a lost connection again, unless it was
+// unsubscribed or the pool closed since
+func (p *Pool) move(channel string) error {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+
+	p.mu.Lock()
+	_, moving := p.moving[channel]
+	closed := p.closed
+	p.mu.Unlock()
+	if !moving || closed {
+		return nil
+	}
+
+	if err := p.place(p.ctx, channel); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	delete(p.moving, channel)
+	p.mu.Unlock()
+	return nil
+}
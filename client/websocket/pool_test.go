@@ -0,0 +1,180 @@
+package websocket
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func TestPool(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := NewPool(srv.URL, WithMaxChannelsPerConnection(2), WithRetryInterval(10*time.Millisecond))
+	defer pool.Close(context.Background())
+
+	received := make(chan string, 10)
+	pool.OnTicker(func(ticker TickerMessage) { received <- ticker.ProductCode })
+
+	products := []string{"BTC_JPY", "ETH_JPY", "FX_BTC_JPY"}
+	channels := make([]string, 0, len(products))
+	for _, product := range products {
+		channel := TickerChannel(product)
+		channels = append(channels, channel)
+		if err := pool.Subscribe(ctx, channel); err != nil {
+			t.Fatalf("Subscribe(%s) error = %v", channel, err)
+		}
+	}
+	if err := pool.Subscribe(ctx, channels[0]); err == nil {
+		t.Error("Expected error when subscribing twice")
+	}
+
+	want := [][]string{
+		{"lightning_ticker_BTC_JPY", "lightning_ticker_ETH_JPY"},
+		{"lightning_ticker_FX_BTC_JPY"},
+	}
+	if got := pool.Channels(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Channels() = %v, want %v", got, want)
+	}
+	if err := srv.WaitConnections(ctx, 2); err != nil {
+		t.Fatalf("WaitConnections() error = %v", err)
+	}
+
+	// A handler registered later reaches every connection
+	late := make(chan string, 10)
+	pool.OnTicker(func(ticker TickerMessage) { late <- ticker.ProductCode }, ForProducts("FX_BTC_JPY"))
+
+	publishAll := func() {
+		t.Helper()
+		if err := srv.WaitSubscribed(ctx, channels...); err != nil {
+			t.Fatalf("WaitSubscribed() error = %v", err)
+		}
+		for i, channel := range channels {
+			if _, err := srv.Publish(channel, map[string]any{"product_code": products[i]}); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+		}
+		got := map[string]bool{}
+		for len(got) < len(products) {
+			select {
+			case product := <-received:
+				got[product] = true
+			case <-ctx.Done():
+				t.Fatalf("Timed out waiting for tickers, got %v", got)
+			}
+		}
+		select {
+		case product := <-late:
+			if product != "FX_BTC_JPY" {
+				t.Errorf("Filtered listener got %s", product)
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the late listener")
+		}
+	}
+	publishAll()
+
+	// Every channel moves to new connections after a disconnect
+	srv.DisconnectAll()
+	for {
+		total := 0
+		for _, chs := range pool.Channels() {
+			total += len(chs)
+		}
+		if total == len(channels) && pool.Connections() == 2 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the rebalance, channels %v", pool.Channels())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	publishAll()
+
+	// Unsubscribing the only channel of a connection closes it. Which
+	// connection that is depends on the order the lost ones were noticed.
+	var alone string
+	for _, chs := range pool.Channels() {
+		if len(chs) == 1 {
+			alone = chs[0]
+		}
+	}
+	if alone == "" {
+		t.Fatalf("Expected a connection with a single channel, got %v", pool.Channels())
+	}
+	if err := pool.Unsubscribe(ctx, alone); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+	if pool.Connections() != 1 {
+		t.Errorf("Expected the idle connection to be closed, %d open", pool.Connections())
+	}
+	if err := pool.Unsubscribe(ctx, alone); err == nil {
+		t.Error("Expected error when unsubscribing twice")
+	}
+}
+
+func TestPool_UnsubscribeWhileMoving(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := NewPool(srv.URL, WithPoolCredentials("key", "secret"), WithRetryInterval(10*time.Millisecond))
+	defer pool.Close(context.Background())
+
+	moved, dropped := TickerChannel("BTC_JPY"), TickerChannel("ETH_JPY")
+	for _, channel := range []string{moved, dropped} {
+		if err := pool.Subscribe(ctx, channel); err != nil {
+			t.Fatalf("Subscribe(%s) error = %v", channel, err)
+		}
+	}
+
+	// New connections fail to authenticate, so the channels cannot be moved
+	srv.RejectAuth("unavailable")
+	srv.DisconnectAll()
+	for pool.Connections() != 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the lost connection")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// Subscription changes are not blocked by the retried move
+	done := make(chan error, 1)
+	go func() { done <- pool.Unsubscribe(ctx, dropped) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unsubscribe() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe blocked while the channels are moved")
+	}
+	if err := pool.Subscribe(ctx, moved); err == nil {
+		t.Error("Expected error when subscribing to a channel being moved")
+	}
+
+	// Only the channel still subscribed is moved
+	srv.RejectAuth("")
+	want := [][]string{{moved}}
+	for !reflect.DeepEqual(pool.Channels(), want) {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Channels() = %v, want %v", pool.Channels(), want)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := pool.Channels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Channels() = %v, want %v", got, want)
+	}
+}
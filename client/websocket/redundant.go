@@ -0,0 +1,270 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+// RedundantFeed receives the same channels over several independent
+// connections and delivers the first copy of each message, so that a
+// stalled or lost connection does not leave a gap. Executions are
+// de-duplicated by execution ID, tickers by timestamp and content, and
+// board messages by content.
+//
+// Each connection has its own handler goroutine, but the feed listeners are
+// called one at a time, in the order the messages were found new, as they
+// are for a single Client.
+type RedundantFeed struct {
+	clients []*Client
+	hub     *Client // holds the feed listeners; never connected
+	dedup   *deduplicator
+
+	// dispatchMu serializes de-duplication and dispatch across connections
+	dispatchMu sync.Mutex
+}
+
+// FeedOption configures a RedundantFeed
+type FeedOption func(*feedConfig)
+
+type feedConfig struct {
+	urls       []string
+	clientOpts []ClientOption
+	window     int
+}
+
+// WithFeedURLs sets the endpoint of each connection, so that connections can
+// use different routes. By default two connections are made to the same URL.
+func WithFeedURLs(urls ...string) FeedOption {
+	return func(cfg *feedConfig) {
+		cfg.urls = urls
+	}
+}
+
+// WithFeedClientOptions sets the options of every connection
+func WithFeedClientOptions(opts ...ClientOption) FeedOption {
+	return func(cfg *feedConfig) {
+		cfg.clientOpts = opts
+	}
+}
+
+// WithDedupWindow sets how many message keys are remembered, 10000 by default
+func WithDedupWindow(n int) FeedOption {
+	return func(cfg *feedConfig) {
+		cfg.window = n
+	}
+}
+
+// NewRedundantFeed opens the connections of a feed
+func NewRedundantFeed(ctx context.Context, wsURL string, opts ...FeedOption) (*RedundantFeed, error) {
+	cfg := feedConfig{urls: []string{wsURL, wsURL}, window: 10000}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(cfg.urls) == 0 {
+		return nil, fmt.Errorf("redundant feed needs at least one URL")
+	}
+
+	f := &RedundantFeed{
+		hub:   &Client{},
+		dedup: newDeduplicator(len(cfg.urls), cfg.window),
+	}
+	for i, url := range cfg.urls {
+		client, err := NewClient(ctx, url, cfg.clientOpts...)
+		if err != nil {
+			f.Close(ctx)
+			return nil, fmt.Errorf("failed to open feed connection %d: %w", i, err)
+		}
+		f.clients = append(f.clients, client)
+		f.forward(i, client)
+	}
+	return f, nil
+}
+
+// Clients returns the underlying connections, for example to authenticate
+// or to watch Done
+func (f *RedundantFeed) Clients() []*Client {
+	return f.clients
+}
+
+// Subscribe subscribes to the channel on every connection. It fails only if
+// no connection could subscribe.
+func (f *RedundantFeed) Subscribe(ctx context.Context, channel string) error {
+	return f.each(func(c *Client) error { return c.Subscribe(ctx, channel) })
+}
+
+// Unsubscribe cancels the subscription on every connection
+func (f *RedundantFeed) Unsubscribe(ctx context.Context, channel string) error {
+	return f.each(func(c *Client) error { return c.Unsubscribe(ctx, channel) })
+}
+
+// Close closes every connection
+func (f *RedundantFeed) Close(ctx context.Context) {
+	for _, c := range f.clients {
+		c.Close(ctx)
+	}
+}
+
+// OnTicker registers a callback to receive de-duplicated tickers
+func (f *RedundantFeed) OnTicker(handler func(TickerMessage), opts ...ListenerOption) *Listener {
+	return f.hub.OnTicker(handler, opts...)
+}
+
+// OnExecutions registers a callback to receive executions not seen before
+func (f *RedundantFeed) OnExecutions(handler func(ExecutionsMessage), opts ...ListenerOption) *Listener {
+	return f.hub.OnExecutions(handler, opts...)
+}
+
+// OnBoard registers a callback to receive de-duplicated board diffs
+func (f *RedundantFeed) OnBoard(handler func(BoardMessage), opts ...ListenerOption) *Listener {
+	return f.hub.OnBoard(handler, opts...)
+}
+
+// OnBoardSnapshot registers a callback to receive de-duplicated board snapshots
+func (f *RedundantFeed) OnBoardSnapshot(handler func(BoardSnapshotMessage), opts ...ListenerOption) *Listener {
+	return f.hub.OnBoardSnapshot(handler, opts...)
+}
+
+// each runs op on every connection and fails if it failed everywhere
+func (f *RedundantFeed) each(op func(*Client) error) error {
+	var errs []error
+	for _, c := range f.clients {
+		if err := op(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(f.clients) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// forward passes the first copy of each message of a connection to the feed
+// listeners
+func (f *RedundantFeed) forward(source int, c *Client) {
+	hub := f.hub
+
+	c.OnTicker(func(m TickerMessage) {
+		f.dispatchMu.Lock()
+		defer f.dispatchMu.Unlock()
+		channel := TickerChannel(m.ProductCode)
+		if f.dedup.unique(channel + "|" + m.Timestamp + "|" + contentHash(m)) {
+			dispatch(hub, channel, listenersOf(hub, &hub.tickerListeners), m.ProductCode, m)
+		}
+	})
+	c.OnBoard(func(m BoardMessage) {
+		f.dispatchMu.Lock()
+		defer f.dispatchMu.Unlock()
+		channel := BoardChannel(m.ProductCode)
+		if f.dedup.first(source, channel+"|"+contentHash(m.Data)) {
+			dispatch(hub, channel, listenersOf(hub, &hub.boardListeners), m.ProductCode, m)
+		}
+	})
+	c.OnBoardSnapshot(func(m BoardSnapshotMessage) {
+		f.dispatchMu.Lock()
+		defer f.dispatchMu.Unlock()
+		channel := BoardSnapshotChannel(m.ProductCode)
+		if f.dedup.first(source, channel+"|"+contentHash(m.Data)) {
+			dispatch(hub, channel, listenersOf(hub, &hub.snapshotListeners), m.ProductCode, m)
+		}
+	})
+	c.OnExecutions(func(m ExecutionsMessage) {
+		f.dispatchMu.Lock()
+		defer f.dispatchMu.Unlock()
+		channel := ExecutionsChannel(m.ProductCode)
+		fresh := make([]Execution, 0, len(m.Executions))
+		for _, e := range m.Executions {
+			if f.dedup.unique(channel + "|" + strconv.FormatInt(e.ID, 10)) {
+				fresh = append(fresh, e)
+			}
+		}
+		if len(fresh) == 0 {
+			return
+		}
+		m.Executions = fresh
+		dispatch(hub, channel, listenersOf(hub, &hub.executionsListeners), m.ProductCode, m)
+	})
+}
+
+// contentHash returns a hash of the JSON encoding of v
+func contentHash(v any) string {
+	data, _ := json.Marshal(v)
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// deduplicator decides which copy of a message is delivered. Keys such as
+// execution IDs are unique and delivered once. A board diff may legitimately
+// repeat, so its occurrences are counted per source: the nth occurrence is
+// delivered by whichever source sees it first.
+type deduplicator struct {
+	sources int
+	window  int
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+	order   []string // keys in insertion order, for eviction
+}
+
+type dedupEntry struct {
+	delivered int
+	seen      []int // per source
+}
+
+func newDeduplicator(sources, window int) *deduplicator {
+	return &deduplicator{
+		sources: sources,
+		window:  window,
+		entries: make(map[string]*dedupEntry),
+	}
+}
+
+// unique records a key that never legitimately repeats and reports whether
+// it is new
+func (d *deduplicator) unique(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.entries[key]; ok {
+		return false
+	}
+	d.addLocked(key)
+	return true
+}
+
+// first records an occurrence of the key from the source and reports
+// whether it should be delivered
+func (d *deduplicator) first(source int, key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.entries[key]
+	if !ok {
+		e = d.addLocked(key)
+	}
+
+	e.seen[source]++
+	if e.seen[source] > e.delivered {
+		e.delivered = e.seen[source]
+		return true
+	}
+	return false
+}
+
+// addLocked remembers a key, forgetting the oldest beyond the window.
+// d.mu must be held.
+func (d *deduplicator) addLocked(key string) *dedupEntry {
+	e := &dedupEntry{seen: make([]int, d.sources)}
+	d.entries[key] = e
+	d.order = append(d.order, key)
+	if d.window > 0 && len(d.order) > d.window {
+		delete(d.entries, d.order[0])
+		d.order = d.order[1:]
+	}
+	return e
+}
@@ -0,0 +1,217 @@
+package websocket
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func TestDeduplicator(t *testing.T) {
+	d := newDeduplicator(2, 2)
+
+	steps := []struct {
+		source int
+		key    string
+		want   bool
+	}{
+		{0, "a", true},
+		{1, "a", false},
+		// A repeated key is delivered again by whichever source sees it first
+		{1, "a", true},
+		{0, "a", false},
+		{1, "b", true},
+		{0, "b", false},
+		// "a" is evicted by "c" and forgotten
+		{0, "c", true},
+		{1, "a", true},
+	}
+	for i, s := range steps {
+		if got := d.first(s.source, s.key); got != s.want {
+			t.Errorf("step %d: first(%d, %q) = %v, want %v", i, s.source, s.key, got, s.want)
+		}
+	}
+
+	d = newDeduplicator(2, 10)
+	if !d.unique("1") || d.unique("1") || !d.unique("2") {
+		t.Error("Expected unique keys to be delivered once")
+	}
+}
+
+func TestRedundantFeed(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	feed, err := NewRedundantFeed(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("NewRedundantFeed() error = %v", err)
+	}
+	defer feed.Close(context.Background())
+
+	tickers := make(chan TickerMessage, 10)
+	executions := make(chan Execution, 10)
+	feed.OnTicker(func(m TickerMessage) { tickers <- m })
+	feed.OnExecutions(func(m ExecutionsMessage) {
+		for _, e := range m.Executions {
+			executions <- e
+		}
+	})
+
+	tickerChannel := TickerChannel("BTC_JPY")
+	execChannel := ExecutionsChannel("BTC_JPY")
+	for _, ch := range []string{tickerChannel, execChannel} {
+		if err := feed.Subscribe(ctx, ch); err != nil {
+			t.Fatalf("Subscribe() error = %v", err)
+		}
+	}
+	// Wait for both connections to subscribe to both channels
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for !cond() {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("Timed out waiting for %s", what)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	waitFor("subscriptions", func() bool {
+		n := 0
+		for _, req := range srv.Requests() {
+			if req.Method == "subscribe" {
+				n++
+			}
+		}
+		return n == 4
+	})
+
+	publish := func(channel string, message any, wantCopies int) {
+		t.Helper()
+		n, err := srv.Publish(channel, message)
+		if err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if n != wantCopies {
+			t.Fatalf("Expected %d copies, sent %d", wantCopies, n)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case m := <-tickers:
+			t.Errorf("Unexpected duplicate ticker %+v", m)
+		case e := <-executions:
+			t.Errorf("Unexpected duplicate execution %+v", e)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// Both connections receive the ticker; it is delivered once
+	publish(tickerChannel, map[string]any{"product_code": "BTC_JPY", "timestamp": "t1", "ltp": 1}, 2)
+	select {
+	case m := <-tickers:
+		if m.Ltp != 1 {
+			t.Errorf("Unexpected ticker %+v", m)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the ticker")
+	}
+	expectNone()
+
+	// Executions are de-duplicated by ID across batches
+	publish(execChannel, map[string]any{"data": []map[string]any{{"id": 1}, {"id": 2}}}, 2)
+	publish(execChannel, map[string]any{"data": []map[string]any{{"id": 2}, {"id": 3}}}, 2)
+	got := map[int64]int{}
+	for len(got) < 3 {
+		select {
+		case e := <-executions:
+			got[e.ID]++
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for executions, got %v", got)
+		}
+	}
+	expectNone()
+	for id, n := range got {
+		if n != 1 {
+			t.Errorf("Execution %d delivered %d times", id, n)
+		}
+	}
+
+	// Losing one connection does not interrupt the feed
+	feed.Clients()[0].Close(ctx)
+	<-feed.Clients()[0].Done()
+	waitFor("the disconnect", func() bool { return srv.Connections() == 1 })
+	publish(tickerChannel, map[string]any{"product_code": "BTC_JPY", "timestamp": "t2", "ltp": 2}, 1)
+	select {
+	case m := <-tickers:
+		if m.Ltp != 2 {
+			t.Errorf("Unexpected ticker %+v", m)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the ticker after failover")
+	}
+}
+
+func TestRedundantFeed_SerializesListeners(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	feed, err := NewRedundantFeed(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("NewRedundantFeed() error = %v", err)
+	}
+	defer feed.Close(context.Background())
+
+	// A slow listener lets the other connection deliver the next message
+	// meanwhile, unless the feed serializes the listeners
+	var inFlight, overlaps, delivered atomic.Int32
+	feed.OnExecutions(func(m ExecutionsMessage) {
+		if inFlight.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(5 * time.Millisecond)
+		inFlight.Add(-1)
+		delivered.Add(int32(len(m.Executions)))
+	})
+
+	channel := ExecutionsChannel("BTC_JPY")
+	if err := feed.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	for srv.Connections() != 2 || !srv.Subscribed(channel) || len(srv.Requests()) < 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the subscriptions")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	const messages = 20
+	for i := range messages {
+		n, err := srv.Publish(channel, map[string]any{"data": []map[string]any{{"id": i + 1}}})
+		if err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if n != 2 {
+			t.Fatalf("Expected 2 copies, sent %d", n)
+		}
+	}
+	for delivered.Load() < messages {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the executions, %d delivered", delivered.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if n := overlaps.Load(); n > 0 {
+		t.Errorf("Expected the listeners to be called one at a time, %d overlapped", n)
+	}
+}
@@ -0,0 +1,310 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBuffer is the number of messages a stream holds for a consumer
+	// that is behind. A stream whose buffer is full ends.
+	streamBuffer = 256
+
+	// releaseTimeout bounds the unsubscribe request sent when a stream ends
+	releaseTimeout = 5 * time.Second
+)
+
+var (
+	// ErrClientDone ends a stream whose client is done, see Client.Done
+	ErrClientDone = errors.New("websocket client is done")
+	// ErrSlowConsumer ends a stream whose consumer fell too far behind
+	ErrSlowConsumer = errors.New("stream consumer fell behind")
+)
+
+// Tickers streams the ticker of the product until ctx ends. The channel is
+// subscribed as needed and unsubscribed when the last stream of it ends,
+// unless it was subscribed with Subscribe.
+//
+// The returned channel is closed after ctx ends or the client is done. The
+// messages are sent by the single goroutine that runs every handler of the
+// client, so it never waits for the consumer: a consumer that falls 256
+// messages behind loses the stream, which is closed. The iterators, such as
+// TickersSeq, yield why the stream ended early.
+func (c *Client) Tickers(ctx context.Context, productCode string) (<-chan TickerMessage, error) {
+	return channelOf(c.tickerStream(ctx, productCode))
+}
+
+func (c *Client) tickerStream(ctx context.Context, productCode string) (*stream[TickerMessage], error) {
+	productCode, err := c.resolveProduct(productCode)
+	if err != nil {
+		return nil, err
+	}
+	return openStream(ctx, c, TickerChannel(productCode), func(send func(TickerMessage)) *Listener {
+		return c.OnTicker(send, ForProducts(productCode))
+	})
+}
+
+// Executions streams the executions of the product until ctx ends
+func (c *Client) Executions(ctx context.Context, productCode string) (<-chan ExecutionsMessage, error) {
+	return channelOf(c.executionsStream(ctx, productCode))
+}
+
+func (c *Client) executionsStream(ctx context.Context, productCode string) (*stream[ExecutionsMessage], error) {
+	productCode, err := c.resolveProduct(productCode)
+	if err != nil {
+		return nil, err
+	}
+	return openStream(ctx, c, ExecutionsChannel(productCode), func(send func(ExecutionsMessage)) *Listener {
+		return c.OnExecutions(send, ForProducts(productCode))
+	})
+}
+
+// Boards streams the board diffs of the product until ctx ends
+func (c *Client) Boards(ctx context.Context, productCode string) (<-chan BoardMessage, error) {
+	return channelOf(c.boardsStream(ctx, productCode))
+}
+
+func (c *Client) boardsStream(ctx context.Context, productCode string) (*stream[BoardMessage], error) {
+	productCode, err := c.resolveProduct(productCode)
+	if err != nil {
+		return nil, err
+	}
+	return openStream(ctx, c, BoardChannel(productCode), func(send func(BoardMessage)) *Listener {
+		return c.OnBoard(send, ForProducts(productCode))
+	})
+}
+
+// BoardSnapshots streams the board snapshots of the product until ctx ends
+func (c *Client) BoardSnapshots(ctx context.Context, productCode string) (<-chan BoardSnapshotMessage, error) {
+	return channelOf(c.boardSnapshotsStream(ctx, productCode))
+}
+
+func (c *Client) boardSnapshotsStream(ctx context.Context, productCode string) (*stream[BoardSnapshotMessage], error) {
+	productCode, err := c.resolveProduct(productCode)
+	if err != nil {
+		return nil, err
+	}
+	return openStream(ctx, c, BoardSnapshotChannel(productCode), func(send func(BoardSnapshotMessage)) *Listener {
+		return c.OnBoardSnapshot(send, ForProducts(productCode))
+	})
+}
+
+// ChildOrderEvents streams child order events until ctx ends. The client
+// must be authenticated.
+func (c *Client) ChildOrderEvents(ctx context.Context) (<-chan OrderEventMessage, error) {
+	return channelOf(c.childOrderEventsStream(ctx))
+}
+
+func (c *Client) childOrderEventsStream(ctx context.Context) (*stream[OrderEventMessage], error) {
+	return openStream(ctx, c, ChildOrderEventsChannel, func(send func(OrderEventMessage)) *Listener {
+		return c.OnOrderEvents(send, forChannel(ChildOrderEventsChannel))
+	})
+}
+
+// ParentOrderEvents streams parent order events until ctx ends. The client
+// must be authenticated.
+func (c *Client) ParentOrderEvents(ctx context.Context) (<-chan OrderEventMessage, error) {
+	return channelOf(c.parentOrderEventsStream(ctx))
+}
+
+func (c *Client) parentOrderEventsStream(ctx context.Context) (*stream[OrderEventMessage], error) {
+	return openStream(ctx, c, ParentOrderEventsChannel, func(send func(OrderEventMessage)) *Listener {
+		return c.OnOrderEvents(send, forChannel(ParentOrderEventsChannel))
+	})
+}
+
+// TickersSeq iterates over the ticker of the product until ctx ends or the
+// loop breaks. A subscription failure is yielded as the only error. When
+// the stream ends before ctx, ErrClientDone or ErrSlowConsumer is yielded
+// last.
+func (c *Client) TickersSeq(ctx context.Context, productCode string) iter.Seq2[TickerMessage, error] {
+	return streamSeq(ctx, func(ctx context.Context) (*stream[TickerMessage], error) {
+		return c.tickerStream(ctx, productCode)
+	})
+}
+
+// ExecutionsSeq iterates over the executions of the product
+func (c *Client) ExecutionsSeq(ctx context.Context, productCode string) iter.Seq2[ExecutionsMessage, error] {
+	return streamSeq(ctx, func(ctx context.Context) (*stream[ExecutionsMessage], error) {
+		return c.executionsStream(ctx, productCode)
+	})
+}
+
+// BoardsSeq iterates over the board diffs of the product
+func (c *Client) BoardsSeq(ctx context.Context, productCode string) iter.Seq2[BoardMessage, error] {
+	return streamSeq(ctx, func(ctx context.Context) (*stream[BoardMessage], error) {
+		return c.boardsStream(ctx, productCode)
+	})
+}
+
+// BoardSnapshotsSeq iterates over the board snapshots of the product
+func (c *Client) BoardSnapshotsSeq(ctx context.Context, productCode string) iter.Seq2[BoardSnapshotMessage, error] {
+	return streamSeq(ctx, func(ctx context.Context) (*stream[BoardSnapshotMessage], error) {
+		return c.boardSnapshotsStream(ctx, productCode)
+	})
+}
+
+// ChildOrderEventsSeq iterates over child order events
+func (c *Client) ChildOrderEventsSeq(ctx context.Context) iter.Seq2[OrderEventMessage, error] {
+	return streamSeq(ctx, c.childOrderEventsStream)
+}
+
+// ParentOrderEventsSeq iterates over parent order events
+func (c *Client) ParentOrderEventsSeq(ctx context.Context) iter.Seq2[OrderEventMessage, error] {
+	return streamSeq(ctx, c.parentOrderEventsStream)
+}
+
+// stream forwards the messages of a listener to a channel
+type stream[T any] struct {
+	out chan T
+
+	mu     sync.Mutex
+	closed bool
+	err    error // why the stream ended before its ctx
+}
+
+// close closes the channel once, recording why
+func (s *stream[T]) close(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.out)
+}
+
+// Err returns why the stream ended before its ctx, nil otherwise
+func (s *stream[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// channelOf returns the channel of a stream
+func channelOf[T any](s *stream[T], err error) (<-chan T, error) {
+	if err != nil {
+		return nil, err
+	}
+	return s.out, nil
+}
+
+// openStream registers a listener that forwards messages to a stream and
+// holds a subscription to the channel until ctx ends, the client is done or
+// the consumer falls behind
+func openStream[T any](ctx context.Context, c *Client, channel string, listen func(send func(T)) *Listener) (*stream[T], error) {
+	if err := c.acquire(ctx, channel); err != nil {
+		return nil, err
+	}
+
+	s := &stream[T]{out: make(chan T, streamBuffer)}
+	overflow := make(chan struct{})
+
+	l := listen(func(msg T) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.closed {
+			return
+		}
+		// Never wait for the consumer: every handler of the client runs on
+		// this goroutine
+		select {
+		case s.out <- msg:
+		default:
+			s.close(ErrSlowConsumer)
+			close(overflow)
+		}
+	})
+
+	go func() {
+		var err error
+		select {
+		case <-ctx.Done():
+		case <-c.Done():
+			err = ErrClientDone
+		case <-overflow:
+		}
+		l.Remove()
+
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+		defer cancel()
+		c.release(releaseCtx, channel)
+
+		s.mu.Lock()
+		s.close(err)
+		s.mu.Unlock()
+	}()
+
+	return s, nil
+}
+
+// streamSeq adapts a stream to an iterator that ends the stream when the
+// loop breaks
+func streamSeq[T any](ctx context.Context, open func(context.Context) (*stream[T], error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var zero T
+		s, err := open(ctx)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for msg := range s.out {
+			if !yield(msg, nil) {
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// acquire takes a reference to a channel subscription, subscribing on the
+// first reference unless the channel was subscribed with Subscribe
+func (c *Client) acquire(ctx context.Context, channel string) error {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+
+	if c.streamRefs == nil {
+		c.streamRefs = make(map[string]int)
+		c.streamOwned = make(map[string]struct{})
+	}
+	if c.streamRefs[channel] == 0 {
+		c.mu.Lock()
+		_, subscribed := c.subscribedChannels[channel]
+		c.mu.Unlock()
+
+		if !subscribed {
+			if err := c.Subscribe(ctx, channel); err != nil {
+				return err
+			}
+			c.streamOwned[channel] = struct{}{}
+		}
+	}
+	c.streamRefs[channel]++
+	return nil
+}
+
+// release drops a reference taken by acquire, unsubscribing with the last
+// reference if acquire subscribed
+func (c *Client) release(ctx context.Context, channel string) {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+
+	c.streamRefs[channel]--
+	if c.streamRefs[channel] > 0 {
+		return
+	}
+	delete(c.streamRefs, channel)
+	if _, owned := c.streamOwned[channel]; owned {
+		delete(c.streamOwned, channel)
+		if err := c.Unsubscribe(ctx, channel); err != nil {
+			c.log().Warn("failed to release stream subscription", "channel", channel, "error", err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func newStreamTestClient(t *testing.T) (*Client, *wstest.Server, context.Context) {
+	t.Helper()
+
+	srv := wstest.NewServer()
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	client, err := NewClient(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close(context.Background()) })
+	return client, srv, ctx
+}
+
+// waitUnsubscribed waits until the server no longer has the channel subscribed
+func waitUnsubscribed(t *testing.T, ctx context.Context, srv *wstest.Server, channel string) {
+	t.Helper()
+	for srv.Subscribed(channel) {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for %s to be unsubscribed", channel)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestTickers(t *testing.T) {
+	client, srv, ctx := newStreamTestClient(t)
+	channel := TickerChannel("BTC_JPY")
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	first, err := client.Tickers(ctx1, "BTC_JPY")
+	if err != nil {
+		t.Fatalf("Tickers() error = %v", err)
+	}
+	ctx2, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+	second, err := client.Tickers(ctx2, "BTC_JPY")
+	if err != nil {
+		t.Fatalf("Tickers() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, channel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	if _, err := srv.Publish(channel, map[string]any{"product_code": "BTC_JPY", "ltp": 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	for _, ch := range []<-chan TickerMessage{first, second} {
+		select {
+		case ticker := <-ch:
+			if ticker.Ltp != 1 {
+				t.Errorf("Expected ltp 1, got %v", ticker.Ltp)
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the ticker")
+		}
+	}
+
+	// The subscription is shared until the last stream ends
+	cancel1()
+	for range first {
+	}
+	if !srv.Subscribed(channel) {
+		t.Error("Expected the channel to stay subscribed while a stream is open")
+	}
+
+	cancel2()
+	for range second {
+	}
+	waitUnsubscribed(t, ctx, srv, channel)
+
+	subscribes := 0
+	for _, req := range srv.Requests() {
+		if req.Method == "subscribe" {
+			subscribes++
+		}
+	}
+	if subscribes != 1 {
+		t.Errorf("Expected 1 subscribe request, got %d", subscribes)
+	}
+}
+
+func TestTickers_KeepsManualSubscription(t *testing.T) {
+	client, _, ctx := newStreamTestClient(t)
+	channel := TickerChannel("BTC_JPY")
+
+	if err := client.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	ch, err := client.Tickers(streamCtx, "BTC_JPY")
+	if err != nil {
+		t.Fatalf("Tickers() error = %v", err)
+	}
+	cancel()
+	for range ch {
+	}
+
+	// Unsubscribing again must succeed because the stream did not unsubscribe
+	if err := client.Unsubscribe(ctx, channel); err != nil {
+		t.Errorf("Expected the manual subscription to be kept: %v", err)
+	}
+}
+
+func TestTickers_InvalidProduct(t *testing.T) {
+	client, _, ctx := newStreamTestClient(t)
+	if _, err := client.Tickers(ctx, ""); err == nil {
+		t.Error("Expected error for an empty product code")
+	}
+}
+
+func TestTickersSeq(t *testing.T) {
+	client, srv, ctx := newStreamTestClient(t)
+	channel := TickerChannel("BTC_JPY")
+
+	go func() {
+		if err := srv.WaitSubscribed(ctx, channel); err != nil {
+			return
+		}
+		for i := 1; i <= 3; i++ {
+			_, _ = srv.Publish(channel, map[string]any{"product_code": "BTC_JPY", "ltp": i})
+		}
+	}()
+
+	count := 0
+	for ticker, err := range client.TickersSeq(ctx, "BTC_JPY") {
+		if err != nil {
+			t.Fatalf("TickersSeq() error = %v", err)
+		}
+		if ticker.ProductCode != "BTC_JPY" {
+			t.Errorf("Unexpected product %q", ticker.ProductCode)
+		}
+		count++
+		if count == 2 {
+			break
+		}
+	}
+
+	waitUnsubscribed(t, ctx, srv, channel)
+
+	for _, err := range client.TickersSeq(ctx, "") {
+		if err == nil {
+			t.Error("Expected the subscription error to be yielded")
+		}
+	}
+}
+
+func TestChildOrderEvents_FiltersChannel(t *testing.T) {
+	client, srv, ctx := newStreamTestClient(t)
+
+	events, err := client.ChildOrderEvents(ctx)
+	if err != nil {
+		t.Fatalf("ChildOrderEvents() error = %v", err)
+	}
+	if err := client.Subscribe(ctx, ParentOrderEventsChannel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, ChildOrderEventsChannel, ParentOrderEventsChannel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	if _, err := srv.Publish(ParentOrderEventsChannel, []map[string]any{{"event_type": "TRIGGER"}}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if _, err := srv.Publish(ChildOrderEventsChannel, []map[string]any{{"event_type": "ORDER"}}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.EventType != "ORDER" {
+			t.Errorf("Expected only child order events, got %q", event.EventType)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the event")
+	}
+}
+
+func TestTickers_Alias(t *testing.T) {
+	client, srv, ctx := newStreamTestClient(t)
+	client.SetProductResolver(stubResolver{"BTCJPY_MAT1WK": "BTCJPY24OCT2026"})
+	channel := TickerChannel("BTCJPY24OCT2026")
+
+	tickers, err := client.Tickers(ctx, "BTCJPY_MAT1WK")
+	if err != nil {
+		t.Fatalf("Tickers() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, channel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	// Messages carry the product code, not the alias
+	if _, err := srv.Publish(channel, map[string]any{"product_code": "BTCJPY24OCT2026", "ltp": 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case ticker := <-tickers:
+		if ticker.Ltp != 1 {
+			t.Errorf("Expected ltp 1, got %v", ticker.Ltp)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the ticker")
+	}
+}
+
+func TestTickersSeq_ClientDone(t *testing.T) {
+	client, srv, ctx := newStreamTestClient(t)
+	channel := TickerChannel("BTC_JPY")
+
+	go func() {
+		if err := srv.WaitSubscribed(ctx, channel); err != nil {
+			return
+		}
+		client.Close(ctx)
+	}()
+
+	var last error
+	for _, err := range client.TickersSeq(ctx, "BTC_JPY") {
+		last = err
+	}
+	if !errors.Is(last, ErrClientDone) {
+		t.Errorf("Expected the stream to end with ErrClientDone, got %v", last)
+	}
+}
+
+func TestTickers_SlowConsumer(t *testing.T) {
+	client, srv, ctx := newStreamTestClient(t)
+	channel := TickerChannel("BTC_JPY")
+
+	ch, err := client.Tickers(ctx, "BTC_JPY")
+	if err != nil {
+		t.Fatalf("Tickers() error = %v", err)
+	}
+	// Registered after the stream, so it sees each message once the stream did
+	var handled atomic.Int32
+	client.OnTicker(func(TickerMessage) { handled.Add(1) })
+	if err := srv.WaitSubscribed(ctx, channel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	published := streamBuffer + 10
+	for i := range published {
+		if _, err := srv.Publish(channel, map[string]any{"product_code": "BTC_JPY", "ltp": i}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	for handled.Load() < int32(published) {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the messages, %d handled", handled.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// The handlers did not wait for the consumer, which lost the stream
+	received := 0
+	for range ch {
+		received++
+	}
+	if received != streamBuffer {
+		t.Errorf("Expected the %d buffered messages, got %d", streamBuffer, received)
+	}
+	waitUnsubscribed(t, ctx, srv, channel)
+}
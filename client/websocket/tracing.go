@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/tracing"
+)
+
+// finalOrderEvents are the event types after which no further events
+// follow for the order
+var finalOrderEvents = map[string]struct{}{
+	"CANCEL":       {},
+	"EXPIRE":       {},
+	"ORDER_FAILED": {},
+}
+
+// WithTracing records a span for every child_order_events event. When the
+// order was submitted through a client sharing the linker, the span joins
+// the trace of the submission.
+func WithTracing(provider trace.TracerProvider, linker *tracing.OrderLinker) ClientOption {
+	return func(c *Client) {
+		c.tracer = provider.Tracer(tracing.InstrumentationName)
+		c.linker = linker
+	}
+}
+
+// decodeOrderEvents decodes an array of order events or a single event
+func decodeOrderEvents(raw json.RawMessage) ([]OrderEventMessage, error) {
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var events []OrderEventMessage
+		if err := json.Unmarshal(trimmed, &events); err != nil {
+			return nil, err
+		}
+		return events, nil
+	}
+
+	var event OrderEventMessage
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, err
+	}
+	return []OrderEventMessage{event}, nil
+}
+
+// traceOrderEvent records a span for a child order event
+func (c *Client) traceOrderEvent(event OrderEventMessage) {
+	if c.tracer == nil {
+		return
+	}
+
+	ctx := context.Background()
+	if c.linker != nil {
+		if sc, ok := c.linker.SpanContext(event.ChildOrderAcceptanceID); ok {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+		}
+		if _, final := finalOrderEvents[event.EventType]; final {
+			c.linker.Unlink(event.ChildOrderAcceptanceID)
+		}
+	}
+
+	_, span := c.tracer.Start(ctx, "child_order_event "+event.EventType,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("bitflyer.product_code", event.ProductCode),
+			attribute.String("bitflyer.child_order_acceptance_id", event.ChildOrderAcceptanceID),
+			attribute.String("bitflyer.child_order_id", event.ChildOrderID),
+			attribute.String("bitflyer.event_type", event.EventType),
+			attribute.String("bitflyer.side", event.Side),
+			attribute.Float64("bitflyer.price", event.Price),
+			attribute.Float64("bitflyer.size", event.Size),
+		),
+	)
+	span.End()
+}
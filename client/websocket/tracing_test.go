@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/tracing"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func TestDecodeOrderEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"array", `[{"event_type":"ORDER"},{"event_type":"EXECUTION"}]`, 2, false},
+		{"object", `{"event_type":"ORDER"}`, 1, false},
+		{"invalid", `[{"event_type":1}]`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := decodeOrderEvents([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeOrderEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(events) != tt.want {
+				t.Errorf("Expected %d events, got %d", tt.want, len(events))
+			}
+		})
+	}
+}
+
+func TestWithTracing(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	linker := tracing.NewOrderLinker()
+
+	// The submission span as recorded by the REST client
+	_, submit := provider.Tracer("test").Start(ctx, "POST /v1/me/sendchildorder")
+	linker.Link("JRF1", submit.SpanContext())
+	submit.End()
+
+	client, err := NewClient(ctx, srv.URL, WithTracing(provider, linker))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	received := make(chan OrderEventMessage, 3)
+	client.OnOrderEvents(func(event OrderEventMessage) { received <- event })
+
+	if err := client.Subscribe(ctx, ChildOrderEventsChannel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, ChildOrderEventsChannel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	if _, err := srv.Publish(ChildOrderEventsChannel, []map[string]any{
+		{"product_code": "BTC_JPY", "child_order_acceptance_id": "JRF1", "event_type": "ORDER", "price": 5000000, "size": 0.01},
+		{"product_code": "BTC_JPY", "child_order_acceptance_id": "JRF1", "event_type": "CANCEL"},
+		{"product_code": "BTC_JPY", "child_order_acceptance_id": "JRF2", "event_type": "ORDER"},
+	}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-received:
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for order events")
+		}
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("Expected 4 spans, got %d", len(spans))
+	}
+	traceID := submit.SpanContext().TraceID()
+	for i, name := range []string{"child_order_event ORDER", "child_order_event CANCEL"} {
+		span := spans[i+1]
+		if span.Name() != name {
+			t.Errorf("Expected span %q, got %q", name, span.Name())
+		}
+		if span.SpanContext().TraceID() != traceID || span.Parent().SpanID() != submit.SpanContext().SpanID() {
+			t.Errorf("Expected %q to join the submission trace", span.Name())
+		}
+	}
+	if spans[3].SpanContext().TraceID() == traceID {
+		t.Error("Expected an unlinked order to start its own trace")
+	}
+	if linker.Len() != 0 {
+		t.Errorf("Expected the cancelled order to be unlinked, %d entries left", linker.Len())
+	}
+}
@@ -0,0 +1,380 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// StaleChannel describes a subscribed channel that has gone quiet
+type StaleChannel struct {
+	Channel string
+	// Silence is the time since the last message, or since the subscription
+	// if no message arrived
+	Silence time.Duration
+}
+
+// ExecutionGap describes a jump in execution IDs on an executions channel
+type ExecutionGap struct {
+	Channel string
+	// LastID is the highest execution ID seen before the gap
+	LastID int64
+	// NextID is the first execution ID after the gap
+	NextID int64
+}
+
+// maxReconnectBackoff caps the wait between reconnection attempts
+const maxReconnectBackoff = 30 * time.Second
+
+// WithPingInterval sends a ping at the interval. A failed ping is logged and,
+// with WithAutoReconnect, drops the connection so that it is reconnected.
+func WithPingInterval(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.pingInterval = d
+	}
+}
+
+// WithStaleTimeout reports a subscribed channel through OnStale when no
+// message arrived on it for d. With WithAutoReconnect, a stale channel also
+// triggers a reconnect. The order event channels are not checked, since
+// they stay quiet while no order changes.
+func WithStaleTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.staleTimeout = d
+	}
+}
+
+// WithGapThreshold reports through OnGap when consecutive execution IDs of
+// an executions channel differ by more than n. Execution IDs are shared by
+// every product, so contiguous IDs cannot be expected; n must allow for the
+// executions of other products.
+func WithGapThreshold(n int64) ClientOption {
+	return func(c *Client) {
+		c.gapThreshold = n
+	}
+}
+
+// WithAutoReconnect reconnects when the connection is lost, a ping fails or
+// a channel goes stale. The client authenticates again if Auth was called,
+// subscribes to its channels again and notifies OnReconnect listeners so
+// that state such as order books can be resynchronized.
+func WithAutoReconnect() ClientOption {
+	return func(c *Client) {
+		c.autoReconnect = true
+	}
+}
+
+// OnStale registers a callback for channels that have gone quiet. It fires
+// once per silence; the channel is reported again only after it recovers.
+func (c *Client) OnStale(handler func(StaleChannel)) *Listener {
+	return addListener(c, &c.staleListeners, handler, nil)
+}
+
+// OnGap registers a callback for jumps in execution IDs
+func (c *Client) OnGap(handler func(ExecutionGap)) *Listener {
+	return addListener(c, &c.gapListeners, handler, nil)
+}
+
+// OnReconnect registers a callback that runs after the client has
+// reconnected and the realtime API accepted the authentication and every
+// subscription again. Board snapshots and other state should be
+// resynchronized here, since messages were lost in between.
+func (c *Client) OnReconnect(handler func()) *Listener {
+	return addListener(c, &c.reconnectListeners, func(struct{}) { handler() }, nil)
+}
+
+// OnDisconnect registers a callback that runs when the connection is lost,
+// before any reconnect, and when the realtime API rejects the
+// authentication or a subscription sent again after a reconnect. With
+// WithAutoReconnect, OnReconnect follows once the connection is restored.
+func (c *Client) OnDisconnect(handler func(error)) *Listener {
+	return addListener(c, &c.disconnectListeners, handler, nil)
+}
+
+// disconnected notifies OnDisconnect listeners
+func (c *Client) disconnected(err error) {
+	for _, l := range listenersOf(c, &c.disconnectListeners) {
+		l.handler(err)
+	}
+}
+
+// Reconnect replaces the connection, authenticates again if Auth was
+// called and subscribes to the current channels again. OnReconnect
+// listeners are notified once the realtime API accepted every request, and
+// OnDisconnect listeners if it rejected one.
+func (c *Client) Reconnect(ctx context.Context) error {
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.conn
+	c.conn = conn
+	apiKey, apiSecret := c.apiKey, c.apiSecret
+	channels := make([]string, 0, len(c.subscribedChannels))
+	for ch := range c.subscribedChannels {
+		channels = append(channels, ch)
+	}
+	c.mu.Unlock()
+
+	if old != nil {
+		_ = old.Close(websocket.StatusGoingAway, "reconnecting")
+	}
+	if c.metrics != nil {
+		c.metrics.ObserveReconnect()
+	}
+
+	// Reserve the request IDs before sending, since the answers are
+	// handled on another goroutine
+	requests := make(map[int]string, len(channels)+1)
+	authID := 0
+	if apiKey != "" {
+		authID = c.getNextID()
+		requests[authID] = "authenticate"
+	}
+	subscribeIDs := make([]int, len(channels))
+	for i, ch := range channels {
+		subscribeIDs[i] = c.getNextID()
+		requests[subscribeIDs[i]] = "subscribe to " + ch
+	}
+	c.mu.Lock()
+	c.restoring = requests
+	c.mu.Unlock()
+
+	if apiKey != "" {
+		if err := c.sendRequest(ctx, authID, "auth", c.authParams(apiKey, apiSecret)); err != nil {
+			return fmt.Errorf("failed to authenticate after reconnect: %w", err)
+		}
+	}
+	for i, ch := range channels {
+		if err := c.sendRequest(ctx, subscribeIDs[i], "subscribe", map[string]string{"channel": ch}); err != nil {
+			return fmt.Errorf("failed to subscribe to %s after reconnect: %w", ch, err)
+		}
+		c.watchChannel(ch)
+	}
+
+	c.watchMu.Lock()
+	c.lastExecID = nil
+	c.watchMu.Unlock()
+
+	c.log().Info("websocket reconnected", "url", c.wsURL, "channels", len(channels))
+	if len(requests) == 0 {
+		c.restored()
+	}
+	return nil
+}
+
+// handleResponse logs failed requests and tracks the answers to the
+// requests sent by Reconnect
+func (c *Client) handleResponse(msg map[string]json.RawMessage) {
+	rpcErr, failed := msg["error"]
+	if failed {
+		// Surface failures such as a rejected auth
+		c.log().Warn("request failed", "id", string(msg["id"]), "error", string(rpcErr))
+	}
+	var id int
+	if err := json.Unmarshal(msg["id"], &id); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	request, ok := c.restoring[id]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.restoring, id)
+	done := len(c.restoring) == 0
+	if failed {
+		// The other answers do not matter anymore
+		c.restoring = nil
+	}
+	c.mu.Unlock()
+
+	switch {
+	case failed:
+		c.disconnected(fmt.Errorf("failed to %s after reconnect: %s", request, rpcErr))
+	case done:
+		c.restored()
+	}
+}
+
+// restored notifies OnReconnect listeners
+func (c *Client) restored() {
+	c.log().Info("websocket subscriptions restored", "url", c.wsURL)
+	for _, l := range listenersOf(c, &c.reconnectListeners) {
+		l.handler(struct{}{})
+	}
+}
+
+// reconnectWithRetry reconnects with exponential backoff until it succeeds
+// or ctx ends, and reports whether it succeeded
+func (c *Client) reconnectWithRetry(ctx context.Context) bool {
+	backoff := 100 * time.Millisecond
+	for {
+		err := c.Reconnect(ctx)
+		if err == nil {
+			return true
+		}
+		c.log().Warn("websocket reconnect failed", "url", c.wsURL, "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+}
+
+// watch pings and checks channels for silence until ctx ends
+func (c *Client) watch(ctx context.Context) {
+	interval := c.pingInterval
+	if c.staleTimeout > 0 && (interval == 0 || c.staleTimeout/4 < interval) {
+		interval = c.staleTimeout / 4
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastPing := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if c.pingInterval > 0 && now.Sub(lastPing) >= c.pingInterval {
+				lastPing = now
+				if !c.ping(ctx) {
+					continue
+				}
+			}
+			if c.staleTimeout > 0 {
+				c.checkStale(now)
+			}
+		}
+	}
+}
+
+// ping sends a ping and reports whether the connection is healthy
+func (c *Client) ping(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, c.pingInterval)
+	defer cancel()
+
+	conn := c.currentConn()
+	err := conn.Ping(pingCtx)
+	if err == nil || ctx.Err() != nil {
+		return true
+	}
+	c.log().Warn("websocket ping failed", "url", c.wsURL, "error", err)
+	if c.autoReconnect {
+		// The receive loop fails on the closed connection and reconnects
+		_ = conn.CloseNow()
+	}
+	return false
+}
+
+// checkStale reports channels that have been silent for longer than the timeout
+func (c *Client) checkStale(now time.Time) {
+	var stale []StaleChannel
+
+	c.watchMu.Lock()
+	for ch, last := range c.lastMessage {
+		if _, reported := c.staleReported[ch]; reported {
+			continue
+		}
+		if silence := now.Sub(last); silence >= c.staleTimeout {
+			c.staleReported[ch] = struct{}{}
+			stale = append(stale, StaleChannel{Channel: ch, Silence: silence})
+		}
+	}
+	c.watchMu.Unlock()
+
+	if len(stale) == 0 {
+		return
+	}
+	for _, s := range stale {
+		c.log().Warn("websocket channel is stale", "channel", s.Channel, "silence", s.Silence)
+		for _, l := range listenersOf(c, &c.staleListeners) {
+			l.handler(s)
+		}
+	}
+	if c.autoReconnect {
+		// As on a failed ping, the receive loop fails on the closed
+		// connection, notifies the disconnect and reconnects
+		_ = c.currentConn().CloseNow()
+	}
+}
+
+// watchChannel starts tracking silence on a subscribed channel
+func (c *Client) watchChannel(channel string) {
+	if channel == ChildOrderEventsChannel || channel == ParentOrderEventsChannel {
+		return
+	}
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	if c.lastMessage == nil {
+		c.lastMessage = make(map[string]time.Time)
+		c.staleReported = make(map[string]struct{})
+	}
+	c.lastMessage[channel] = time.Now()
+	delete(c.staleReported, channel)
+}
+
+// unwatchChannel stops tracking an unsubscribed channel
+func (c *Client) unwatchChannel(channel string) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	delete(c.lastMessage, channel)
+	delete(c.staleReported, channel)
+	delete(c.lastExecID, channel)
+}
+
+// touchChannel records a message on a channel
+func (c *Client) touchChannel(channel string) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	if _, ok := c.lastMessage[channel]; ok {
+		c.lastMessage[channel] = time.Now()
+		delete(c.staleReported, channel)
+	}
+}
+
+// checkExecutionGap reports a jump between the highest execution ID seen on
+// the channel and the lowest of the batch
+func (c *Client) checkExecutionGap(channel string, executions ExecutionsMessage) {
+	if c.gapThreshold <= 0 || len(executions.Executions) == 0 {
+		return
+	}
+	lowest, highest := executions.Executions[0].ID, executions.Executions[0].ID
+	for _, e := range executions.Executions[1:] {
+		lowest = min(lowest, e.ID)
+		highest = max(highest, e.ID)
+	}
+
+	c.watchMu.Lock()
+	if c.lastExecID == nil {
+		c.lastExecID = make(map[string]int64)
+	}
+	last, seen := c.lastExecID[channel]
+	if highest > last {
+		c.lastExecID[channel] = highest
+	}
+	c.watchMu.Unlock()
+
+	// Batches handled out of order only look like gaps below the threshold
+	if !seen || lowest-last <= c.gapThreshold {
+		return
+	}
+	gap := ExecutionGap{Channel: channel, LastID: last, NextID: lowest}
+	c.log().Warn("gap in execution IDs", "channel", channel, "last_id", last, "next_id", lowest)
+	for _, l := range listenersOf(c, &c.gapListeners) {
+		l.handler(gap)
+	}
+}
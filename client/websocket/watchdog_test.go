@@ -0,0 +1,317 @@
+package websocket
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func TestOnStale(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewClient(ctx, srv.URL, WithStaleTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	stale := make(chan StaleChannel, 10)
+	client.OnStale(func(s StaleChannel) { stale <- s })
+
+	channel := TickerChannel("BTC_JPY")
+	if err := client.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	// Order events are quiet while no order changes, so they never go stale
+	if err := client.Subscribe(ctx, ChildOrderEventsChannel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	expectStale := func() {
+		t.Helper()
+		select {
+		case s := <-stale:
+			if s.Channel != channel || s.Silence < 100*time.Millisecond {
+				t.Errorf("Unexpected stale report %+v", s)
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the stale report")
+		}
+	}
+	expectStale()
+
+	// Reported once per silence
+	select {
+	case s := <-stale:
+		t.Fatalf("Unexpected second report %+v", s)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// A message resets the silence
+	if _, err := srv.Publish(channel, map[string]any{"product_code": "BTC_JPY"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	expectStale()
+}
+
+func TestOnStale_Reconnect(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewClient(ctx, srv.URL, WithStaleTimeout(100*time.Millisecond), WithAutoReconnect())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	// The receive loop notifies the disconnect and reconnects, as on a
+	// dropped connection
+	disconnected := make(chan error, 10)
+	client.OnDisconnect(func(err error) { disconnected <- err })
+	reconnected := make(chan struct{}, 10)
+	client.OnReconnect(func() { reconnected <- struct{}{} })
+
+	channel := TickerChannel("BTC_JPY")
+	if err := client.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	select {
+	case <-disconnected:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the disconnect")
+	}
+	select {
+	case <-reconnected:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the reconnect")
+	}
+	for srv.Connections() != 1 || !srv.Subscribed(channel) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the new subscription")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestOnGap(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewClient(ctx, srv.URL, WithGapThreshold(10))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	gaps := make(chan ExecutionGap, 10)
+	client.OnGap(func(g ExecutionGap) { gaps <- g })
+
+	channel := ExecutionsChannel("BTC_JPY")
+	if err := client.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, channel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	// Batches are published one at a time so that they are handled in order
+	for _, ids := range [][]int64{{1, 2}, {5}, {100, 101}} {
+		data := make([]map[string]any, 0, len(ids))
+		for _, id := range ids {
+			data = append(data, map[string]any{"id": id})
+		}
+		if _, err := srv.Publish(channel, map[string]any{"data": data}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	select {
+	case g := <-gaps:
+		want := ExecutionGap{Channel: channel, LastID: 5, NextID: 100}
+		if g != want {
+			t.Errorf("OnGap() = %+v, want %+v", g, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the gap")
+	}
+	select {
+	case g := <-gaps:
+		t.Errorf("Unexpected gap %+v", g)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type reconnectCounter struct {
+	*stubMetrics
+	reconnects atomic.Int32
+}
+
+func (m *reconnectCounter) ObserveReconnect() {
+	m.reconnects.Add(1)
+}
+
+func TestAutoReconnect(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := &reconnectCounter{stubMetrics: newStubMetrics()}
+	client, err := NewClient(ctx, srv.URL, WithAutoReconnect(), WithMetrics(m))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	disconnected := make(chan error, 1)
+	client.OnDisconnect(func(err error) { disconnected <- err })
+	reconnected := make(chan struct{}, 1)
+	client.OnReconnect(func() { reconnected <- struct{}{} })
+	tickers := make(chan TickerMessage, 1)
+	client.OnTicker(func(ticker TickerMessage) { tickers <- ticker })
+
+	if err := client.Auth(ctx, "key", "secret"); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	channel := TickerChannel("BTC_JPY")
+	if err := client.Subscribe(ctx, channel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, channel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	srv.DisconnectAll()
+	select {
+	case <-disconnected:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the disconnect")
+	}
+	select {
+	case <-reconnected:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the reconnect")
+	}
+	// Wait for the old connection to go away and the new one to subscribe
+	for srv.Connections() != 1 || !srv.Subscribed(channel) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the new subscription")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if _, err := srv.Publish(channel, map[string]any{"product_code": "BTC_JPY", "ltp": 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case <-tickers:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for a ticker after the reconnect")
+	}
+
+	select {
+	case <-client.Done():
+		t.Error("Expected Done to stay open after a successful reconnect")
+	default:
+	}
+	if got := m.reconnects.Load(); got != 1 {
+		t.Errorf("Expected 1 reconnect, got %d", got)
+	}
+	auths := 0
+	for _, req := range srv.Requests() {
+		if req.Method == "auth" {
+			auths++
+		}
+	}
+	if auths != 2 {
+		t.Errorf("Expected to authenticate again after the reconnect, got %d auth requests", auths)
+	}
+}
+
+func TestPingInterval(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewClient(ctx, srv.URL, WithPingInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// The pings succeed, so the connection stays up
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-client.Done():
+		t.Fatal("Expected the connection to stay up")
+	default:
+	}
+
+	client.Close(ctx)
+	select {
+	case <-client.Done():
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for Done after Close")
+	}
+}
+
+func TestAutoReconnect_AuthRejected(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewClient(ctx, srv.URL, WithAutoReconnect())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close(ctx)
+
+	disconnected := make(chan error, 2)
+	client.OnDisconnect(func(err error) { disconnected <- err })
+	var reconnects atomic.Int32
+	client.OnReconnect(func() { reconnects.Add(1) })
+
+	if err := client.Auth(ctx, "key", "secret"); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	if err := client.Subscribe(ctx, ChildOrderEventsChannel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, ChildOrderEventsChannel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	// The connection comes back but the private channels do not
+	srv.RejectAuth("Invalid signature")
+	srv.DisconnectAll()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-disconnected:
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for disconnect %d", i+1)
+		}
+	}
+	if got := reconnects.Load(); got != 0 {
+		t.Errorf("Expected no reconnect notification after a rejected auth, got %d", got)
+	}
+}
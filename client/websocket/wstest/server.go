@@ -0,0 +1,302 @@
+// Package wstest provides a fake bitFlyer realtime API server for tests.
+//
+// The server speaks the JSON-RPC dialect of the realtime API: it accepts
+// auth, subscribe and unsubscribe requests and lets tests publish channel
+// messages to the connected clients.
+package wstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// Request is a JSON-RPC request received from a client
+type Request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      int             `json:"id"`
+}
+
+// Server is a fake realtime API server
+type Server struct {
+	// URL is the ws:// URL of the server
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	changed  chan struct{} // closed and replaced whenever the state changes
+	conns    map[*conn]struct{}
+	requests []Request
+	authErr  string
+}
+
+// conn is a connected client
+type conn struct {
+	ws            *websocket.Conn
+	writeMu       sync.Mutex
+	subscriptions map[string]struct{}
+	authenticated bool
+}
+
+// NewServer starts a new fake server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		changed: make(chan struct{}),
+		conns:   make(map[*conn]struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+	return s
+}
+
+// Close disconnects every client and stops the server
+func (s *Server) Close() {
+	s.DisconnectAll()
+	s.srv.Close()
+}
+
+// RejectAuth makes subsequent auth requests fail with the message
+func (s *Server) RejectAuth(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authErr = message
+}
+
+// Requests returns every request received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Subscribed reports whether any connected client subscribes to the channel
+func (s *Server) Subscribed(channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribedLocked(channel)
+}
+
+// Authenticated reports whether any connected client has authenticated
+func (s *Server) Authenticated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if c.authenticated {
+			return true
+		}
+	}
+	return false
+}
+
+// Connections returns the number of connected clients
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// WaitSubscribed blocks until a client subscribes to every channel or
+// ctx is done
+func (s *Server) WaitSubscribed(ctx context.Context, channels ...string) error {
+	return s.wait(ctx, func() bool {
+		for _, ch := range channels {
+			if !s.subscribedLocked(ch) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// WaitConnections blocks until n clients are connected or ctx is done
+func (s *Server) WaitConnections(ctx context.Context, n int) error {
+	return s.wait(ctx, func() bool { return len(s.conns) >= n })
+}
+
+// Publish sends a channel message to every client subscribed to the channel
+// and returns the number of clients it was sent to
+func (s *Server) Publish(channel string, message any) (int, error) {
+	s.mu.Lock()
+	var targets []*conn
+	for c := range s.conns {
+		if _, ok := c.subscriptions[channel]; ok {
+			targets = append(targets, c)
+		}
+	}
+	s.mu.Unlock()
+
+	notification := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "channelMessage",
+		"params": map[string]any{
+			"channel": channel,
+			"message": message,
+		},
+	}
+	for _, c := range targets {
+		if err := c.write(notification); err != nil {
+			return 0, fmt.Errorf("failed to publish to %s: %w", channel, err)
+		}
+	}
+	return len(targets), nil
+}
+
+// PublishRaw sends a raw frame to every connected client
+func (s *Server) PublishRaw(data []byte) error {
+	s.mu.Lock()
+	targets := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		targets = append(targets, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range targets {
+		c.writeMu.Lock()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := c.ws.Write(ctx, websocket.MessageText, data)
+		cancel()
+		c.writeMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to write frame: %w", err)
+		}
+	}
+	return nil
+}
+
+// DisconnectAll closes every client connection
+func (s *Server) DisconnectAll() {
+	s.mu.Lock()
+	targets := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		targets = append(targets, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range targets {
+		_ = c.ws.Close(websocket.StatusGoingAway, "server disconnect")
+	}
+}
+
+// serve handles a single client connection
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{ws: ws, subscriptions: make(map[string]struct{})}
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.notifyLocked()
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.notifyLocked()
+		s.mu.Unlock()
+		_ = ws.CloseNow()
+	}()
+
+	ctx := r.Context()
+	for {
+		var req Request
+		if err := wsjson.Read(ctx, ws, &req); err != nil {
+			return
+		}
+		s.handle(c, req)
+	}
+}
+
+// handle processes a JSON-RPC request and writes the response
+func (s *Server) handle(c *conn, req Request) {
+	var params struct {
+		Channel string `json:"channel"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	authErr := s.authErr
+	var rpcErr map[string]any
+	switch req.Method {
+	case "auth":
+		if authErr != "" {
+			rpcErr = map[string]any{"code": -32000, "message": authErr}
+		} else {
+			c.authenticated = true
+		}
+	case "subscribe":
+		c.subscriptions[params.Channel] = struct{}{}
+	case "unsubscribe":
+		delete(c.subscriptions, params.Channel)
+	default:
+		rpcErr = map[string]any{"code": -32601, "message": "Method not found"}
+	}
+	s.notifyLocked()
+	s.mu.Unlock()
+
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = true
+	}
+	_ = c.write(resp)
+}
+
+// write sends a JSON message to the client
+func (c *conn) write(v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return wsjson.Write(ctx, c.ws, v)
+}
+
+// subscribedLocked reports whether any client subscribes to the channel.
+// s.mu must be held.
+func (s *Server) subscribedLocked(channel string) bool {
+	for c := range s.conns {
+		if _, ok := c.subscriptions[channel]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyLocked wakes up waiters. s.mu must be held.
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait blocks until cond, evaluated under s.mu, holds or ctx is done
+func (s *Server) wait(ctx context.Context, cond func() bool) error {
+	for {
+		s.mu.Lock()
+		ok := cond()
+		changed := s.changed
+		s.mu.Unlock()
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package wstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+func TestServer_PublishToSubscribers(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := websocket.NewClient(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close(ctx)
+
+	received := make(chan websocket.TickerMessage, 1)
+	client.OnTicker(func(m websocket.TickerMessage) {
+		received <- m
+	})
+
+	if err := client.SubscribeTicker(ctx, "BTC_JPY"); err != nil {
+		t.Fatalf("Subscribe error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, websocket.TickerChannel("BTC_JPY")); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	n, err := srv.Publish(websocket.TickerChannel("ETH_JPY"), map[string]any{"product_code": "ETH_JPY"})
+	if err != nil || n != 0 {
+		t.Errorf("Expected no subscribers for ETH_JPY, got %d, %v", n, err)
+	}
+	n, err = srv.Publish(websocket.TickerChannel("BTC_JPY"), map[string]any{"product_code": "BTC_JPY", "ltp": 3000000})
+	if err != nil || n != 1 {
+		t.Fatalf("Publish() = %d, %v", n, err)
+	}
+
+	select {
+	case m := <-received:
+		if m.ProductCode != "BTC_JPY" || m.Ltp != 3000000 {
+			t.Errorf("Unexpected ticker: %+v", m)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the ticker")
+	}
+}
+
+func TestServer_RequestsAndDisconnect(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := websocket.NewClient(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close(ctx)
+
+	if err := client.Auth(ctx, "key", "secret"); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	if err := client.Subscribe(ctx, websocket.ChildOrderEventsChannel); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := srv.WaitSubscribed(ctx, websocket.ChildOrderEventsChannel); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+
+	if !srv.Authenticated() {
+		t.Error("Expected the client to be authenticated")
+	}
+	requests := srv.Requests()
+	if len(requests) != 2 || requests[0].Method != "auth" || requests[1].Method != "subscribe" {
+		t.Errorf("Unexpected requests: %+v", requests)
+	}
+
+	srv.DisconnectAll()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Connections() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if srv.Connections() != 0 {
+		t.Error("Expected every client to be disconnected")
+	}
+	if srv.Subscribed(websocket.ChildOrderEventsChannel) {
+		t.Error("Expected subscriptions to be dropped with the connection")
+	}
+}
@@ -0,0 +1,106 @@
+package withdrawal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// Confirmer approves a withdrawal before it is sent. It returns the
+// two-factor code to send with the withdrawal, empty for none, or an error
+// to refuse the withdrawal.
+type Confirmer interface {
+	Confirm(ctx context.Context, req Request, account http.BankAccount) (code string, err error)
+}
+
+// ConfirmFunc adapts a function to a Confirmer, for example one that asks an
+// operator
+type ConfirmFunc func(ctx context.Context, req Request, account http.BankAccount) (string, error)
+
+// Confirm calls f
+func (f ConfirmFunc) Confirm(ctx context.Context, req Request, account http.BankAccount) (string, error) {
+	return f(ctx, req, account)
+}
+
+// All requires every confirmer to approve, in order. The code is the last
+// one that is not empty.
+func All(confirmers ...Confirmer) Confirmer {
+	return ConfirmFunc(func(ctx context.Context, req Request, account http.BankAccount) (string, error) {
+		var code string
+		for _, c := range confirmers {
+			c, err := c.Confirm(ctx, req, account)
+			if err != nil {
+				return "", err
+			}
+			if c != "" {
+				code = c
+			}
+		}
+		return code, nil
+	})
+}
+
+// CodeSource provides the two-factor code sent with a withdrawal. It does
+// not approve anything, so it is combined with an approver by WithCode.
+type CodeSource interface {
+	Code(ctx context.Context) (string, error)
+}
+
+// WithCode returns a confirmer that asks the approver and, once it approved,
+// sends the code of the source with the withdrawal. The code of the approver,
+// if any, is replaced.
+func WithCode(approver Confirmer, source CodeSource) Confirmer {
+	return ConfirmFunc(func(ctx context.Context, req Request, account http.BankAccount) (string, error) {
+		if approver == nil {
+			return "", fmt.Errorf("no approver")
+		}
+		if _, err := approver.Confirm(ctx, req, account); err != nil {
+			return "", err
+		}
+		return source.Code(ctx)
+	})
+}
+
+// totp generates time-based one-time passwords (RFC 6238) with SHA-1,
+// 30 second steps and 6 digits, as authenticator apps do
+type totp struct {
+	key []byte
+	now func() time.Time
+}
+
+// TOTP returns the one-time passwords of the base32 secret registered for
+// two-factor authentication. Anyone holding the secret can produce them, so
+// they are no confirmation by themselves.
+func TOTP(secret string) (CodeSource, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	return &totp{key: key, now: time.Now}, nil
+}
+
+// Code returns the current code
+func (t *totp) Code(ctx context.Context) (string, error) {
+	return t.code(t.now()), nil
+}
+
+// code returns the code of the 30 second step containing now
+func (t *totp) code(now time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/30))
+	mac := hmac.New(sha1.New, t.key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", n%1_000_000)
+}
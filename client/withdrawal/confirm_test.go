@@ -0,0 +1,92 @@
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 test vectors for SHA-1, truncated to 6 digits
+	source, err := TOTP("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") // "12345678901234567890"
+	if err != nil {
+		t.Fatalf("TOTP() error = %v", err)
+	}
+	totp := source.(*totp)
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totp.code(time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	totp.now = func() time.Time { return time.Unix(59, 0) }
+	if code, err := source.Code(context.Background()); err != nil || code != "287082" {
+		t.Errorf("Code() = %s, %v", code, err)
+	}
+
+	if _, err := TOTP("not base32!"); err == nil {
+		t.Error("Expected an invalid secret to fail")
+	}
+}
+
+func TestAll(t *testing.T) {
+	var asked []string
+	step := func(name, code string, err error) Confirmer {
+		return ConfirmFunc(func(ctx context.Context, req Request, account bfhttp.BankAccount) (string, error) {
+			asked = append(asked, name)
+			return code, err
+		})
+	}
+	ctx := context.Background()
+
+	code, err := All(step("operator", "", nil), step("totp", "123456", nil)).Confirm(ctx, Request{}, bfhttp.BankAccount{})
+	if err != nil || code != "123456" {
+		t.Errorf("Confirm() = %s, %v", code, err)
+	}
+
+	asked = nil
+	_, err = All(step("operator", "", errors.New("declined")), step("totp", "123456", nil)).Confirm(ctx, Request{}, bfhttp.BankAccount{})
+	if err == nil || len(asked) != 1 {
+		t.Errorf("Expected a refusal to stop the confirmation, asked %v, got %v", asked, err)
+	}
+}
+
+// fixedCode is a CodeSource returning the same code
+type fixedCode string
+
+func (c fixedCode) Code(ctx context.Context) (string, error) {
+	return string(c), nil
+}
+
+func TestWithCode(t *testing.T) {
+	ctx := context.Background()
+	approve := ConfirmFunc(func(ctx context.Context, req Request, account bfhttp.BankAccount) (string, error) {
+		return "", nil
+	})
+	refuse := ConfirmFunc(func(ctx context.Context, req Request, account bfhttp.BankAccount) (string, error) {
+		return "", errors.New("declined")
+	})
+
+	if code, err := WithCode(approve, fixedCode("123456")).Confirm(ctx, Request{}, bfhttp.BankAccount{}); err != nil || code != "123456" {
+		t.Errorf("Confirm() = %s, %v", code, err)
+	}
+	if _, err := WithCode(refuse, fixedCode("123456")).Confirm(ctx, Request{}, bfhttp.BankAccount{}); err == nil {
+		t.Error("Expected a refusal to withhold the code")
+	}
+	if _, err := WithCode(nil, fixedCode("123456")).Confirm(ctx, Request{}, bfhttp.BankAccount{}); err == nil {
+		t.Error("Expected a missing approver to refuse")
+	}
+}
@@ -0,0 +1,430 @@
+// Package withdrawal guards fiat withdrawals: the destination must be an
+// allowed, verified bank account, the amount must stay within the caps, and
+// every withdrawal must pass a confirmation step before it is sent.
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+	// historyPageSize is the page size used to sum the withdrawals of the day
+	historyPageSize = 100
+)
+
+var (
+	// ErrNotAllowed is returned for a bank account that is not allowed,
+	// not registered or not verified
+	ErrNotAllowed = errors.New("bank account not allowed")
+	// ErrLimitExceeded is returned when a withdrawal exceeds a cap
+	ErrLimitExceeded = errors.New("withdrawal limit exceeded")
+	// ErrNotConfirmed is returned when the confirmation step refused the
+	// withdrawal
+	ErrNotConfirmed = errors.New("withdrawal not confirmed")
+)
+
+// jst is the time zone of the bitFlyer business day
+var jst = time.FixedZone("JST", 9*60*60)
+
+// Request is a JPY withdrawal
+type Request struct {
+	BankAccountID int
+	Amount        float64 // whole yen
+}
+
+// Receipt is an accepted withdrawal
+type Receipt struct {
+	MessageID     string
+	BankAccountID int
+	Amount        float64
+	Time          time.Time
+}
+
+// Status values of a withdrawal
+const (
+	StatusPending   = "PENDING"
+	StatusCompleted = "COMPLETED"
+)
+
+// Withdrawal is the state of a withdrawal reported by the API
+type Withdrawal struct {
+	ID           int
+	OrderID      string
+	CurrencyCode string
+	Amount       float64
+	Status       string
+	Time         time.Time
+}
+
+// Guard sends withdrawals that passed every check
+type Guard struct {
+	api          *http.ClientWithResponses
+	confirmer    Confirmer
+	allowed      map[int]bool
+	maxAmount    float64
+	dailyLimit   float64
+	location     *time.Location
+	pollInterval time.Duration
+
+	mu       sync.Mutex
+	sent     []*sentWithdrawal // withdrawals sent by this guard, for the daily limit
+	reserved float64           // amount of the withdrawals in progress
+}
+
+// sentWithdrawal is a withdrawal sent by the guard
+type sentWithdrawal struct {
+	Receipt
+	listed bool // found in the withdrawals of the API
+}
+
+// Option configures a Guard
+type Option func(*Guard)
+
+// WithMaxAmount caps the amount of a single withdrawal
+func WithMaxAmount(amount float64) Option {
+	return func(g *Guard) {
+		g.maxAmount = amount
+	}
+}
+
+// WithDailyLimit caps the total withdrawn per day. Withdrawals listed by the
+// API count whatever their status, including those made elsewhere.
+func WithDailyLimit(amount float64) Option {
+	return func(g *Guard) {
+		g.dailyLimit = amount
+	}
+}
+
+// WithDayLocation sets the time zone of the day of the daily limit, JST by
+// default
+func WithDayLocation(loc *time.Location) Option {
+	return func(g *Guard) {
+		g.location = loc
+	}
+}
+
+// WithPollInterval sets how often Wait checks the status, 10 seconds by
+// default
+func WithPollInterval(d time.Duration) Option {
+	return func(g *Guard) {
+		g.pollInterval = d
+	}
+}
+
+// NewGuard creates a guard that only withdraws to the bank accounts of
+// allowedAccountIDs, after confirmer approved
+func NewGuard(ac *http.AuthenticatedClient, confirmer Confirmer, allowedAccountIDs []int, opts ...Option) *Guard {
+	g := &Guard{
+		api:          ac.Client(),
+		confirmer:    confirmer,
+		allowed:      make(map[int]bool, len(allowedAccountIDs)),
+		location:     jst,
+		pollInterval: defaultPollInterval,
+	}
+	for _, id := range allowedAccountIDs {
+		g.allowed[id] = true
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Withdraw checks the request, asks for confirmation and sends it. The bank
+// account must be allowed, registered and verified, and the amount must be
+// within the caps. A withdrawal whose outcome is unknown, as on a timeout,
+// still counts toward the daily limit.
+func (g *Guard) Withdraw(ctx context.Context, req Request) (Receipt, error) {
+	if req.Amount <= 0 || req.Amount != math.Trunc(req.Amount) {
+		return Receipt{}, fmt.Errorf("invalid withdrawal: amount must be a positive whole yen amount")
+	}
+	if float64(float32(req.Amount)) != req.Amount {
+		// The API takes the amount as a 32-bit float
+		return Receipt{}, fmt.Errorf("invalid withdrawal: amount %v cannot be sent exactly", req.Amount)
+	}
+	if !g.allowed[req.BankAccountID] {
+		return Receipt{}, fmt.Errorf("%w: %d is not in the allow-list", ErrNotAllowed, req.BankAccountID)
+	}
+	if g.maxAmount > 0 && req.Amount > g.maxAmount {
+		return Receipt{}, fmt.Errorf("%w: %v is above the cap of %v", ErrLimitExceeded, req.Amount, g.maxAmount)
+	}
+
+	account, err := g.bankAccount(ctx, req.BankAccountID)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if err := g.reserve(ctx, req.Amount); err != nil {
+		return Receipt{}, err
+	}
+	sent := false
+	defer func() {
+		if !sent {
+			g.release(req.Amount)
+		}
+	}()
+
+	code, err := g.confirmer.Confirm(ctx, req, account)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("%w: %w", ErrNotConfirmed, err)
+	}
+
+	body := http.WithdrawRequest{
+		Amount:        float32(req.Amount),
+		BankAccountId: req.BankAccountID,
+		CurrencyCode:  "JPY",
+	}
+	if code != "" {
+		body.Code = &code
+	}
+	receipt := Receipt{BankAccountID: req.BankAccountID, Amount: req.Amount, Time: time.Now()}
+	resp, err := g.api.PostV1MeWithdrawWithResponse(ctx, body)
+	if err == nil {
+		err = http.CheckResponse(resp.StatusCode(), resp.Body)
+	}
+	var apiErr *http.APIError
+	if err != nil && errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+		return Receipt{}, fmt.Errorf("failed to withdraw: %w", err)
+	}
+	// Anything but a rejection may have moved the funds
+	sent = true
+	if err == nil && (resp.JSON200 == nil || resp.JSON200.MessageId == nil) {
+		err = errors.New("message id is missing")
+	}
+	if err == nil {
+		receipt.MessageID = *resp.JSON200.MessageId
+	}
+	g.record(receipt)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("failed to withdraw: %w", err)
+	}
+	return receipt, nil
+}
+
+// Status returns the state of a withdrawal by the message ID of its receipt
+func (g *Guard) Status(ctx context.Context, messageID string) (Withdrawal, error) {
+	w, found, err := g.lookup(ctx, messageID)
+	if err != nil {
+		return Withdrawal{}, err
+	}
+	if !found {
+		return Withdrawal{}, fmt.Errorf("failed to get withdrawal: %s not found", messageID)
+	}
+	return w, nil
+}
+
+// lookup returns a withdrawal by message ID, reporting whether the API
+// lists it
+func (g *Guard) lookup(ctx context.Context, messageID string) (Withdrawal, bool, error) {
+	resp, err := g.api.GetV1MeGetwithdrawalsWithResponse(ctx, &http.GetV1MeGetwithdrawalsParams{MessageId: &messageID})
+	if err != nil {
+		return Withdrawal{}, false, fmt.Errorf("failed to get withdrawal: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return Withdrawal{}, false, fmt.Errorf("failed to get withdrawal: %w", err)
+	}
+	if resp.JSON200 == nil || len(*resp.JSON200) == 0 {
+		return Withdrawal{}, false, nil
+	}
+	return toWithdrawal((*resp.JSON200)[0]), true, nil
+}
+
+// Wait polls the status of a withdrawal until it is no longer pending
+func (g *Guard) Wait(ctx context.Context, messageID string) (Withdrawal, error) {
+	ticker := time.NewTicker(g.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		w, err := g.Status(ctx, messageID)
+		if err != nil {
+			return Withdrawal{}, err
+		}
+		if w.Status != StatusPending {
+			return w, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return w, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// bankAccount returns a registered and verified bank account
+func (g *Guard) bankAccount(ctx context.Context, id int) (http.BankAccount, error) {
+	resp, err := g.api.GetV1MeGetbankaccountsWithResponse(ctx)
+	if err != nil {
+		return http.BankAccount{}, fmt.Errorf("failed to get bank accounts: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return http.BankAccount{}, fmt.Errorf("failed to get bank accounts: %w", err)
+	}
+	if resp.JSON200 != nil {
+		for _, account := range *resp.JSON200 {
+			if account.Id == nil || *account.Id != id {
+				continue
+			}
+			if account.IsVerified == nil || !*account.IsVerified {
+				return http.BankAccount{}, fmt.Errorf("%w: %d is not verified", ErrNotAllowed, id)
+			}
+			return account, nil
+		}
+	}
+	return http.BankAccount{}, fmt.Errorf("%w: %d is not registered", ErrNotAllowed, id)
+}
+
+// reserve counts the amount toward the daily limit, failing if the limit
+// would be exceeded. The day counts the withdrawals listed by the API, the
+// withdrawals sent by this guard that are not listed yet, and those in
+// progress. A withdrawal sent while the API is queried may be missing from
+// the listing, so it counts as not listed.
+func (g *Guard) reserve(ctx context.Context, amount float64) error {
+	if g.dailyLimit <= 0 {
+		return nil
+	}
+	now := time.Now().In(g.location)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, g.location)
+
+	g.mu.Lock()
+	known := make(map[*sentWithdrawal]bool, len(g.sent))
+	var recent []*sentWithdrawal
+	for _, w := range g.sent {
+		known[w] = true
+		if !w.listed && !w.Time.Before(dayStart) {
+			recent = append(recent, w)
+		}
+	}
+	g.mu.Unlock()
+
+	// Looked up before listing, so that a withdrawal is counted even if it
+	// shows up in between
+	var unlisted float64
+	for _, w := range recent {
+		if w.MessageID != "" {
+			_, found, err := g.lookup(ctx, w.MessageID)
+			if err != nil {
+				return err
+			}
+			if found {
+				g.mu.Lock()
+				w.listed = true
+				g.mu.Unlock()
+				continue
+			}
+		}
+		// Without a message ID the outcome is unknown, so it counts
+		unlisted += w.Amount
+	}
+	listed, err := g.withdrawnSince(ctx, dayStart)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, w := range g.sent {
+		if !known[w] && !w.Time.Before(dayStart) {
+			// Sent by a concurrent withdrawal since the lookups
+			unlisted += w.Amount
+		}
+	}
+	used := listed + unlisted + g.reserved
+	if used+amount > g.dailyLimit {
+		return fmt.Errorf("%w: %v withdrawn today, %v requested, daily limit %v", ErrLimitExceeded, used, amount, g.dailyLimit)
+	}
+	g.reserved += amount
+	return nil
+}
+
+// release gives back a reservation
+func (g *Guard) release(amount float64) {
+	if g.dailyLimit <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reserved -= amount
+}
+
+// record turns the reservation of a sent withdrawal into history
+func (g *Guard) record(receipt Receipt) {
+	g.release(receipt.Amount)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sent = slices.DeleteFunc(g.sent, func(w *sentWithdrawal) bool {
+		return receipt.Time.Sub(w.Time) > 48*time.Hour
+	})
+	g.sent = append(g.sent, &sentWithdrawal{Receipt: receipt})
+}
+
+// withdrawnSince sums the JPY withdrawals listed by the API since t
+func (g *Guard) withdrawnSince(ctx context.Context, t time.Time) (float64, error) {
+	count := historyPageSize
+	params := &http.GetV1MeGetwithdrawalsParams{Count: &count}
+	var total float64
+	for {
+		resp, err := g.api.GetV1MeGetwithdrawalsWithResponse(ctx, params)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get withdrawals: %w", err)
+		}
+		if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+			return 0, fmt.Errorf("failed to get withdrawals: %w", err)
+		}
+		if resp.JSON200 == nil || len(*resp.JSON200) == 0 {
+			return total, nil
+		}
+
+		page := *resp.JSON200
+		for _, w := range page {
+			if w.EventDate != nil && w.EventDate.Before(t) {
+				return total, nil
+			}
+			if w.CurrencyCode == nil || *w.CurrencyCode == "JPY" {
+				total += value(w.Amount)
+			}
+		}
+		last := page[len(page)-1]
+		if len(page) < historyPageSize || last.Id == nil {
+			return total, nil
+		}
+		before := *last.Id
+		params.Before = &before
+	}
+}
+
+func toWithdrawal(w http.Withdrawal) Withdrawal {
+	out := Withdrawal{Amount: value(w.Amount)}
+	if w.Id != nil {
+		out.ID = *w.Id
+	}
+	if w.OrderId != nil {
+		out.OrderID = *w.OrderId
+	}
+	if w.CurrencyCode != nil {
+		out.CurrencyCode = *w.CurrencyCode
+	}
+	if w.Status != nil {
+		out.Status = *w.Status
+	}
+	if w.EventDate != nil {
+		out.Time = *w.EventDate
+	}
+	return out
+}
+
+// value converts an amount from the API, rounding away float32 noise
+func value(v *float32) float64 {
+	if v == nil {
+		return 0
+	}
+	return math.Round(float64(*v)*100) / 100
+}
@@ -0,0 +1,299 @@
+package withdrawal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/http/resttest"
+)
+
+// bankServer stubs the bank account and withdrawal endpoints
+type bankServer struct {
+	t    *testing.T
+	hook func(r *http.Request) // called before every request is served
+
+	mu             sync.Mutex
+	history        []string            // withdrawals listed without a message ID, newest first
+	statuses       map[string][]string // statuses returned in turn by message ID; the last one repeats
+	withdrawStatus int                 // HTTP status of withdraw, 200 by default
+	withdrawals    []bfhttp.WithdrawRequest
+}
+
+func (s *bankServer) handle(w http.ResponseWriter, r *http.Request) {
+	if s.hook != nil {
+		s.hook(r)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/v1/me/getbankaccounts":
+		_, _ = w.Write([]byte(`[{"id":1,"is_verified":true,"bank_name":"Bank"},{"id":2,"is_verified":false}]`))
+	case "/v1/me/getwithdrawals":
+		messageID := r.URL.Query().Get("message_id")
+		if messageID == "" {
+			_, _ = w.Write([]byte("[" + strings.Join(s.history, ",") + "]"))
+			return
+		}
+		statuses, ok := s.statuses[messageID]
+		if !ok {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		if len(statuses) > 1 {
+			s.statuses[messageID] = statuses[1:]
+		}
+		_, _ = fmt.Fprintf(w, `[{"id":99,"order_id":"MDP20240101-000000-000000","currency_code":"JPY","amount":30000,"status":%q,"event_date":%q}]`,
+			statuses[0], time.Now().Format(time.RFC3339))
+	case "/v1/me/withdraw":
+		var req bfhttp.WithdrawRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.t.Errorf("Failed to decode request: %v", err)
+		}
+		s.withdrawals = append(s.withdrawals, req)
+		if s.withdrawStatus != 0 {
+			w.WriteHeader(s.withdrawStatus)
+			_, _ = w.Write([]byte(`{"status":-700,"error_message":"error","data":null}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"message_id":"MSG-%d"}`, len(s.withdrawals))
+	default:
+		s.t.Errorf("Unexpected request %s", r.URL.Path)
+	}
+}
+
+func (s *bankServer) sent() []bfhttp.WithdrawRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bfhttp.WithdrawRequest(nil), s.withdrawals...)
+}
+
+func listedWithdrawal(id int, amount float64, date time.Time) string {
+	return fmt.Sprintf(`{"id":%d,"currency_code":"JPY","amount":%v,"status":"COMPLETED","event_date":%q}`, id, amount, date.Format(time.RFC3339))
+}
+
+func newTestGuard(t *testing.T, s *bankServer, confirmer Confirmer, opts ...Option) *Guard {
+	t.Helper()
+	s.t = t
+	if s.statuses == nil {
+		s.statuses = make(map[string][]string)
+	}
+	return NewGuard(resttest.NewClient(t, http.HandlerFunc(s.handle)), confirmer, []int{1, 2, 3}, opts...)
+}
+
+// approve approves every withdrawal with the code and counts the calls
+type approve struct {
+	code  string
+	calls int
+}
+
+func (a *approve) Confirm(ctx context.Context, req Request, account bfhttp.BankAccount) (string, error) {
+	a.calls++
+	return a.code, nil
+}
+
+func TestWithdraw(t *testing.T) {
+	server := &bankServer{}
+	confirmer := &approve{code: "123456"}
+	guard := newTestGuard(t, server, confirmer)
+
+	receipt, err := guard.Withdraw(context.Background(), Request{BankAccountID: 1, Amount: 30000})
+	if err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	if receipt.MessageID != "MSG-1" || receipt.Amount != 30000 || receipt.BankAccountID != 1 {
+		t.Errorf("Unexpected receipt %+v", receipt)
+	}
+	sent := server.sent()
+	if len(sent) != 1 || sent[0].Amount != 30000 || sent[0].BankAccountId != 1 || sent[0].CurrencyCode != "JPY" ||
+		sent[0].Code == nil || *sent[0].Code != "123456" {
+		t.Errorf("Unexpected withdraw request %+v", sent)
+	}
+	if confirmer.calls != 1 {
+		t.Errorf("Expected one confirmation, got %d", confirmer.calls)
+	}
+}
+
+func TestWithdraw_Refused(t *testing.T) {
+	refuse := ConfirmFunc(func(ctx context.Context, req Request, account bfhttp.BankAccount) (string, error) {
+		return "", errors.New("operator declined")
+	})
+
+	tests := []struct {
+		name      string
+		req       Request
+		confirmer Confirmer
+		opts      []Option
+		errIs     error
+	}{
+		{"not allowed", Request{BankAccountID: 4, Amount: 1000}, nil, nil, ErrNotAllowed},
+		{"not verified", Request{BankAccountID: 2, Amount: 1000}, nil, nil, ErrNotAllowed},
+		{"not registered", Request{BankAccountID: 3, Amount: 1000}, nil, nil, ErrNotAllowed},
+		{"above the cap", Request{BankAccountID: 1, Amount: 50001}, nil, []Option{WithMaxAmount(50000)}, ErrLimitExceeded},
+		{"not confirmed", Request{BankAccountID: 1, Amount: 1000}, refuse, nil, ErrNotConfirmed},
+		{"fractional", Request{BankAccountID: 1, Amount: 1000.5}, nil, nil, nil},
+		{"not exact in float32", Request{BankAccountID: 1, Amount: 100000001}, nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &bankServer{}
+			confirmer := tt.confirmer
+			if confirmer == nil {
+				confirmer = &approve{}
+			}
+			guard := newTestGuard(t, server, confirmer, tt.opts...)
+
+			_, err := guard.Withdraw(context.Background(), tt.req)
+			if err == nil {
+				t.Fatal("Expected the withdrawal to be refused")
+			}
+			if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+				t.Errorf("Expected %v, got %v", tt.errIs, err)
+			}
+			if a, ok := confirmer.(*approve); ok && a.calls != 0 {
+				t.Error("Expected no confirmation to be asked")
+			}
+			if sent := server.sent(); len(sent) != 0 {
+				t.Errorf("Expected nothing to be withdrawn, got %+v", sent)
+			}
+		})
+	}
+}
+
+func TestWithdraw_DailyLimit(t *testing.T) {
+	now := time.Now()
+	dayStart := time.Date(now.In(jst).Year(), now.In(jst).Month(), now.In(jst).Day(), 0, 0, 0, 0, jst)
+	server := &bankServer{history: []string{
+		listedWithdrawal(3, 40000, now),
+		listedWithdrawal(2, 500000, dayStart.Add(-time.Second)), // yesterday
+		listedWithdrawal(1, 500000, dayStart.Add(-time.Hour)),
+	}}
+	guard := newTestGuard(t, server, &approve{}, WithDailyLimit(100000))
+	ctx := context.Background()
+
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000}); err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	// MSG-1 is not listed yet but still counts: 40000 + 30000 + 40000 > 100000
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 40000}); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected ErrLimitExceeded, got %v", err)
+	}
+
+	// Once listed, MSG-1 is counted once
+	server.mu.Lock()
+	server.statuses["MSG-1"] = []string{StatusPending}
+	server.history = append([]string{listedWithdrawal(4, 30000, now)}, server.history...)
+	server.mu.Unlock()
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000}); err != nil {
+		t.Fatalf("Expected 100000 in total to be allowed, got %v", err)
+	}
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 1}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestWithdraw_ConcurrentDailyLimit(t *testing.T) {
+	// The second withdrawal lists the day while the first one is sent, and
+	// the API does not list the first one yet
+	listing, resume := make(chan struct{}), make(chan struct{})
+	var lists atomic.Int32
+	server := &bankServer{hook: func(r *http.Request) {
+		if r.URL.Path == "/v1/me/getwithdrawals" && r.URL.Query().Get("message_id") == "" && lists.Add(1) == 2 {
+			close(listing)
+			<-resume
+		}
+	}}
+	confirming, proceed := make(chan struct{}, 2), make(chan struct{})
+	confirmer := ConfirmFunc(func(ctx context.Context, req Request, account bfhttp.BankAccount) (string, error) {
+		confirming <- struct{}{}
+		<-proceed
+		return "", nil
+	})
+	guard := newTestGuard(t, server, confirmer, WithDailyLimit(50000))
+	ctx := context.Background()
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000})
+		first <- err
+	}()
+	<-confirming
+	second := make(chan error, 1)
+	go func() {
+		_, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000})
+		second <- err
+	}()
+	<-listing
+
+	close(proceed)
+	if err := <-first; err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	close(resume)
+	if err := <-second; !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, got %v", err)
+	}
+	if sent := server.sent(); len(sent) != 1 {
+		t.Errorf("Expected a single withdrawal, got %+v", sent)
+	}
+}
+
+func TestWithdraw_UnknownOutcome(t *testing.T) {
+	server := &bankServer{withdrawStatus: http.StatusBadGateway}
+	guard := newTestGuard(t, server, &approve{}, WithDailyLimit(50000))
+	ctx := context.Background()
+
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000}); err == nil {
+		t.Fatal("Expected an error")
+	}
+	// The failed withdrawal may have gone through, so it counts
+	server.mu.Lock()
+	server.withdrawStatus = 0
+	server.mu.Unlock()
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, got %v", err)
+	}
+
+	// A rejected withdrawal does not count
+	server = &bankServer{withdrawStatus: http.StatusBadRequest}
+	guard = newTestGuard(t, server, &approve{}, WithDailyLimit(50000))
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000}); err == nil {
+		t.Fatal("Expected an error")
+	}
+	server.mu.Lock()
+	server.withdrawStatus = 0
+	server.mu.Unlock()
+	if _, err := guard.Withdraw(ctx, Request{BankAccountID: 1, Amount: 30000}); err != nil {
+		t.Errorf("Withdraw() error = %v", err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	server := &bankServer{statuses: map[string][]string{"MSG-1": {StatusPending, StatusPending, StatusCompleted}}}
+	guard := newTestGuard(t, server, &approve{}, WithPollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w, err := guard.Wait(ctx, "MSG-1")
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if w.Status != StatusCompleted || w.Amount != 30000 || w.ID != 99 {
+		t.Errorf("Unexpected withdrawal %+v", w)
+	}
+
+	if _, err := guard.Status(ctx, "MSG-UNKNOWN"); err == nil {
+		t.Error("Expected an unknown message ID to fail")
+	}
+}
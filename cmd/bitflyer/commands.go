@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+)
+
+// parseFlags parses the subcommand flags and rejects stray arguments
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected arguments: %s", fs.Name(), strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// requireProduct returns an error when -product was not given
+func requireProduct(fs *flag.FlagSet, productCode string) error {
+	if productCode == "" {
+		return fmt.Errorf("%s: -product is required", fs.Name())
+	}
+	return nil
+}
+
+// countParam returns the count query parameter, nil for the API default
+func countParam(count int) *http.Count {
+	if count <= 0 {
+		return nil
+	}
+	return &count
+}
+
+// ticker, board and execution mirror the REST types with float64 numbers.
+// The generated float32 fields cannot hold prices above 2^24 exactly, so
+// the response bodies are decoded again into these.
+type ticker struct {
+	BestAsk         *float64   `json:"best_ask,omitempty"`
+	BestAskSize     *float64   `json:"best_ask_size,omitempty"`
+	BestBid         *float64   `json:"best_bid,omitempty"`
+	BestBidSize     *float64   `json:"best_bid_size,omitempty"`
+	Ltp             *float64   `json:"ltp,omitempty"`
+	MarketAskSize   *float64   `json:"market_ask_size,omitempty"`
+	MarketBidSize   *float64   `json:"market_bid_size,omitempty"`
+	ProductCode     *string    `json:"product_code,omitempty"`
+	State           *string    `json:"state,omitempty"`
+	TickId          *int       `json:"tick_id,omitempty"`
+	Timestamp       *time.Time `json:"timestamp,omitempty"`
+	TotalAskDepth   *float64   `json:"total_ask_depth,omitempty"`
+	TotalBidDepth   *float64   `json:"total_bid_depth,omitempty"`
+	Volume          *float64   `json:"volume,omitempty"`
+	VolumeByProduct *float64   `json:"volume_by_product,omitempty"`
+}
+
+type board struct {
+	Asks     []boardEntry `json:"asks"`
+	Bids     []boardEntry `json:"bids"`
+	MidPrice *float64     `json:"mid_price,omitempty"`
+}
+
+type boardEntry struct {
+	Price float64 `json:"price"`
+	Size  float64 `json:"size"`
+}
+
+type execution struct {
+	ChildOrderAcceptanceId *string    `json:"child_order_acceptance_id,omitempty"`
+	ChildOrderId           *string    `json:"child_order_id,omitempty"`
+	Commission             *float64   `json:"commission,omitempty"`
+	ExecDate               *time.Time `json:"exec_date,omitempty"`
+	Id                     *int       `json:"id,omitempty"`
+	Price                  *float64   `json:"price,omitempty"`
+	Side                   *string    `json:"side,omitempty"`
+	Size                   *float64   `json:"size,omitempty"`
+}
+
+// decodeBody decodes a response body checked by http.CheckResponse
+func decodeBody(body []byte, v any, what string) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", what, err)
+	}
+	return nil
+}
+
+func runMarkets(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("markets")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ac, err := c.client(false)
+	if err != nil {
+		return err
+	}
+	markets, err := ac.GetMarkets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get markets: %w", err)
+	}
+	return c.output(markets)
+}
+
+func runTicker(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("ticker")
+	productCode := fs.String("product", "", "product code")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+
+	ac, err := c.client(false)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1GettickerWithResponse(ctx, &http.GetV1GettickerParams{ProductCode: *productCode})
+	if err != nil {
+		return fmt.Errorf("failed to get ticker: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get ticker: %w", err)
+	}
+	var t ticker
+	if err := decodeBody(resp.Body, &t, "ticker"); err != nil {
+		return err
+	}
+	return c.output(t)
+}
+
+// boardRow is one price level of the order book in table and CSV output
+type boardRow struct {
+	Side  string  `json:"side"`
+	Price float64 `json:"price"`
+	Size  float64 `json:"size"`
+}
+
+func runBoard(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("board")
+	productCode := fs.String("product", "", "product code")
+	depth := fs.Int("depth", 10, "price levels per side, 0 for all")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+
+	ac, err := c.client(false)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1GetboardWithResponse(ctx, &http.GetV1GetboardParams{ProductCode: *productCode})
+	if err != nil {
+		return fmt.Errorf("failed to get board: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get board: %w", err)
+	}
+
+	var b board
+	if err := decodeBody(resp.Body, &b, "board"); err != nil {
+		return err
+	}
+	b.Asks = truncateLevels(b.Asks, *depth)
+	b.Bids = truncateLevels(b.Bids, *depth)
+	asks, bids := b.Asks, b.Bids
+
+	if c.format == formatJSON {
+		return c.output(b)
+	}
+
+	// Print a ladder: asks from the highest price down, then bids
+	rows := make([]boardRow, 0, len(asks)+len(bids))
+	for i := len(asks) - 1; i >= 0; i-- {
+		rows = append(rows, boardRow{Side: "ASK", Price: asks[i].Price, Size: asks[i].Size})
+	}
+	for _, bid := range bids {
+		rows = append(rows, boardRow{Side: "BID", Price: bid.Price, Size: bid.Size})
+	}
+	return c.output(rows)
+}
+
+// truncateLevels returns at most depth levels, all of them when depth is zero
+func truncateLevels(levels []boardEntry, depth int) []boardEntry {
+	if levels == nil {
+		return []boardEntry{}
+	}
+	if depth > 0 && len(levels) > depth {
+		return levels[:depth]
+	}
+	return levels
+}
+
+func runExecutions(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("executions")
+	productCode := fs.String("product", "", "product code")
+	count := fs.Int("count", 0, "number of executions, 0 for the API default")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+
+	ac, err := c.client(false)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1GetexecutionsWithResponse(ctx, &http.GetV1GetexecutionsParams{
+		ProductCode: *productCode,
+		Count:       countParam(*count),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get executions: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get executions: %w", err)
+	}
+	var executions []execution
+	if err := decodeBody(resp.Body, &executions, "executions"); err != nil {
+		return err
+	}
+	return c.output(executions)
+}
+
+func runBalance(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("balance")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1MeGetbalanceWithResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get balance: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get balance: %w", err)
+	}
+	return c.output(resp.JSON200)
+}
+
+func runCollateral(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("collateral")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1MeGetcollateralWithResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get collateral: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get collateral: %w", err)
+	}
+	return c.output(resp.JSON200)
+}
+
+func runPositions(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("positions")
+	productCode := fs.String("product", "FX_BTC_JPY", "product code")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1MeGetpositionsWithResponse(ctx, &http.GetV1MeGetpositionsParams{ProductCode: *productCode})
+	if err != nil {
+		return fmt.Errorf("failed to get positions: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get positions: %w", err)
+	}
+	return c.output(resp.JSON200)
+}
+
+func runOrders(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("orders: subcommand required: list, send, cancel or cancel-all")
+	}
+	switch args[0] {
+	case "list":
+		return runOrdersList(ctx, c, args[1:])
+	case "send":
+		return runOrdersSend(ctx, c, args[1:])
+	case "cancel":
+		return runOrdersCancel(ctx, c, args[1:])
+	case "cancel-all":
+		return runOrdersCancelAll(ctx, c, args[1:])
+	default:
+		return fmt.Errorf("orders: unknown subcommand %q", args[0])
+	}
+}
+
+func runOrdersList(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("orders list")
+	productCode := fs.String("product", "", "product code")
+	state := fs.String("state", "", "ACTIVE, COMPLETED, CANCELED, EXPIRED or REJECTED")
+	count := fs.Int("count", 0, "number of orders, 0 for the API default")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+
+	params := &http.GetV1MeGetchildordersParams{
+		ProductCode: *productCode,
+		Count:       countParam(*count),
+	}
+	if *state != "" {
+		s := http.GetV1MeGetchildordersParamsChildOrderState(strings.ToUpper(*state))
+		params.ChildOrderState = &s
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1MeGetchildordersWithResponse(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to get child orders: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get child orders: %w", err)
+	}
+	return c.output(resp.JSON200)
+}
+
+// orderResult is the output of orders send and orders cancel
+type orderResult struct {
+	ChildOrderAcceptanceID string `json:"child_order_acceptance_id"`
+}
+
+func runOrdersSend(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("orders send")
+	productCode := fs.String("product", "", "product code")
+	side := fs.String("side", "", "BUY or SELL")
+	orderType := fs.String("type", "LIMIT", "LIMIT or MARKET")
+	price := fs.Float64("price", 0, "limit price")
+	size := fs.Float64("size", 0, "order size")
+	timeInForce := fs.String("tif", "", "GTC, IOC or FOK")
+	expire := fs.Int("expire", 0, "minutes to expire, 0 for the API default")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+
+	orderSide := http.NewOrderRequestSide(strings.ToUpper(*side))
+	if orderSide != http.NewOrderRequestSideBUY && orderSide != http.NewOrderRequestSideSELL {
+		return fmt.Errorf("orders send: -side must be BUY or SELL")
+	}
+
+	var req http.NewOrderRequest
+	switch http.NewOrderRequestChildOrderType(strings.ToUpper(*orderType)) {
+	case http.NewOrderRequestChildOrderTypeLIMIT:
+		req = trading.LimitOrder(*productCode, orderSide, *price, *size)
+	case http.NewOrderRequestChildOrderTypeMARKET:
+		req = trading.MarketOrder(*productCode, orderSide, *size)
+	default:
+		return fmt.Errorf("orders send: -type must be LIMIT or MARKET")
+	}
+	if *timeInForce != "" {
+		tif := http.NewOrderRequestTimeInForce(strings.ToUpper(*timeInForce))
+		req.TimeInForce = &tif
+	}
+	if *expire > 0 {
+		req.MinuteToExpire = expire
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	acceptanceID, err := trading.NewClient(ac).SendChildOrder(ctx, req)
+	if err != nil {
+		return err
+	}
+	return c.output(orderResult{ChildOrderAcceptanceID: acceptanceID})
+}
+
+func runOrdersCancel(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("orders cancel")
+	productCode := fs.String("product", "", "product code")
+	acceptanceID := fs.String("id", "", "child order acceptance ID")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+	if *acceptanceID == "" {
+		return fmt.Errorf("orders cancel: -id is required")
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	if err := trading.NewClient(ac).CancelChildOrder(ctx, *productCode, *acceptanceID); err != nil {
+		return err
+	}
+	return c.output(orderResult{ChildOrderAcceptanceID: *acceptanceID})
+}
+
+func runOrdersCancelAll(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("orders cancel-all")
+	productCode := fs.String("product", "", "product code")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	return trading.NewClient(ac).CancelAllChildOrders(ctx, *productCode)
+}
+
+func runParentOrders(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("parent-orders")
+	productCode := fs.String("product", "", "product code")
+	state := fs.String("state", "", "ACTIVE, COMPLETED, CANCELED, EXPIRED or REJECTED")
+	count := fs.Int("count", 0, "number of orders, 0 for the API default")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := requireProduct(fs, *productCode); err != nil {
+		return err
+	}
+
+	params := &http.GetV1MeGetparentordersParams{
+		ProductCode: *productCode,
+		Count:       countParam(*count),
+	}
+	if *state != "" {
+		s := http.GetV1MeGetparentordersParamsParentOrderState(strings.ToUpper(*state))
+		params.ParentOrderState = &s
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	resp, err := ac.Client().GetV1MeGetparentordersWithResponse(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to get parent orders: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get parent orders: %w", err)
+	}
+	return c.output(resp.JSON200)
+}
+
+func runDeposits(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("deposits")
+	coin := fs.Bool("coin", false, "list crypto deposits instead of cash deposits")
+	count := fs.Int("count", 0, "number of records, 0 for the API default")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	if *coin {
+		resp, err := ac.Client().GetV1MeGetcoininsWithResponse(ctx, &http.GetV1MeGetcoininsParams{Count: countParam(*count)})
+		if err != nil {
+			return fmt.Errorf("failed to get coin deposits: %w", err)
+		}
+		if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+			return fmt.Errorf("failed to get coin deposits: %w", err)
+		}
+		return c.output(resp.JSON200)
+	}
+
+	resp, err := ac.Client().GetV1MeGetdepositsWithResponse(ctx, &http.GetV1MeGetdepositsParams{Count: countParam(*count)})
+	if err != nil {
+		return fmt.Errorf("failed to get deposits: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get deposits: %w", err)
+	}
+	return c.output(resp.JSON200)
+}
+
+func runWithdrawals(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("withdrawals")
+	coin := fs.Bool("coin", false, "list crypto withdrawals instead of cash withdrawals")
+	count := fs.Int("count", 0, "number of records, 0 for the API default")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ac, err := c.client(true)
+	if err != nil {
+		return err
+	}
+	if *coin {
+		resp, err := ac.Client().GetV1MeGetcoinoutsWithResponse(ctx, &http.GetV1MeGetcoinoutsParams{Count: countParam(*count)})
+		if err != nil {
+			return fmt.Errorf("failed to get coin withdrawals: %w", err)
+		}
+		if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+			return fmt.Errorf("failed to get coin withdrawals: %w", err)
+		}
+		return c.output(resp.JSON200)
+	}
+
+	resp, err := ac.Client().GetV1MeGetwithdrawalsWithResponse(ctx, &http.GetV1MeGetwithdrawalsParams{Count: countParam(*count)})
+	if err != nil {
+		return fmt.Errorf("failed to get withdrawals: %w", err)
+	}
+	if err := http.CheckResponse(resp.StatusCode(), resp.Body); err != nil {
+		return fmt.Errorf("failed to get withdrawals: %w", err)
+	}
+	return c.output(resp.JSON200)
+}
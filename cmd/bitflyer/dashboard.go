@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/trading"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// ANSI sequences to redraw the screen from the top
+const (
+	ansiHome  = "\x1b[H"
+	ansiClear = "\x1b[2J"
+)
+
+const dashboardHelp = "commands: c N = cancel order N, ca = cancel all, r = refresh, q = quit"
+
+// dashboard holds the live state rendered by the dashboard command
+type dashboard struct {
+	productCode string
+	depth       int
+	tradeCount  int
+
+	// api and trader are nil when running without credentials
+	api           *http.ClientWithResponses
+	trader        *trading.Client
+	showPositions bool
+
+	mu        sync.Mutex
+	ticker    websocket.TickerMessage
+	bids      map[float64]float64 // price -> size
+	asks      map[float64]float64
+	trades    []websocket.Execution // newest first
+	orders    []http.ChildOrder
+	positions []http.Position
+	status    string
+	updatedAt time.Time
+}
+
+// newDashboard creates a dashboard for the product
+func newDashboard(productCode string, depth, tradeCount int) *dashboard {
+	return &dashboard{
+		productCode: productCode,
+		depth:       depth,
+		tradeCount:  tradeCount,
+		bids:        make(map[float64]float64),
+		asks:        make(map[float64]float64),
+		status:      dashboardHelp,
+	}
+}
+
+// authenticate enables open orders, positions and cancel commands
+func (d *dashboard) authenticate(ac *http.AuthenticatedClient) {
+	d.api = ac.Client()
+	d.trader = trading.NewClient(ac)
+	// Positions are only available for Lightning FX products
+	d.showPositions = strings.HasPrefix(d.productCode, "FX_")
+}
+
+func (d *dashboard) handleTicker(m websocket.TickerMessage) {
+	if m.ProductCode != d.productCode {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ticker = m
+	d.updatedAt = time.Now()
+}
+
+func (d *dashboard) handleBoardSnapshot(m websocket.BoardSnapshotMessage) {
+	if m.ProductCode != d.productCode {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.bids = make(map[float64]float64, len(m.Data.Bids))
+	d.asks = make(map[float64]float64, len(m.Data.Asks))
+	applyLevels(d.bids, m.Data.Bids)
+	applyLevels(d.asks, m.Data.Asks)
+	d.updatedAt = time.Now()
+}
+
+func (d *dashboard) handleBoard(m websocket.BoardMessage) {
+	if m.ProductCode != d.productCode {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	applyLevels(d.bids, m.Data.Bids)
+	applyLevels(d.asks, m.Data.Asks)
+	d.updatedAt = time.Now()
+}
+
+// applyLevels merges price levels into a side. A zero size removes the level.
+func applyLevels(side map[float64]float64, levels []websocket.PriceLevel) {
+	for _, l := range levels {
+		if l.Size == 0 {
+			delete(side, l.Price)
+			continue
+		}
+		side[l.Price] = l.Size
+	}
+}
+
+func (d *dashboard) handleExecutions(m websocket.ExecutionsMessage) {
+	if m.ProductCode != d.productCode && m.ProductCode != "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range m.Executions {
+		d.trades = append([]websocket.Execution{e}, d.trades...)
+	}
+	if len(d.trades) > d.tradeCount {
+		d.trades = d.trades[:d.tradeCount]
+	}
+	d.updatedAt = time.Now()
+}
+
+// setStatus sets the message shown at the bottom of the screen
+func (d *dashboard) setStatus(format string, args ...any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status = fmt.Sprintf(format, args...)
+}
+
+// poll reloads open orders and positions over REST
+func (d *dashboard) poll(ctx context.Context) error {
+	if d.api == nil {
+		return nil
+	}
+
+	state := http.GetV1MeGetchildordersParamsChildOrderStateACTIVE
+	ordersResp, err := d.api.GetV1MeGetchildordersWithResponse(ctx, &http.GetV1MeGetchildordersParams{
+		ProductCode:     d.productCode,
+		ChildOrderState: &state,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get open orders: %w", err)
+	}
+	if err := http.CheckResponse(ordersResp.StatusCode(), ordersResp.Body); err != nil {
+		return fmt.Errorf("failed to get open orders: %w", err)
+	}
+
+	var positions []http.Position
+	if d.showPositions {
+		positionsResp, err := d.api.GetV1MeGetpositionsWithResponse(ctx, &http.GetV1MeGetpositionsParams{
+			ProductCode: d.productCode,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get positions: %w", err)
+		}
+		if err := http.CheckResponse(positionsResp.StatusCode(), positionsResp.Body); err != nil {
+			return fmt.Errorf("failed to get positions: %w", err)
+		}
+		if positionsResp.JSON200 != nil {
+			positions = *positionsResp.JSON200
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.orders = nil
+	if ordersResp.JSON200 != nil {
+		d.orders = *ordersResp.JSON200
+	}
+	d.positions = positions
+	return nil
+}
+
+// command runs a keyboard command and reports whether to quit
+func (d *dashboard) command(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch fields[0] {
+	case "q", "quit":
+		return true
+	case "r", "refresh":
+		if err := d.poll(ctx); err != nil {
+			d.setStatus("%v", err)
+		} else {
+			d.setStatus("refreshed")
+		}
+	case "c", "cancel":
+		if d.trader == nil {
+			d.setStatus("cancel requires BITFLYER_API_KEY and BITFLYER_API_SECRET")
+			return false
+		}
+		if len(fields) != 2 {
+			d.setStatus("usage: c N")
+			return false
+		}
+		n, err := strconv.Atoi(fields[1])
+		d.mu.Lock()
+		var order http.ChildOrder
+		valid := err == nil && n >= 1 && n <= len(d.orders)
+		if valid {
+			order = d.orders[n-1]
+		}
+		d.mu.Unlock()
+		if !valid || order.ChildOrderAcceptanceId == nil {
+			d.setStatus("no open order %s", fields[1])
+			return false
+		}
+		if err := d.trader.CancelChildOrder(ctx, d.productCode, *order.ChildOrderAcceptanceId); err != nil {
+			d.setStatus("%v", err)
+			return false
+		}
+		d.setStatus("canceled %s", *order.ChildOrderAcceptanceId)
+		if err := d.poll(ctx); err != nil {
+			d.setStatus("%v", err)
+		}
+	case "ca", "cancel-all":
+		if d.trader == nil {
+			d.setStatus("cancel requires BITFLYER_API_KEY and BITFLYER_API_SECRET")
+			return false
+		}
+		if err := d.trader.CancelAllChildOrders(ctx, d.productCode); err != nil {
+			d.setStatus("%v", err)
+			return false
+		}
+		d.setStatus("canceled all %s orders", d.productCode)
+		if err := d.poll(ctx); err != nil {
+			d.setStatus("%v", err)
+		}
+	default:
+		d.setStatus("unknown command %q; %s", fields[0], dashboardHelp)
+	}
+	return false
+}
+
+// render writes the current state as plain text
+func (d *dashboard) render(w io.Writer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := d.ticker
+	fmt.Fprintf(w, "%s  LTP %s  BID %s (%s)  ASK %s (%s)  VOL %s\n",
+		d.productCode, formatNumber(t.Ltp),
+		formatNumber(t.BestBid), formatNumber(t.BestBidSize),
+		formatNumber(t.BestAsk), formatNumber(t.BestAskSize),
+		formatNumber(t.Volume))
+	if !d.updatedAt.IsZero() {
+		fmt.Fprintf(w, "updated %s\n", d.updatedAt.Format("15:04:05"))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\nORDER BOOK")
+	fmt.Fprintln(tw, "SIZE\tPRICE\t\t")
+	asks := sortedLevels(d.asks, true, d.depth)
+	for i := len(asks) - 1; i >= 0; i-- {
+		fmt.Fprintf(tw, "%s\t%s\tASK\t\n", formatNumber(asks[i].Size), formatNumber(asks[i].Price))
+	}
+	for _, l := range sortedLevels(d.bids, false, d.depth) {
+		fmt.Fprintf(tw, "%s\t%s\tBID\t\n", formatNumber(l.Size), formatNumber(l.Price))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nTRADES")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSIDE\tPRICE\tSIZE")
+	for _, e := range d.trades {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", formatExecDate(e.ExecDate), e.Side, formatNumber(e.Price), formatNumber(e.Size))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if d.api != nil {
+		fmt.Fprintln(w, "\nOPEN ORDERS")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tID\tSIDE\tTYPE\tPRICE\tSIZE\tOUTSTANDING")
+		for i, o := range d.orders {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1,
+				formatValueOf(o.ChildOrderAcceptanceId), formatValueOf(o.Side), formatValueOf(o.ChildOrderType),
+				formatValueOf(o.Price), formatValueOf(o.Size), formatValueOf(o.OutstandingSize))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if d.showPositions {
+		fmt.Fprintln(w, "\nPOSITIONS")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SIDE\tPRICE\tSIZE\tPNL")
+		for _, p := range d.positions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+				formatValueOf(p.Side), formatValueOf(p.Price), formatValueOf(p.Size), formatValueOf(p.Pnl))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\n%s\n> ", d.status)
+	return err
+}
+
+// sortedLevels returns up to depth levels ordered from the best price
+func sortedLevels(side map[float64]float64, ascending bool, depth int) []websocket.PriceLevel {
+	levels := make([]websocket.PriceLevel, 0, len(side))
+	for price, size := range side {
+		levels = append(levels, websocket.PriceLevel{Price: price, Size: size})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		if ascending {
+			return levels[i].Price < levels[j].Price
+		}
+		return levels[i].Price > levels[j].Price
+	})
+	if depth > 0 && len(levels) > depth {
+		levels = levels[:depth]
+	}
+	return levels
+}
+
+// formatNumber formats a float without trailing zeros
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatExecDate shortens an execution timestamp to the time of day
+func formatExecDate(s string) string {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return s
+	}
+	return t.Local().Format("15:04:05")
+}
+
+func runDashboard(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("dashboard")
+	productCode := fs.String("product", "BTC_JPY", "product code")
+	depth := fs.Int("depth", 10, "price levels per side")
+	tradeCount := fs.Int("trades", 15, "number of recent trades")
+	refresh := fs.Duration("refresh", 500*time.Millisecond, "screen refresh interval")
+	pollInterval := fs.Duration("poll", 5*time.Second, "open orders and positions polling interval")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	d := newDashboard(*productCode, *depth, *tradeCount)
+	creds := c.credentials()
+	authenticated := creds.APIKey != "" && creds.APISecret != ""
+	if authenticated {
+		ac, err := c.client(true)
+		if err != nil {
+			return err
+		}
+		d.authenticate(ac)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dialCtx, cancelDial := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelDial()
+	client, err := websocket.NewClient(dialCtx, c.wsURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close(context.Background())
+
+	client.OnTicker(d.handleTicker)
+	client.OnBoardSnapshot(d.handleBoardSnapshot)
+	client.OnBoard(d.handleBoard)
+	client.OnExecutions(d.handleExecutions)
+
+	// Refresh open orders as soon as an order event arrives
+	orderEvents := make(chan struct{}, 1)
+	client.OnOrderEvents(func(websocket.OrderEventMessage) {
+		select {
+		case orderEvents <- struct{}{}:
+		default:
+		}
+	})
+
+	if authenticated {
+		if err := client.Auth(ctx, creds.APIKey, creds.APISecret); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+		if err := client.Subscribe(ctx, websocket.ChildOrderEventsChannel); err != nil {
+			return err
+		}
+	}
+	for _, subscribe := range []func(context.Context, string) error{
+		client.SubscribeBoardSnapshot,
+		client.SubscribeBoard,
+		client.SubscribeTicker,
+		client.SubscribeExecutions,
+	} {
+		if err := subscribe(ctx, *productCode); err != nil {
+			return err
+		}
+	}
+
+	// Read keyboard commands line by line
+	go func() {
+		scanner := bufio.NewScanner(c.stdin)
+		for scanner.Scan() {
+			if d.command(ctx, scanner.Text()) {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	if err := d.poll(ctx); err != nil {
+		d.setStatus("%v", err)
+	}
+
+	refreshTicker := time.NewTicker(*refresh)
+	defer refreshTicker.Stop()
+	pollTicker := time.NewTicker(*pollInterval)
+	defer pollTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-refreshTicker.C:
+			fmt.Fprint(c.stdout, ansiHome+ansiClear)
+			if err := d.render(c.stdout); err != nil {
+				return err
+			}
+		case <-pollTicker.C:
+			if err := d.poll(ctx); err != nil {
+				d.setStatus("%v", err)
+			}
+		case <-orderEvents:
+			if err := d.poll(ctx); err != nil {
+				d.setStatus("%v", err)
+			}
+		}
+	}
+}
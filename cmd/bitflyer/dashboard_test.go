@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	bfhttp "github.com/bmf-san/go-bitflyer-api-client/client/http"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+func TestDashboard_BoardAndTrades(t *testing.T) {
+	d := newDashboard("BTC_JPY", 2, 2)
+
+	d.handleBoardSnapshot(websocket.BoardSnapshotMessage{
+		ProductCode: "BTC_JPY",
+		Data: websocket.BoardData{
+			Bids: []websocket.PriceLevel{{Price: 100, Size: 1}, {Price: 99, Size: 2}, {Price: 98, Size: 3}},
+			Asks: []websocket.PriceLevel{{Price: 101, Size: 1}, {Price: 102, Size: 2}},
+		},
+	})
+	// Remove the best bid, add a new best ask, ignore other products
+	d.handleBoard(websocket.BoardMessage{
+		ProductCode: "BTC_JPY",
+		Data: websocket.BoardData{
+			Bids: []websocket.PriceLevel{{Price: 100, Size: 0}},
+			Asks: []websocket.PriceLevel{{Price: 100.5, Size: 4}},
+		},
+	})
+	d.handleBoard(websocket.BoardMessage{
+		ProductCode: "ETH_JPY",
+		Data:        websocket.BoardData{Bids: []websocket.PriceLevel{{Price: 200, Size: 1}}},
+	})
+	d.handleExecutions(websocket.ExecutionsMessage{
+		ProductCode: "BTC_JPY",
+		Executions: []websocket.Execution{
+			{ID: 1, Side: "BUY", Price: 101, Size: 0.1},
+			{ID: 2, Side: "SELL", Price: 100, Size: 0.2},
+			{ID: 3, Side: "BUY", Price: 100.5, Size: 0.3},
+		},
+	})
+
+	var buf bytes.Buffer
+	if err := d.render(&buf); err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	out := buf.String()
+
+	// Asks from the highest shown price down, then bids from the best
+	last := -1
+	for _, want := range []string{"1    101  ASK", "4  100.5  ASK", "2     99  BID", "3     98  BID"} {
+		i := strings.Index(out, want)
+		if i < 0 {
+			t.Fatalf("Expected %q in output:\n%s", want, out)
+		}
+		if i < last {
+			t.Errorf("Expected %q after the previous level:\n%s", want, out)
+		}
+		last = i
+	}
+	// Only the two best asks are shown
+	if strings.Contains(out, "102") {
+		t.Errorf("Expected depth to limit the asks:\n%s", out)
+	}
+	if strings.Contains(out, "200") {
+		t.Errorf("Expected other products to be ignored:\n%s", out)
+	}
+
+	// Only the two newest trades are kept
+	if len(d.trades) != 2 || d.trades[0].ID != 3 || d.trades[1].ID != 2 {
+		t.Errorf("Unexpected trades: %+v", d.trades)
+	}
+	if strings.Contains(out, "OPEN ORDERS") {
+		t.Errorf("Expected no open orders without credentials:\n%s", out)
+	}
+}
+
+func TestDashboard_Commands(t *testing.T) {
+	fake := &fakeAPI{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	ac, err := bfhttp.NewAuthenticatedClient(auth.APICredentials{APIKey: "key", APISecret: "secret"}, srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx := context.Background()
+	d := newDashboard("BTC_JPY", 10, 10)
+	if d.command(ctx, "c 1") || !strings.Contains(d.status, "requires") {
+		t.Errorf("Expected cancel to require credentials, status %q", d.status)
+	}
+
+	d.authenticate(ac)
+	if d.showPositions {
+		t.Error("Expected positions to be hidden for spot products")
+	}
+	if err := d.poll(ctx); err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := d.render(&buf); err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "1  JRF-1  BUY   LIMIT") {
+		t.Errorf("Expected the open order in output:\n%s", buf.String())
+	}
+
+	if d.command(ctx, "c 2") || !strings.Contains(d.status, "no open order 2") {
+		t.Errorf("Unexpected status %q", d.status)
+	}
+	if d.command(ctx, "c 1") {
+		t.Error("Expected cancel not to quit")
+	}
+	if d.status != "canceled JRF-1" {
+		t.Errorf("Unexpected status %q", d.status)
+	}
+
+	var cancel map[string]any
+	for i, r := range fake.requests {
+		if r.URL.Path == "/v1/me/cancelchildorder" {
+			if err := json.Unmarshal([]byte(fake.bodies[i]), &cancel); err != nil {
+				t.Fatalf("Failed to decode cancel request: %v", err)
+			}
+		}
+	}
+	if cancel["child_order_acceptance_id"] != "JRF-1" || cancel["product_code"] != "BTC_JPY" {
+		t.Errorf("Unexpected cancel request: %v", cancel)
+	}
+
+	if d.command(ctx, "ca") || d.status != "canceled all BTC_JPY orders" {
+		t.Errorf("Unexpected status %q", d.status)
+	}
+	if d.command(ctx, "x") || !strings.Contains(d.status, "unknown command") {
+		t.Errorf("Unexpected status %q", d.status)
+	}
+	if !d.command(ctx, "q") {
+		t.Error("Expected q to quit")
+	}
+}
+
+func TestRunDashboard(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	stdin, input := io.Pipe()
+	c, _, out, _ := newTestCLI(t, nil)
+	c.stdin = stdin
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.run(context.Background(), []string{"-ws-url", srv.URL, "dashboard", "-product", "BTC_JPY", "-refresh", "10ms"})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	channels := []string{
+		websocket.TickerChannel("BTC_JPY"),
+		websocket.BoardSnapshotChannel("BTC_JPY"),
+		websocket.BoardChannel("BTC_JPY"),
+		websocket.ExecutionsChannel("BTC_JPY"),
+	}
+	if err := srv.WaitSubscribed(ctx, channels...); err != nil {
+		t.Fatalf("WaitSubscribed() error = %v", err)
+	}
+	if _, err := srv.Publish(websocket.TickerChannel("BTC_JPY"), map[string]any{"product_code": "BTC_JPY", "ltp": 3000000}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for !strings.Contains(out.String(), "LTP 3000000") {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the ticker, output:\n%s", out.String())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if _, err := io.WriteString(input, "q\n"); err != nil {
+		t.Fatalf("Failed to write command: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run() error = %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the dashboard to quit")
+	}
+}
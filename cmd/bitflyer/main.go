@@ -0,0 +1,165 @@
+// Command bitflyer is a command-line client for the bitFlyer Lightning API.
+//
+// Usage:
+//
+//	bitflyer [global flags] <command> [flags] [args]
+//
+// Private commands read credentials from BITFLYER_API_KEY and
+// BITFLYER_API_SECRET.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/auth"
+	"github.com/bmf-san/go-bitflyer-api-client/client/http"
+)
+
+// defaultWebSocketURL is the realtime API endpoint used by stream
+const defaultWebSocketURL = "wss://ws.lightstream.bitflyer.com/json-rpc"
+
+// command is a subcommand of the CLI
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+// commands are the subcommands by name. It is populated in init since the
+// subcommands refer back to it for their usage.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"markets":       {"markets", "List markets of the region", runMarkets},
+		"ticker":        {"ticker -product CODE", "Show the ticker", runTicker},
+		"board":         {"board -product CODE [-depth N]", "Show the order book", runBoard},
+		"executions":    {"executions -product CODE [-count N]", "List recent executions", runExecutions},
+		"balance":       {"balance", "Show asset balances", runBalance},
+		"collateral":    {"collateral", "Show margin collateral", runCollateral},
+		"positions":     {"positions [-product CODE]", "List open FX/futures positions", runPositions},
+		"orders":        {"orders list|send|cancel|cancel-all [flags]", "List, send and cancel child orders", runOrders},
+		"parent-orders": {"parent-orders -product CODE [-state STATE] [-count N]", "List parent orders", runParentOrders},
+		"deposits":      {"deposits [-coin] [-count N]", "List cash (or crypto) deposits", runDeposits},
+		"withdrawals":   {"withdrawals [-coin] [-count N]", "List cash (or crypto) withdrawals", runWithdrawals},
+		"dashboard":     {"dashboard [-product CODE] [-depth N] [-trades N]", "Live order book, trades, open orders and positions", runDashboard},
+		"stream":        {"stream [-duration D] CHANNEL...", "Tail realtime channels as JSON lines", runStream},
+	}
+}
+
+// cli holds the global flags and I/O of an invocation
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+
+	format  string
+	baseURL string
+	region  string
+	wsURL   string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv}
+	if err := c.run(ctx, os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "bitflyer: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and dispatches to the subcommand
+func (c *cli) run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bitflyer", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.format, "o", formatTable, "output format: json, table or csv")
+	fs.StringVar(&c.baseURL, "base-url", "", "REST API base URL")
+	fs.StringVar(&c.region, "region", string(http.RegionJP), "Lightning region: JP, US or EU")
+	fs.StringVar(&c.wsURL, "ws-url", defaultWebSocketURL, "realtime API URL")
+	fs.Usage = func() { c.usage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := validateFormat(c.format); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		c.usage(fs)
+		return fmt.Errorf("no command given")
+	}
+
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		c.usage(fs)
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.run(ctx, c, fs.Args()[1:])
+}
+
+// usage prints the global flags and the subcommands
+func (c *cli) usage(fs *flag.FlagSet) {
+	fmt.Fprintln(c.stderr, "Usage: bitflyer [global flags] <command> [flags] [args]")
+	fmt.Fprintln(c.stderr, "\nGlobal flags:")
+	fs.PrintDefaults()
+	fmt.Fprintln(c.stderr, "\nCommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(c.stderr, "  %-60s %s\n", commands[name].usage, commands[name].summary)
+	}
+	fmt.Fprintln(c.stderr, "\nPrivate commands read BITFLYER_API_KEY and BITFLYER_API_SECRET.")
+}
+
+// credentials returns the API credentials from the environment
+func (c *cli) credentials() auth.APICredentials {
+	return auth.APICredentials{
+		APIKey:    c.getenv("BITFLYER_API_KEY"),
+		APISecret: c.getenv("BITFLYER_API_SECRET"),
+	}
+}
+
+// client creates the REST client. Private commands require credentials.
+func (c *cli) client(private bool) (*http.AuthenticatedClient, error) {
+	creds := c.credentials()
+	if private && (creds.APIKey == "" || creds.APISecret == "") {
+		return nil, fmt.Errorf("BITFLYER_API_KEY and BITFLYER_API_SECRET must be set")
+	}
+	return http.NewAuthenticatedClient(creds, c.baseURL, http.WithRegion(http.Region(strings.ToUpper(c.region))))
+}
+
+// output writes v in the selected format
+func (c *cli) output(v any) error {
+	return writeOutput(c.stdout, c.format, v)
+}
+
+// newFlagSet creates a flag set for a subcommand
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: bitflyer %s\n", commands[strings.Fields(name)[0]].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
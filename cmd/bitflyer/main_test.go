@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket/wstest"
+)
+
+// fakeAPI serves canned REST responses and records requests
+type fakeAPI struct {
+	requests []*http.Request
+	bodies   []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, string(body))
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/getmarkets/usa":
+		_, _ = w.Write([]byte(`[{"product_code":"BTC_USD","market_type":"Spot"}]`))
+	case "/v1/getticker":
+		_, _ = w.Write([]byte(`{"product_code":"BTC_JPY","ltp":3000000,"best_bid":2999000,"best_ask":3001000}`))
+	case "/v1/getboard":
+		_, _ = w.Write([]byte(`{"mid_price":3000000,"bids":[{"price":2999000,"size":1},{"price":2998000,"size":2}],"asks":[{"price":3001000,"size":0.5},{"price":3002000,"size":3}]}`))
+	case "/v1/getexecutions":
+		// float32 cannot hold 17000001 or 0.12345678 exactly
+		_, _ = w.Write([]byte(`[{"id":1,"side":"BUY","price":17000001,"size":0.12345678,"exec_date":"2024-01-01T00:00:00Z"}]`))
+	case "/v1/me/sendchildorder":
+		_, _ = w.Write([]byte(`{"child_order_acceptance_id":"JRF-TEST"}`))
+	case "/v1/me/getchildorders":
+		_, _ = w.Write([]byte(`[{"child_order_acceptance_id":"JRF-1","side":"BUY","child_order_type":"LIMIT","price":2990000,"size":0.01,"outstanding_size":0.01}]`))
+	case "/v1/me/cancelchildorder", "/v1/me/cancelallchildorders":
+		w.WriteHeader(http.StatusOK)
+	case "/v1/me/getbalance":
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"status":-500,"error_message":"Key not found"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestCLI returns a CLI writing to a buffer and the global flags
+// that point it at a fake REST API
+func newTestCLI(t *testing.T, env map[string]string) (*cli, *fakeAPI, *syncBuffer, []string) {
+	t.Helper()
+	fake := &fakeAPI{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	stdout := &syncBuffer{}
+	c := &cli{
+		stdout: stdout,
+		stderr: io.Discard,
+		getenv: func(key string) string { return env[key] },
+	}
+	return c, fake, stdout, []string{"-base-url", srv.URL}
+}
+
+var testEnv = map[string]string{
+	"BITFLYER_API_KEY":    "key",
+	"BITFLYER_API_SECRET": "secret",
+}
+
+func TestRun_Ticker(t *testing.T) {
+	c, fake, stdout, global := newTestCLI(t, nil)
+	args := append(global, "-o", "json", "ticker", "-product", "BTC_JPY")
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	var ticker map[string]any
+	if err := json.Unmarshal([]byte(stdout.String()), &ticker); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", stdout.String(), err)
+	}
+	if ticker["product_code"] != "BTC_JPY" {
+		t.Errorf("Unexpected ticker: %v", ticker)
+	}
+	if got := fake.requests[0].URL.Query().Get("product_code"); got != "BTC_JPY" {
+		t.Errorf("Expected product_code BTC_JPY, got %s", got)
+	}
+}
+
+func TestRun_MarketsRegion(t *testing.T) {
+	c, _, stdout, global := newTestCLI(t, nil)
+	args := append(global, "-o", "csv", "-region", "us", "markets")
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	want := "alias,market_type,product_code\n,Spot,BTC_USD\n"
+	if stdout.String() != want {
+		t.Errorf("Unexpected output %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestRun_BoardLadder(t *testing.T) {
+	c, _, stdout, global := newTestCLI(t, nil)
+	args := append(global, "-o", "csv", "board", "-product", "BTC_JPY", "-depth", "1")
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	want := "side,price,size\nASK,3001000,0.5\nBID,2999000,1\n"
+	if stdout.String() != want {
+		t.Errorf("Unexpected output %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestRun_OrdersSend(t *testing.T) {
+	c, fake, stdout, global := newTestCLI(t, testEnv)
+	args := append(global, "-o", "csv",
+		"orders", "send", "-product", "BTC_JPY", "-side", "buy", "-price", "3000000", "-size", "0.01", "-tif", "ioc")
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if stdout.String() != "child_order_acceptance_id\nJRF-TEST\n" {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+
+	var sent map[string]any
+	if err := json.Unmarshal([]byte(fake.bodies[0]), &sent); err != nil {
+		t.Fatalf("Failed to decode request body: %v", err)
+	}
+	if sent["side"] != "BUY" || sent["child_order_type"] != "LIMIT" || sent["time_in_force"] != "IOC" {
+		t.Errorf("Unexpected order: %v", sent)
+	}
+	if fake.requests[0].Header.Get("ACCESS-KEY") != "key" {
+		t.Error("Expected the request to be signed with the API key")
+	}
+}
+
+func TestRun_Executions(t *testing.T) {
+	c, _, stdout, global := newTestCLI(t, nil)
+	args := append(global, "-o", "csv", "executions", "-product", "BTC_JPY")
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	want := "child_order_acceptance_id,child_order_id,commission,exec_date,id,price,side,size\n" +
+		",,,2024-01-01T00:00:00Z,1,17000001,BUY,0.12345678\n"
+	if stdout.String() != want {
+		t.Errorf("Unexpected output %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestRun_OrdersCancel(t *testing.T) {
+	c, fake, stdout, global := newTestCLI(t, testEnv)
+	args := append(global, "-o", "csv", "orders", "cancel", "-product", "BTC_JPY", "-id", "JRF-1")
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if stdout.String() != "child_order_acceptance_id\nJRF-1\n" {
+		t.Errorf("Unexpected output %q", stdout.String())
+	}
+	if len(fake.requests) != 1 || fake.requests[0].URL.Path != "/v1/me/cancelchildorder" {
+		t.Errorf("Unexpected requests: %v", fake.requests)
+	}
+}
+
+func TestRun_OrdersCancelAll(t *testing.T) {
+	c, fake, _, global := newTestCLI(t, testEnv)
+	args := append(global, "orders", "cancel-all", "-product", "BTC_JPY")
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if len(fake.requests) != 1 || fake.requests[0].URL.Path != "/v1/me/cancelallchildorders" {
+		t.Errorf("Unexpected requests: %v", fake.requests)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{"no command", nil, nil, "no command given"},
+		{"unknown command", nil, []string{"foo"}, "unknown command"},
+		{"unknown format", nil, []string{"-o", "yaml", "markets"}, "unknown output format"},
+		{"missing product", nil, []string{"ticker"}, "-product is required"},
+		{"missing credentials", nil, []string{"balance"}, "BITFLYER_API_KEY"},
+		{"api error", testEnv, []string{"balance"}, "Key not found"},
+		{"invalid side", testEnv, []string{"orders", "send", "-product", "BTC_JPY", "-side", "HOLD", "-size", "1"}, "-side must be BUY or SELL"},
+		{"invalid order", testEnv, []string{"orders", "send", "-product", "BTC_JPY", "-side", "BUY", "-size", "1"}, "limit order requires a positive price"},
+		{"missing orders subcommand", testEnv, []string{"orders"}, "subcommand required"},
+		{"unexpected args", nil, []string{"markets", "extra"}, "unexpected arguments"},
+		{"missing channel", nil, []string{"stream"}, "at least one channel"},
+		{"private stream without credentials", nil, []string{"stream", "child_order_events"}, "private channels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _, global := newTestCLI(t, tt.env)
+			args := append(global, tt.args...)
+			err := c.run(context.Background(), args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRun_Stream(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.WaitSubscribed(ctx, "lightning_ticker_BTC_JPY"); err != nil {
+			return
+		}
+		_, _ = srv.Publish("lightning_ticker_BTC_JPY", map[string]any{"product_code": "BTC_JPY", "ltp": 3000000})
+	}()
+
+	c, _, out, _ := newTestCLI(t, nil)
+
+	args := []string{"-ws-url", srv.URL, "stream", "-duration", "500ms", "lightning_ticker_BTC_JPY"}
+	if err := c.run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	var event struct {
+		Type    string         `json:"type"`
+		Message map[string]any `json:"message"`
+	}
+	line, _, _ := strings.Cut(out.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", out.String(), err)
+	}
+	if event.Type != "ticker" || event.Message["ltp"] != float64(3000000) {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
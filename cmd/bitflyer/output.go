@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+	formatCSV   = "csv"
+)
+
+// validateFormat checks the -o flag value
+func validateFormat(format string) error {
+	switch format {
+	case formatJSON, formatTable, formatCSV:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q (want json, table or csv)", format)
+	}
+}
+
+// writeOutput writes v in the format. Table and CSV output accept a struct
+// or a slice of structs; each struct becomes one row and its JSON field
+// names become the header.
+func writeOutput(w io.Writer, format string, v any) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	header, rows, err := tabulate(v)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return validateFormat(format)
+	}
+}
+
+// tabulate flattens a struct or a slice of structs into a header and rows
+func tabulate(v any) ([]string, [][]string, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil, nil
+		}
+		rv = rv.Elem()
+	}
+
+	var items []reflect.Value
+	elemType := rv.Type()
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		elemType = elemType.Elem()
+		for elemType.Kind() == reflect.Pointer {
+			elemType = elemType.Elem()
+		}
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		items = append(items, rv)
+	default:
+		return nil, nil, fmt.Errorf("cannot tabulate %s", rv.Type())
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("cannot tabulate %s", rv.Type())
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < elemType.NumField(); i++ {
+		f := elemType.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		row := make([]string, len(fields))
+		if item.IsValid() {
+			for j, i := range fields {
+				row[j] = formatValue(item.Field(i))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// formatValue renders a single cell. Nil pointers are empty; nested
+// structs, slices and maps are rendered as JSON.
+func formatValue(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339Nano)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	default:
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Sprint(v.Interface())
+		}
+		return string(b)
+	}
+}
+
+// formatValueOf renders a single value as formatValue does
+func formatValueOf(v any) string {
+	return formatValue(reflect.ValueOf(v))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	Name    *string    `json:"name,omitempty"`
+	Price   *float32   `json:"price,omitempty"`
+	Date    *time.Time `json:"date,omitempty"`
+	Tags    []string   `json:"tags"`
+	Skipped string     `json:"-"`
+	hidden  string
+}
+
+func TestWriteOutput(t *testing.T) {
+	name := "BTC_JPY"
+	price := float32(3000000.5)
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []testRow{
+		{Name: &name, Price: &price, Date: &date, Tags: []string{"a"}, Skipped: "x", hidden: "y"},
+		{},
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		v      any
+		want   string
+	}{
+		{
+			name:   "csv slice",
+			format: formatCSV,
+			v:      rows,
+			want:   "name,price,date,tags\nBTC_JPY,3000000.5,2024-01-02T03:04:05Z,\"[\"\"a\"\"]\"\n,,,null\n",
+		},
+		{
+			name:   "csv pointer to slice",
+			format: formatCSV,
+			v:      &rows,
+			want:   "name,price,date,tags\nBTC_JPY,3000000.5,2024-01-02T03:04:05Z,\"[\"\"a\"\"]\"\n,,,null\n",
+		},
+		{
+			name:   "table struct",
+			format: formatTable,
+			v:      rows[0],
+			want:   "NAME     PRICE      DATE                  TAGS\nBTC_JPY  3000000.5  2024-01-02T03:04:05Z  [\"a\"]\n",
+		},
+		{
+			name:   "json",
+			format: formatJSON,
+			v:      rows[1],
+			want:   "{\n  \"tags\": null\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeOutput(&buf, tt.format, tt.v); err != nil {
+				t.Fatalf("writeOutput() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Unexpected output:\n%s\nwant:\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteOutput_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeOutput(&buf, formatCSV, []string{"a"}); err == nil {
+		t.Error("Expected error for a slice of non-structs")
+	}
+	if err := writeOutput(&buf, formatTable, 42); err == nil {
+		t.Error("Expected error for a scalar")
+	}
+	if err := writeOutput(&buf, "yaml", rows()); err == nil || !strings.Contains(err.Error(), "unknown output format") {
+		t.Errorf("Expected unknown format error, got %v", err)
+	}
+}
+
+func rows() []testRow {
+	return []testRow{{}}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bmf-san/go-bitflyer-api-client/client/websocket"
+)
+
+// streamEvent is one line of stream output
+type streamEvent struct {
+	Type    string `json:"type"`
+	Message any    `json:"message"`
+}
+
+// runStream subscribes to the channels and writes every message as a JSON
+// line until ctx is done or the duration elapses. The -o flag does not
+// apply since messages of different channels have different fields.
+func runStream(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("stream")
+	duration := fs.Duration("duration", 0, "stop after the duration, 0 to run until interrupted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	channels := fs.Args()
+	if len(channels) == 0 {
+		return fmt.Errorf("stream: at least one channel is required, e.g. %s", websocket.TickerChannel("BTC_JPY"))
+	}
+
+	private := false
+	for _, ch := range channels {
+		if ch == websocket.ChildOrderEventsChannel || ch == websocket.ParentOrderEventsChannel {
+			private = true
+		}
+	}
+	creds := c.credentials()
+	if private && (creds.APIKey == "" || creds.APISecret == "") {
+		return fmt.Errorf("BITFLYER_API_KEY and BITFLYER_API_SECRET must be set for private channels")
+	}
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	dialCtx, cancelDial := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelDial()
+	client, err := websocket.NewClient(dialCtx, c.wsURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close(context.Background())
+
+	// Handlers run concurrently, so serialize the writes
+	var mu sync.Mutex
+	enc := json.NewEncoder(c.stdout)
+	write := func(eventType string, message any) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(streamEvent{Type: eventType, Message: message}); err != nil {
+			fmt.Fprintf(c.stderr, "stream: failed to write message: %v\n", err)
+		}
+	}
+
+	client.OnTicker(func(m websocket.TickerMessage) { write("ticker", m) })
+	client.OnExecutions(func(m websocket.ExecutionsMessage) { write("executions", m) })
+	client.OnBoard(func(m websocket.BoardMessage) { write("board", m) })
+	client.OnBoardSnapshot(func(m websocket.BoardSnapshotMessage) { write("board_snapshot", m) })
+	client.OnOrderEvents(func(m websocket.OrderEventMessage) { write("order_event", m) })
+
+	if private {
+		if err := client.Auth(ctx, creds.APIKey, creds.APISecret); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	for _, ch := range channels {
+		if err := client.Subscribe(ctx, ch); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", ch, err)
+		}
+	}
+
+	<-ctx.Done()
+	return nil
+}